@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+)
+
+// Config describes the receiver to connect to and the names given to its settings
+type Config struct {
+	Host   string `json:"host"`
+	Port   string `json:"port"`
+	Listen string `json:"listen"`
+	// Serial device used instead of host and port when set
+	Serial   string `json:"serial"`
+	BaudRate int    `json:"baudRate"`
+	// Receiver model or family, detected when empty
+	Model    string             `json:"model"`
+	Profiles map[string]Profile `json:"profiles"`
+	// Human names of the tuner presets, e.g. "jazz": 3
+	Presets map[string]int `json:"presets"`
+	// How many times changes the receiver did not confirm are repeated,
+	// a pointer so that 0 given in the file turns repeating off
+	Retries *int `json:"retries"`
+	// How long commands wait after powering on, e.g. "1.5s"
+	SettleTime string `json:"settleTime"`
+	// Prefixes of raw messages allowed through /raw, e.g. "MVL" or "PWRQSTN".
+	// The endpoint is disabled when empty.
+	RawCommands []string `json:"rawCommands"`
+}
+
+func DefaultConfig() Config {
+	retries := eiscp.DefaultRetries
+	return Config{
+		Host:     "10.205.0.163",
+		Port:     "60128",
+		Listen:   ":8080",
+		BaudRate: eiscp.DefaultBaudRate,
+		Profiles: map[string]Profile{
+			"tv":      {Name: "tv", VolumeLevel: 22, SubwooferLevel: 0, MaxVolume: 28},
+			"dj":      {Name: "dj", VolumeLevel: 27, SubwooferLevel: -4, MaxVolume: 35},
+			"vinyl":   {Name: "vinyl", VolumeLevel: 20, SubwooferLevel: 0, MaxVolume: 30},
+			"spotify": {Name: "spotify", VolumeLevel: 42, SubwooferLevel: 0, MaxVolume: 50},
+		},
+		Presets:    map[string]int{},
+		Retries:    &retries,
+		SettleTime: eiscp.DefaultSettleTime.String(),
+	}
+}
+
+// Serial device takes precedence over the network address
+func (c Config) Dialer() eiscp.Dialer {
+	if c.Serial != "" {
+		return eiscp.SerialDialer{Device: c.Serial, BaudRate: c.BaudRate}
+	}
+	return eiscp.EISCPDialer{Host: c.Host, Port: c.Port}
+}
+
+// Loads the JSON config file on top of the defaults.
+// Empty path means defaults only.
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+	if path == "" {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read config: %w", err)
+	}
+	var file Config
+	if err := json.Unmarshal(data, &file); err != nil {
+		return config, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	// Settings given in the file replace the defaults as a whole
+	if file.Host != "" {
+		config.Host = file.Host
+	}
+	if file.Port != "" {
+		config.Port = file.Port
+	}
+	if file.Listen != "" {
+		config.Listen = file.Listen
+	}
+	if file.Serial != "" {
+		config.Serial = file.Serial
+	}
+	if file.BaudRate != 0 {
+		config.BaudRate = file.BaudRate
+	}
+	if file.Model != "" {
+		config.Model = file.Model
+	}
+	if file.Profiles != nil {
+		// Profiles are keyed by input, the name inside is only for responses
+		for input, profile := range file.Profiles {
+			profile.Name = input
+			file.Profiles[input] = profile
+		}
+		config.Profiles = file.Profiles
+	}
+	if file.Presets != nil {
+		config.Presets = file.Presets
+	}
+	if file.Retries != nil {
+		if *file.Retries < 0 {
+			return config, fmt.Errorf("negative retries in config %s", path)
+		}
+		config.Retries = file.Retries
+	}
+	if file.SettleTime != "" {
+		if _, err := time.ParseDuration(file.SettleTime); err != nil {
+			return config, fmt.Errorf("invalid settle time in config %s: %w", path, err)
+		}
+		config.SettleTime = file.SettleTime
+	}
+	for _, prefix := range file.RawCommands {
+		// Empty prefix would let every message through
+		if strings.TrimSpace(prefix) == "" {
+			return config, fmt.Errorf("empty raw command prefix in config %s", path)
+		}
+		config.RawCommands = append(config.RawCommands, strings.ToUpper(strings.TrimSpace(prefix)))
+	}
+	return config, nil
+}
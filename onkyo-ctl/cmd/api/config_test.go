@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigRetries(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		wantErr bool
+	}{
+		{"default", `{}`, eiscp.DefaultRetries, false},
+		{"turned off", `{"retries": 0}`, 0, false},
+		{"more", `{"retries": 5}`, 5, false},
+		{"negative", `{"retries": -1}`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := LoadConfig(writeConfig(t, tt.content))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *config.Retries != tt.want {
+				t.Fatalf("Retries = %d, want %d", *config.Retries, tt.want)
+			}
+		})
+	}
+}
@@ -1,12 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -21,19 +28,18 @@ type Profile struct {
 }
 
 type Server struct {
-	client   *eiscp.EISCPClient
-	profiles map[string]Profile
+	client      *eiscp.EISCPClient
+	profiles    map[string]Profile
+	presets     map[string]int
+	rawCommands []string
 }
 
-func NewServer(client *eiscp.EISCPClient) *Server {
+func NewServer(client *eiscp.EISCPClient, config Config) *Server {
 	return &Server{
-		client: client,
-		profiles: map[string]Profile{
-			"tv":      {Name: "tv", VolumeLevel: 22, SubwooferLevel: 0, MaxVolume: 28},
-			"dj":      {Name: "dj", VolumeLevel: 27, SubwooferLevel: -4, MaxVolume: 35},
-			"vinyl":   {Name: "vinyl", VolumeLevel: 20, SubwooferLevel: 0, MaxVolume: 30},
-			"spotify": {Name: "spotify", VolumeLevel: 42, SubwooferLevel: 0, MaxVolume: 50},
-		},
+		client:      client,
+		profiles:    config.Profiles,
+		presets:     config.Presets,
+		rawCommands: config.RawCommands,
 	}
 }
 
@@ -50,6 +56,7 @@ func (s *Server) Routes() chi.Router {
 	r.Route("/volume", func(r chi.Router) {
 		r.Get("/", s.getVolume)
 		r.Put("/", s.setVolume)
+		r.Put("/fade", s.fadeVolume)
 		r.Put("/up", s.volumeUp)
 		r.Put("/down", s.volumeDown)
 	})
@@ -71,6 +78,32 @@ func (s *Server) Routes() chi.Router {
 		r.Put("/", s.setProfile)
 	})
 
+	r.Route("/tuner", func(r chi.Router) {
+		r.Get("/", s.getTuner)
+		r.Put("/", s.setTuner)
+		r.Put("/up", s.tunerUp)
+		r.Put("/down", s.tunerDown)
+		r.Get("/presets", s.getPresets)
+		r.Put("/preset", s.setPreset)
+		r.Put("/preset/store", s.storePreset)
+	})
+
+	r.Route("/device", func(r chi.Router) {
+		r.Get("/", s.getDeviceInfo)
+		r.Get("/model", s.getModel)
+	})
+
+	r.Route("/info", func(r chi.Router) {
+		r.Get("/audio", s.getAudioInformation)
+		r.Get("/video", s.getVideoInformation)
+	})
+
+	r.Route("/now-playing", func(r chi.Router) {
+		r.Get("/art", s.getAlbumArt)
+	})
+
+	r.Put("/raw", s.sendRaw)
+
 	return r
 }
 
@@ -81,20 +114,37 @@ func handleError(w http.ResponseWriter, err error) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 	case errors.Is(err, eiscp.ErrTimeout):
 		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+	case errors.Is(err, eiscp.ErrBusy):
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
 	case errors.Is(err, eiscp.ErrConnection), errors.Is(err, eiscp.ErrTransport):
 		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, eiscp.ErrMismatch):
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	case errors.Is(err, eiscp.ErrNotAvailable):
+		http.Error(w, err.Error(), http.StatusNotFound)
 	default:
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
 // Power handlers
+
+// Reports the state followed from the receiver, asking for it when nothing reported it yet
 func (s *Server) getPowerStatus(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "Power status: on")
+	state := s.client.PowerState()
+	if state == eiscp.PowerStateUnknown {
+		var err error
+		if state, err = s.client.QueryPowerState(); err != nil {
+			handleError(w, err)
+			return
+		}
+	}
+	fmt.Fprintf(w, "Power status: %s", state)
 }
 
 func (s *Server) powerOn(w http.ResponseWriter, r *http.Request) {
-	if err := s.client.PowerOn(); err != nil {
+	if err := s.client.PowerOnConfirmed(); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -102,7 +152,7 @@ func (s *Server) powerOn(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) powerOff(w http.ResponseWriter, r *http.Request) {
-	if err := s.client.PowerOff(); err != nil {
+	if err := s.client.PowerOffConfirmed(); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -110,13 +160,58 @@ func (s *Server) powerOff(w http.ResponseWriter, r *http.Request) {
 }
 
 // Volume handlers
+
+// Percentages are relative to the max volume of the current input profile
+func (s *Server) percentReference() int {
+	if input, err := s.client.QueryInputSelector(); err == nil {
+		if profile, exists := s.profiles[input]; exists {
+			return profile.MaxVolume
+		}
+	}
+	return s.client.MaxVolume()
+}
+
+// Parses the "level" query parameter given in the "unit" one into raw volume steps
+func (s *Server) parseVolumeLevel(r *http.Request) (int, eiscp.VolumeUnit, error) {
+	unit, err := eiscp.ParseVolumeUnit(r.URL.Query().Get("unit"))
+	if err != nil {
+		return 0, "", err
+	}
+	value, err := strconv.ParseFloat(r.URL.Query().Get("level"), 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("%w: invalid volume level format", eiscp.ErrValidation)
+	}
+
+	maxVolume := 0
+	if unit == eiscp.VolumePercent {
+		maxVolume = s.percentReference()
+	}
+	level, err := s.client.VolumeFromUnit(value, unit, maxVolume)
+	return level, unit, err
+}
+
 func (s *Server) getVolume(w http.ResponseWriter, r *http.Request) {
+	unit, err := eiscp.ParseVolumeUnit(r.URL.Query().Get("unit"))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
 	volume, err := s.client.QueryVolume()
 	if err != nil {
 		handleError(w, err)
 		return
 	}
-	fmt.Fprintf(w, "Volume level: %d", volume)
+	if unit == eiscp.VolumeRaw {
+		fmt.Fprintf(w, "Volume level: %d", volume)
+		return
+	}
+
+	maxVolume := 0
+	if unit == eiscp.VolumePercent {
+		maxVolume = s.percentReference()
+	}
+	fmt.Fprintf(w, "Volume level: %s", eiscp.FormatVolume(s.client.VolumeToUnit(volume, unit, maxVolume), unit))
 }
 
 func (s *Server) volumeUp(w http.ResponseWriter, r *http.Request) {
@@ -136,24 +231,78 @@ func (s *Server) volumeDown(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) setVolume(w http.ResponseWriter, r *http.Request) {
-	levelStr := r.URL.Query().Get("level")
-	level, err := strconv.Atoi(levelStr)
+	level, unit, err := s.parseVolumeLevel(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := s.client.PowerOnConfirmed(); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := s.client.SetMasterVolumeConfirmed(level); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if unit == eiscp.VolumeRaw {
+		fmt.Fprintf(w, "Volume set to %d", level)
+		return
+	}
+	fmt.Fprintf(w, "Volume set to %d (%s %s)", level, r.URL.Query().Get("level"), unit)
+}
+
+// Fade parameters come from the "over" duration and optional "curve" query parameters
+func parseFade(r *http.Request) (time.Duration, eiscp.FadeCurve, error) {
+	duration, err := time.ParseDuration(r.URL.Query().Get("over"))
+	if err != nil {
+		return 0, "", fmt.Errorf("%w: invalid fade duration format", eiscp.ErrValidation)
+	}
+	curve := eiscp.FadeCurve(r.URL.Query().Get("curve"))
+	if curve == "" {
+		curve = eiscp.FadeLinear
+	}
+	return duration, curve, nil
+}
+
+// Fades run in background until done or interrupted by another volume command
+func (s *Server) startFade(level int, duration time.Duration, curve eiscp.FadeCurve) {
+	go func() {
+		err := s.client.FadeVolume(context.Background(), level, duration, curve)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("Volume fade to %d failed: %v", level, err)
+		}
+	}()
+}
+
+func (s *Server) fadeVolume(w http.ResponseWriter, r *http.Request) {
+	level, _, err := s.parseVolumeLevel(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	duration, curve, err := parseFade(r)
 	if err != nil {
-		handleError(w, fmt.Errorf("%w: invalid volume level format", eiscp.ErrValidation))
+		handleError(w, err)
 		return
 	}
 
-	if err := s.client.PowerOn(); err != nil {
+	if err := s.client.ValidateFade(level, duration, curve); err != nil {
 		handleError(w, err)
 		return
 	}
 
-	if err := s.client.SetMasterVolume(level); err != nil {
+	if err := s.client.PowerOnConfirmed(); err != nil {
 		handleError(w, err)
 		return
 	}
 
-	fmt.Fprintf(w, "Volume set to %d", level)
+	s.startFade(level, duration, curve)
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "Fading volume to %d over %s", level, duration)
 }
 
 // Subwoofer handlers
@@ -174,12 +323,12 @@ func (s *Server) setSubwoofer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.client.PowerOn(); err != nil {
+	if err := s.client.PowerOnConfirmed(); err != nil {
 		handleError(w, err)
 		return
 	}
 
-	if err := s.client.SetSubwooferLevel(level); err != nil {
+	if err := s.client.SetSubwooferLevelConfirmed(level); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -220,12 +369,12 @@ func (s *Server) setInput(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.client.PowerOn(); err != nil {
+	if err := s.client.PowerOnConfirmed(); err != nil {
 		handleError(w, err)
 		return
 	}
 
-	if err := s.client.SetInputSelector(name); err != nil {
+	if err := s.client.SetInputSelectorConfirmed(name); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -278,38 +427,369 @@ func (s *Server) setProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.client.PowerOn(); err != nil {
+	// Volume jumps straight to the profile level unless asked to fade
+	fade := r.URL.Query().Get("over") != ""
+	var duration time.Duration
+	var curve eiscp.FadeCurve
+	if fade {
+		var err error
+		duration, curve, err = parseFade(r)
+		if err == nil {
+			err = s.client.ValidateFade(profile.VolumeLevel, duration, curve)
+		}
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+	}
+
+	if err := s.client.PowerOnConfirmed(); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if !fade {
+		if err := s.client.SetMasterVolumeConfirmed(profile.VolumeLevel); err != nil {
+			handleError(w, err)
+			return
+		}
+	}
+
+	if err := s.client.SetSubwooferLevelConfirmed(profile.SubwooferLevel); err != nil {
 		handleError(w, err)
 		return
 	}
 
-	if err := s.client.SetMasterVolume(profile.VolumeLevel); err != nil {
+	if err := s.client.SetInputSelectorConfirmed(name); err != nil {
 		handleError(w, err)
 		return
 	}
 
-	if err := s.client.SetSubwooferLevel(profile.SubwooferLevel); err != nil {
+	if fade {
+		s.startFade(profile.VolumeLevel, duration, curve)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// Tuner handlers
+type TunerStatus struct {
+	Frequency   eiscp.TunerFrequency `json:"frequency"`
+	Preset      int                  `json:"preset"`
+	PresetName  string               `json:"presetName,omitempty"`
+	StationName string               `json:"stationName,omitempty"`
+}
+
+func (s *Server) getTuner(w http.ResponseWriter, r *http.Request) {
+	frequency, err := s.client.QueryTunerFrequency()
+	if err != nil {
 		handleError(w, err)
 		return
 	}
 
-	if err := s.client.SetInputSelector(name); err != nil {
+	preset, err := s.client.QueryPreset()
+	if err != nil {
 		handleError(w, err)
 		return
 	}
 
+	// Station name is only broadcast by some stations
+	stationName, _ := s.client.QueryStationName()
+
+	response := TunerStatus{
+		Frequency:   frequency,
+		Preset:      preset,
+		StationName: stationName,
+	}
+	for name, number := range s.presets {
+		if number == preset {
+			response.PresetName = name
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(profile)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) setTuner(w http.ResponseWriter, r *http.Request) {
+	band := r.URL.Query().Get("band")
+	frequency, err := strconv.ParseFloat(r.URL.Query().Get("frequency"), 64)
+	if err != nil {
+		handleError(w, fmt.Errorf("%w: invalid frequency format", eiscp.ErrValidation))
+		return
+	}
+
+	if err := s.client.PowerOnConfirmed(); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := s.client.SetTunerBand(band); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := s.client.SetTunerFrequency(band, frequency); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	fmt.Fprintf(w, "Tuner %s set to %g", band, frequency)
+}
+
+func (s *Server) tunerUp(w http.ResponseWriter, r *http.Request) {
+	if err := s.client.TunerUp(); err != nil {
+		handleError(w, err)
+		return
+	}
+	fmt.Fprint(w, "Tuner frequency: Up")
+}
+
+func (s *Server) tunerDown(w http.ResponseWriter, r *http.Request) {
+	if err := s.client.TunerDown(); err != nil {
+		handleError(w, err)
+		return
+	}
+	fmt.Fprint(w, "Tuner frequency: Down")
+}
+
+func (s *Server) getPresets(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.presets)
+}
+
+// Presets are given either by their configured name or number
+func (s *Server) resolvePreset(r *http.Request) (int, error) {
+	if name := r.URL.Query().Get("name"); name != "" {
+		preset, exists := s.presets[name]
+		if !exists {
+			return 0, fmt.Errorf("%w: preset '%s' does not exist", eiscp.ErrValidation, name)
+		}
+		return preset, nil
+	}
+
+	preset, err := strconv.Atoi(r.URL.Query().Get("number"))
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid preset number format", eiscp.ErrValidation)
+	}
+	return preset, nil
+}
+
+func (s *Server) setPreset(w http.ResponseWriter, r *http.Request) {
+	preset, err := s.resolvePreset(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := s.client.PowerOnConfirmed(); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := s.client.SelectPreset(preset); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	fmt.Fprintf(w, "Preset set to %d", preset)
+}
+
+func (s *Server) storePreset(w http.ResponseWriter, r *http.Request) {
+	preset, err := s.resolvePreset(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := s.client.StorePreset(preset); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	fmt.Fprintf(w, "Station stored as preset %d", preset)
+}
+
+// Device handlers
+func (s *Server) getDeviceInfo(w http.ResponseWriter, r *http.Request) {
+	info, err := s.client.QueryDeviceInfo()
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+func (s *Server) getModel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.client.Model())
+}
+
+// Signal information handlers
+func (s *Server) getAudioInformation(w http.ResponseWriter, r *http.Request) {
+	info, err := s.client.QueryAudioInformation()
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+func (s *Server) getVideoInformation(w http.ResponseWriter, r *http.Request) {
+	info, err := s.client.QueryVideoInformation()
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// Now playing handlers
+func (s *Server) getAlbumArt(w http.ResponseWriter, r *http.Request) {
+	art, ok := s.client.AlbumArt()
+	if !ok {
+		var err error
+		art, err = s.client.QueryAlbumArt()
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+	}
+
+	if art.URL != "" {
+		http.Redirect(w, r, art.URL, http.StatusFound)
+		return
+	}
+
+	// Art changes with every track, so clients have to revalidate
+	sum := sha1.Sum(art.Data)
+	w.Header().Set("Content-Type", art.ContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	http.ServeContent(w, r, "", art.UpdatedAt.Truncate(time.Second), bytes.NewReader(art.Data))
+}
+
+// Raw message handlers
+type RawMessage struct {
+	Message     string `json:"message"`
+	Command     string `json:"command"`
+	Parameter   string `json:"parameter"`
+	Description string `json:"description,omitempty"`
+}
+
+type RawResponse struct {
+	Sent      string       `json:"sent"`
+	Responses []RawMessage `json:"responses"`
+}
+
+// Only messages starting with one of the configured prefixes are let through
+func (s *Server) rawAllowed(message eiscp.Message) bool {
+	text := strings.ToUpper(message.String())
+	for _, prefix := range s.rawCommands {
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sends the "message" query parameter and waits for the response starting with "expect",
+// the same command by default, unless "wait" is false
+func (s *Server) sendRaw(w http.ResponseWriter, r *http.Request) {
+	message, err := eiscp.ParseMessage(r.URL.Query().Get("message"))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	if !s.rawAllowed(message) {
+		http.Error(w, fmt.Sprintf("message '%s' is not allowed, see rawCommands in the config", message), http.StatusForbidden)
+		return
+	}
+
+	wait := true
+	if value := r.URL.Query().Get("wait"); value != "" {
+		if wait, err = strconv.ParseBool(value); err != nil {
+			handleError(w, fmt.Errorf("%w: invalid wait format", eiscp.ErrValidation))
+			return
+		}
+	}
+	var timeout time.Duration
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		if timeout, err = time.ParseDuration(value); err != nil || timeout <= 0 {
+			handleError(w, fmt.Errorf("%w: invalid timeout format", eiscp.ErrValidation))
+			return
+		}
+	}
+
+	var responses []eiscp.Message
+	if wait {
+		responses, err = s.client.Exchange(message, r.URL.Query().Get("expect"), timeout)
+	} else {
+		err = s.client.SendMessage(message)
+	}
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	response := RawResponse{Sent: message.String(), Responses: []RawMessage{}}
+	for _, received := range responses {
+		response.Responses = append(response.Responses, RawMessage{
+			Message:     received.String(),
+			Command:     received.Command,
+			Parameter:   received.Parameter,
+			Description: eiscp.Describe(received),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
 func main() {
-	client, err := eiscp.NewEISCPClient("10.205.0.163", "60128")
+	config, err := LoadConfig(os.Getenv("ONKYO_CONFIG"))
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	if host := os.Getenv("ONKYO_HOST"); host != "" {
+		config.Host = host
+	}
+	if port := os.Getenv("ONKYO_PORT"); port != "" {
+		config.Port = port
+	}
+	if serial := os.Getenv("ONKYO_SERIAL"); serial != "" {
+		config.Serial = serial
+	}
+	if model := os.Getenv("ONKYO_MODEL"); model != "" {
+		config.Model = model
+	}
+
+	client, err := eiscp.Dial(config.Dialer())
 	if err != nil {
 		log.Fatalf("Error connecting to server: %v", err)
 	}
-	defer client.Conn.Close()
+	defer client.Close()
 
 	log.Println("Connected to server")
-	server := NewServer(client)
-	log.Fatal(http.ListenAndServe(":8080", server.Routes()))
+	client.SetRetries(*config.Retries)
+	// Validated when loading the config
+	settleTime, _ := time.ParseDuration(config.SettleTime)
+	client.SetSettleTime(settleTime)
+	if config.Model != "" {
+		if err := client.SetModel(config.Model); err != nil {
+			log.Fatalf("Error selecting model: %v", err)
+		}
+	}
+	// Device information also refines input names, so it is worth asking for with a fixed model too
+	if model, err := client.DetectModel(); err != nil && config.Model == "" {
+		log.Printf("Model detection failed, assuming %s: %v", model.Name, err)
+	}
+	server := NewServer(client, config)
+	log.Fatal(http.ListenAndServe(config.Listen, server.Routes()))
 }
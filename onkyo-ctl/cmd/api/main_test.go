@@ -0,0 +1,134 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp/eiscptest"
+)
+
+// Serves the API in front of the fake receiver
+func newTestServer(t *testing.T, config Config) (*httptest.Server, *eiscptest.Transport, *eiscp.EISCPClient) {
+	t.Helper()
+	fake := eiscptest.NewTransport()
+	client := fake.Client()
+	client.SetCommandGap(0)
+	client.SetTimeout(50 * time.Millisecond)
+	client.SetSettleTime(0)
+	server := httptest.NewServer(NewServer(client, config).Routes())
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	return server, fake, client
+}
+
+func request(t *testing.T, server *httptest.Server, method, path string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestGetPowerStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		pushed     string
+		responses  []string
+		wantStatus int
+		wantBody   string
+		wantSent   []string
+	}{
+		{"asked when unknown, on", "", []string{"PWR01"}, http.StatusOK, "Power status: on", []string{"PWRQSTN"}},
+		{"asked when unknown, standby", "", []string{"PWR00"}, http.StatusOK, "Power status: standby", []string{"PWRQSTN"}},
+		{"followed from the receiver", "PWR00", nil, http.StatusOK, "Power status: standby", nil},
+		{"no answer", "", nil, http.StatusGatewayTimeout, "", []string{"PWRQSTN"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, fake, client := newTestServer(t, DefaultConfig())
+			fake.Respond("PWRQSTN", tt.responses...)
+			if tt.pushed != "" {
+				messages, cancel := client.Subscribe()
+				fake.Push(tt.pushed)
+				<-messages
+				cancel()
+			}
+
+			status, body := request(t, server, http.MethodGet, "/power/")
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", status, tt.wantStatus, body)
+			}
+			if tt.wantBody != "" && body != tt.wantBody {
+				t.Fatalf("body = %q, want %q", body, tt.wantBody)
+			}
+			if sent := fake.Sent(); len(sent) != len(tt.wantSent) {
+				t.Fatalf("sent %q, want %q", sent, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestSendRaw(t *testing.T) {
+	tests := []struct {
+		name       string
+		message    string
+		wantStatus int
+		wantBody   string
+		wantSent   []string
+	}{
+		{"allowed", "MVLQSTN", http.StatusOK, `"message":"MVL1E"`, []string{"MVLQSTN"}},
+		{"allowed lowercase", "mvlQSTN", http.StatusOK, `"sent":"MVLQSTN"`, []string{"MVLQSTN"}},
+		{"not allowed", "PWR00", http.StatusForbidden, "not allowed", nil},
+		// The allowed prefix must not carry another message past the allowlist
+		{"second message after CR", "MVLQSTN\r!1PWR00", http.StatusBadRequest, "contains", nil},
+		{"second message after LF", "MVLQSTN\n!1PWR00", http.StatusBadRequest, "contains", nil},
+		{"second message after CR LF", "MVLQSTN\r\n!1PWR00", http.StatusBadRequest, "contains", nil},
+		{"second message without terminator", "MVLQSTN!1PWR00", http.StatusBadRequest, "contains", nil},
+		{"EOF terminator", "MVL1E\x1a", http.StatusBadRequest, "contains", nil},
+		{"too short", "MV", http.StatusBadRequest, "too short", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.RawCommands = []string{"MVL"}
+			server, fake, _ := newTestServer(t, config)
+			fake.Respond("MVLQSTN", "MVL1E")
+
+			status, body := request(t, server, http.MethodPut, "/raw?message="+url.QueryEscape(tt.message))
+			if status != tt.wantStatus || !strings.Contains(body, tt.wantBody) {
+				t.Fatalf("status %d %q, want %d with %q", status, body, tt.wantStatus, tt.wantBody)
+			}
+			if sent := fake.Sent(); strings.Join(sent, ",") != strings.Join(tt.wantSent, ",") {
+				t.Fatalf("sent %q, want %q", sent, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestSendRawDisabled(t *testing.T) {
+	server, fake, _ := newTestServer(t, DefaultConfig())
+	if status, _ := request(t, server, http.MethodPut, "/raw?message=MVLQSTN"); status != http.StatusForbidden {
+		t.Fatalf("status %d, want %d", status, http.StatusForbidden)
+	}
+	if sent := fake.Sent(); len(sent) != 0 {
+		t.Fatalf("sent %q", sent)
+	}
+}
@@ -12,20 +12,62 @@ import (
 	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
 )
 
+// Raw parameters longer than this are cut, NRI and jacket art run for kilobytes
+const maxChatParameter = 80
+
+// Formats the message with its catalog description, e.g. "MVL1E → master-volume: level 30"
+func annotate(message eiscp.Message) string {
+	text := message.String()
+	if len(message.Parameter) > maxChatParameter {
+		text = message.Command + message.Parameter[:maxChatParameter] + "…"
+	}
+	if description := eiscp.Describe(message); description != "" {
+		return fmt.Sprintf("%s → %s", text, description)
+	}
+	return text
+}
+
+// Prints every message the receiver sends above the prompt, as it arrives.
+// Ends the session when the connection closes before the session is done.
+func printIncoming(rl *readline.Instance, model string, messages <-chan eiscp.Message, done <-chan struct{}) {
+	for message := range messages {
+		fmt.Fprintf(rl.Stdout(), "%s: %s\n", model, annotate(message))
+	}
+	select {
+	case <-done:
+	default:
+		fmt.Fprintln(rl.Stdout(), "Connection closed.")
+		rl.Close()
+	}
+}
+
 // StartChatSession initiates an interactive chat session with the Onkyo device
 func StartChatSession(client *eiscp.EISCPClient) error {
-	fmt.Println("Chat session with Onkyo TX-L20D established.")
-	fmt.Println("Type EISCP commands or 'exit' to quit.")
+	model := client.Model().Name
+	fmt.Printf("Chat session with Onkyo %s established.\n", model)
+	fmt.Println("Type EISCP commands, 'help' for more or 'exit' to quit.")
+	fmt.Println("Everything the receiver sends is shown as it arrives.")
 	fmt.Println("Use Ctrl+C or Ctrl+D to terminate the session.")
-	fmt.Println("Use arrow up/down to navigate command history.")
+	fmt.Println("Use arrow up/down to navigate command history, Tab to complete.")
 
-	// Setup readline with history support
-	rl, err := readline.New("> ")
+	// Setup readline with persistent history and completion
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:                 "> ",
+		HistoryFile:            historyFile(),
+		DisableAutoSaveHistory: true,
+		AutoComplete:           chatCompleter{client: client},
+	})
 	if err != nil {
 		return fmt.Errorf("failed to initialize readline: %w", err)
 	}
 	defer rl.Close()
 
+	messages, cancel := client.Subscribe()
+	defer cancel()
+	done := make(chan struct{})
+	defer close(done)
+	go printIncoming(rl, model, messages, done)
+
 	// Setup signal handling for Ctrl+C
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -58,15 +100,17 @@ func StartChatSession(client *eiscp.EISCPClient) error {
 		// Add command to history
 		rl.SaveHistory(input)
 
-		// Send the command to the Onkyo device
-		response, err := client.SendReceiveCommand(input)
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
+		if handled, err := runMetaCommand(client, rl.Stdout(), input); handled {
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
 			continue
 		}
 
-		// Format and display the response
-		fmt.Printf("TX-L20D: %s\n", response)
+		// Responses show up with the rest of the incoming messages
+		if err := client.SendCommand(input); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
 	}
 
 	return nil
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+)
+
+type metaCommand struct {
+	usage       string
+	description string
+}
+
+// Friendly forms of the common commands, typed instead of raw messages
+var metaCommands = map[string]metaCommand{
+	"help":      {"help [CMD]", "describe the command, or list these"},
+	"power":     {"power [on|off]", "turn the receiver on or off, or query power"},
+	"volume":    {"volume [LEVEL|up|down]", "set, step or query the volume"},
+	"mute":      {"mute [on|off|toggle]", "set or query muting"},
+	"input":     {"input [NAME]", "select or query the input"},
+	"subwoofer": {"subwoofer [LEVEL|up|down]", "set, step or query the subwoofer level"},
+	"exit":      {"exit", "end the session"},
+}
+
+// Words completed after the meta command
+func metaArguments(client *eiscp.EISCPClient, command string) []string {
+	switch command {
+	case "help":
+		commands := make([]string, 0, len(eiscp.Catalog()))
+		for _, info := range eiscp.Catalog() {
+			commands = append(commands, info.Command)
+		}
+		return commands
+	case "power":
+		return []string{"on", "off"}
+	case "volume", "subwoofer":
+		return []string{"up", "down"}
+	case "mute":
+		return []string{"on", "off", "toggle"}
+	case "input":
+		return client.Inputs()
+	}
+	return nil
+}
+
+// Runs the line as a meta command, reporting false when it is a raw message
+func runMetaCommand(client *eiscp.EISCPClient, out io.Writer, line string) (bool, error) {
+	words := strings.Fields(line)
+	command := strings.ToLower(words[0])
+	if _, ok := metaCommands[command]; !ok || command == "exit" {
+		return false, nil
+	}
+	argument := ""
+	if len(words) > 1 {
+		argument = strings.ToLower(words[1])
+	}
+
+	switch command {
+	case "help":
+		if argument == "" {
+			printMetaHelp(out)
+			return true, nil
+		}
+		return true, printCommandHelp(out, argument)
+	case "power":
+		switch argument {
+		case "on":
+			return true, client.PowerOn()
+		case "off":
+			return true, client.PowerOff()
+		case "":
+			return true, client.SendMessage(eiscp.NewQuery("PWR"))
+		}
+	case "volume":
+		switch argument {
+		case "up":
+			return true, client.VolumeUp()
+		case "down":
+			return true, client.VolumeDown()
+		case "":
+			return true, client.SendMessage(eiscp.NewQuery("MVL"))
+		}
+		level, err := strconv.Atoi(argument)
+		if err != nil {
+			return true, fmt.Errorf("invalid volume level '%s'", argument)
+		}
+		return true, client.SetMasterVolume(level)
+	case "mute":
+		parameters := map[string]string{"on": "01", "off": "00", "toggle": "TG", "": eiscp.QueryParameter}
+		if parameter, ok := parameters[argument]; ok {
+			return true, client.SendMessage(eiscp.NewMessage("AMT", parameter))
+		}
+	case "input":
+		if argument == "" {
+			return true, client.SendMessage(eiscp.NewQuery("SLI"))
+		}
+		return true, client.SetInputSelector(resolveInput(argument))
+	case "subwoofer":
+		switch argument {
+		case "up":
+			return true, client.SubwooferUp()
+		case "down":
+			return true, client.SubwooferDown()
+		case "":
+			return true, client.SendMessage(eiscp.NewQuery("SWL"))
+		}
+		level, err := strconv.Atoi(argument)
+		if err != nil {
+			return true, fmt.Errorf("invalid subwoofer level '%s'", argument)
+		}
+		return true, client.SetSubwooferLevel(level)
+	}
+	return true, fmt.Errorf("usage: %s", metaCommands[command].usage)
+}
+
+func printMetaHelp(out io.Writer) {
+	names := make([]string, 0, len(metaCommands))
+	for name := range metaCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(out, "Type raw messages like MVL1E or MVLQSTN, or one of:")
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\t%s\n", metaCommands[name].usage, metaCommands[name].description)
+	}
+	w.Flush()
+	fmt.Fprintln(out, "Press Tab to complete commands and parameters.")
+}
+
+// Describes the command and its known parameters
+func printCommandHelp(out io.Writer, command string) error {
+	info, ok := eiscp.LookupCommand(command)
+	if !ok {
+		return fmt.Errorf("unknown command '%s', not in the catalog", strings.ToUpper(command))
+	}
+
+	fmt.Fprintf(out, "%s %s\n", info.Command, info.Name)
+	fmt.Fprintf(out, "  %s\n", info.Description)
+
+	parameters := make([]string, 0, len(info.Values))
+	for parameter := range info.Values {
+		parameters = append(parameters, parameter)
+	}
+	sort.Strings(parameters)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "  %s%s\t%s\n", info.Command, eiscp.QueryParameter, "query the current state")
+	for _, parameter := range parameters {
+		fmt.Fprintf(w, "  %s%s\t%s\n", info.Command, parameter, info.Values[parameter])
+	}
+	return w.Flush()
+}
+
+// Completes meta commands, three letter commands and their parameters from the catalog
+type chatCompleter struct {
+	client *eiscp.EISCPClient
+}
+
+func (c chatCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	text := strings.TrimLeft(string(line[:pos]), " ")
+	words := strings.Fields(text)
+	completingWord := len(text) == 0 || !strings.HasSuffix(text, " ")
+
+	switch {
+	case len(words) == 0 || (len(words) == 1 && completingWord):
+		prefix := ""
+		if len(words) == 1 {
+			prefix = words[0]
+		}
+		if len(prefix) >= 3 {
+			if info, ok := eiscp.LookupCommand(prefix[:3]); ok {
+				return completeParameters(info, prefix[3:])
+			}
+		}
+
+		var candidates []string
+		for name := range metaCommands {
+			candidates = append(candidates, name+" ")
+		}
+		for _, info := range eiscp.Catalog() {
+			candidates = append(candidates, info.Command)
+		}
+		return complete(candidates, prefix)
+	case len(words) == 1 || (len(words) == 2 && completingWord):
+		prefix := ""
+		if len(words) == 2 {
+			prefix = words[1]
+		}
+		return complete(metaArguments(c.client, strings.ToLower(words[0])), prefix)
+	}
+	return nil, 0
+}
+
+// Parameters follow the command without a space, e.g. "MVLQSTN"
+func completeParameters(info eiscp.CommandInfo, prefix string) ([][]rune, int) {
+	candidates := []string{eiscp.QueryParameter}
+	for parameter := range info.Values {
+		candidates = append(candidates, parameter)
+	}
+	return complete(candidates, prefix)
+}
+
+// Returns the rest of the candidates starting with the prefix, case insensitive, sorted
+func complete(candidates []string, prefix string) ([][]rune, int) {
+	sort.Strings(candidates)
+	var suffixes [][]rune
+	for _, candidate := range candidates {
+		if len(candidate) >= len(prefix) && strings.EqualFold(candidate[:len(prefix)], prefix) {
+			suffixes = append(suffixes, []rune(candidate[len(prefix):]))
+		}
+	}
+	return suffixes, len(prefix)
+}
+
+// History is kept across sessions in the user config directory, when there is one
+func historyFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	dir = filepath.Join(dir, "onkyo")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "chat_history")
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChatCompleter(t *testing.T) {
+	tests := []struct {
+		line       string
+		want       []string
+		wantLength int
+	}{
+		{"vol", []string{"ume "}, 3},
+		{"  pow", []string{"er "}, 3},
+		{"ex", []string{"it "}, 2},
+		{"MV", []string{"L"}, 2},
+		{"pw", []string{"3", "4", "R"}, 2},
+		{"xyz", nil, 3},
+		// Parameters follow the three letters without a space
+		{"mvl", []string{"DOWN", "DOWN1", "QSTN", "UP", "UP1"}, 0},
+		{"MVLU", []string{"P", "P1"}, 1},
+		{"pwrq", []string{"STN"}, 1},
+		{"power ", []string{"off", "on"}, 0},
+		{"power o", []string{"ff", "n"}, 1},
+		{"Mute T", []string{"oggle"}, 1},
+		{"volume ", []string{"down", "up"}, 0},
+		{"input ", []string{"am", "dab", "dj", "fm", "spotify", "tv", "vinyl"}, 0},
+		{"input v", []string{"inyl"}, 1},
+		{"help sl", []string{"3", "4", "A", "I", "P", "Z"}, 2},
+		{"exit ", nil, 0},
+		{"power on ", nil, 0},
+	}
+	client, _ := newTestClient(t)
+	completer := chatCompleter{client: client}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			line := []rune(tt.line)
+			suffixes, length := completer.Do(line, len(line))
+			var got []string
+			for _, suffix := range suffixes {
+				got = append(got, string(suffix))
+			}
+			if !reflect.DeepEqual(got, tt.want) || length != tt.wantLength {
+				t.Fatalf("Do(%q) = %q, %d, want %q, %d", tt.line, got, length, tt.want, tt.wantLength)
+			}
+		})
+	}
+}
+
+// Completion looks at the text before the cursor only
+func TestChatCompleterCursor(t *testing.T) {
+	client, _ := newTestClient(t)
+	line := []rune("vol 30")
+	suffixes, length := chatCompleter{client: client}.Do(line, 3)
+	if len(suffixes) != 1 || string(suffixes[0]) != "ume " || length != 3 {
+		t.Fatalf("Do at 3 = %q, %d, want ume", suffixes, length)
+	}
+}
+
+func TestRunMetaCommand(t *testing.T) {
+	tests := []struct {
+		line    string
+		handled bool
+		wantErr string
+		sent    []string
+	}{
+		{"power on", true, "", []string{"PWRQSTN", "PWR01"}},
+		{"power off", true, "", []string{"PWR00"}},
+		{"power", true, "", []string{"PWRQSTN"}},
+		{"power sideways", true, "usage: power [on|off]", nil},
+		{"volume up", true, "", []string{"MVLUP"}},
+		{"VOLUME DOWN", true, "", []string{"MVLDOWN"}},
+		{"volume 30", true, "", []string{"MVL1E"}},
+		{"volume", true, "", []string{"MVLQSTN"}},
+		{"volume loud", true, "invalid volume level 'loud'", nil},
+		{"mute on", true, "", []string{"AMT01"}},
+		{"mute off", true, "", []string{"AMT00"}},
+		{"mute toggle", true, "", []string{"AMTTG"}},
+		{"mute", true, "", []string{"AMTQSTN"}},
+		{"mute maybe", true, "usage: mute [on|off|toggle]", nil},
+		{"input vinyl", true, "", []string{"SLI22"}},
+		{"input turntable", true, "", []string{"SLI22"}},
+		{"input", true, "", []string{"SLIQSTN"}},
+		{"input laserdisc", true, "invalid input selector", nil},
+		{"subwoofer up", true, "", []string{"SWLUP"}},
+		{"subwoofer down", true, "", []string{"SWLDOWN"}},
+		{"subwoofer -4", true, "", []string{"SWL-04"}},
+		{"subwoofer", true, "", []string{"SWLQSTN"}},
+		{"subwoofer loud", true, "invalid subwoofer level 'loud'", nil},
+		{"help xyz", true, "unknown command 'XYZ'", nil},
+		// Left to the chat session
+		{"exit", false, "", nil},
+		{"MVL1E", false, "", nil},
+		{"volumeup", false, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			client, fake := newTestClient(t)
+			fake.Respond("PWRQSTN", "PWR00")
+			fake.Respond("PWR01", "PWR01")
+			previous := inputAliases
+			inputAliases = map[string]string{"turntable": "vinyl"}
+			t.Cleanup(func() { inputAliases = previous })
+
+			var out bytes.Buffer
+			handled, err := runMetaCommand(client, &out, tt.line)
+			if handled != tt.handled {
+				t.Fatalf("handled = %v, want %v", handled, tt.handled)
+			}
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			assertSentMessages(t, fake, tt.sent...)
+		})
+	}
+}
+
+func TestRunMetaCommandHelp(t *testing.T) {
+	client, fake := newTestClient(t)
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"help", []string{"Type raw messages", "volume [LEVEL|up|down]", "exit", "Press Tab"}},
+		{"help mvl", []string{"MVL master-volume", "Main zone volume", "MVLQSTN   query the current state", "MVLUP1    up 1 dB"}},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if handled, err := runMetaCommand(client, &out, tt.line); !handled || err != nil {
+			t.Fatalf("%q: handled %v, error %v", tt.line, handled, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("%q output misses %q:\n%s", tt.line, want, out.String())
+			}
+		}
+	}
+	assertSentMessages(t, fake)
+}
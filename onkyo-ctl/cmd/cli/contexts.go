@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+	"github.com/urfave/cli/v3"
+)
+
+// Transports a context connects with
+const (
+	TransportEISCP  = "eiscp"
+	TransportSerial = "serial"
+)
+
+// Context is a named receiver of the CLI config file, like a kubectl context
+type Context struct {
+	Host string `json:"host,omitempty"`
+	Port string `json:"port,omitempty"`
+	// eiscp over the network or serial, serial when only the device is given
+	Transport string `json:"transport,omitempty"`
+	Serial    string `json:"serial,omitempty"`
+	BaudRate  int    `json:"baudRate,omitempty"`
+	// Receiver model or family, detected when empty
+	Model string `json:"model,omitempty"`
+	// Zone power, volume and source commands control, main by default
+	Zone string `json:"zone,omitempty"`
+	// Own names of the inputs, e.g. "turntable": "vinyl"
+	Aliases map[string]string `json:"aliases,omitempty"`
+}
+
+func (c Context) transport() string {
+	if c.Transport == "" && c.Serial != "" {
+		return TransportSerial
+	}
+	if c.Transport == "" {
+		return TransportEISCP
+	}
+	return c.Transport
+}
+
+// Address shown in the context list
+func (c Context) address() string {
+	if c.transport() == TransportSerial {
+		return c.Serial
+	}
+	host, port := c.Host, c.Port
+	if port == "" {
+		port = "60128"
+	}
+	return host + ":" + port
+}
+
+func (c Context) validate() error {
+	switch c.transport() {
+	case TransportEISCP:
+		if c.Host == "" {
+			return fmt.Errorf("%w: host is required for the eiscp transport", eiscp.ErrValidation)
+		}
+	case TransportSerial:
+		if c.Serial == "" {
+			return fmt.Errorf("%w: serial device is required for the serial transport", eiscp.ErrValidation)
+		}
+	default:
+		return fmt.Errorf("%w: unknown transport '%s', expected eiscp or serial", eiscp.ErrValidation, c.Transport)
+	}
+	return validateZone(c.zone())
+}
+
+func (c Context) zone() string {
+	if c.Zone == "" {
+		return eiscp.MainZone
+	}
+	return c.Zone
+}
+
+// CLIConfig holds the contexts and the one used when --context is not given
+type CLIConfig struct {
+	CurrentContext string             `json:"currentContext,omitempty"`
+	Contexts       map[string]Context `json:"contexts"`
+}
+
+// Config file of the CLI, next to the chat history unless ONKYO_CLI_CONFIG says otherwise
+func cliConfigPath() (string, error) {
+	if path := os.Getenv("ONKYO_CLI_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find config directory: %w", err)
+	}
+	return filepath.Join(dir, "onkyo", "config.json"), nil
+}
+
+// Loads the CLI config, missing file means no contexts
+func LoadCLIConfig(path string) (CLIConfig, error) {
+	config := CLIConfig{Contexts: map[string]Context{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return config, fmt.Errorf("failed to read config: %w", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	if config.Contexts == nil {
+		config.Contexts = map[string]Context{}
+	}
+	return config, nil
+}
+
+func (c CLIConfig) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return nil
+}
+
+// Finds the named context, the current one when the name is empty.
+// No contexts configured at all gives the empty context.
+func (c CLIConfig) Resolve(name string) (string, Context, error) {
+	if name == "" {
+		name = c.CurrentContext
+	}
+	if name == "" {
+		return "", Context{}, nil
+	}
+	context, ok := c.Contexts[name]
+	if !ok {
+		return "", Context{}, fmt.Errorf("%w: context '%s' does not exist, see onkyo context list", eiscp.ErrValidation, name)
+	}
+	return name, context, nil
+}
+
+// Names of all contexts, sorted
+func (c CLIConfig) Names() []string {
+	names := make([]string, 0, len(c.Contexts))
+	for name := range c.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Connection of the selected context, with the flags and environment given explicitly
+// taking precedence over it
+func contextDialer(cmd *cli.Command, selected Context) eiscp.Dialer {
+	serial, baud := cmd.String("serial"), int(cmd.Int("baud"))
+	host, port := cmd.String("host"), cmd.String("port")
+
+	useSerial := serial != ""
+	if !cmd.IsSet("serial") && !cmd.IsSet("host") && selected.transport() == TransportSerial {
+		useSerial, serial = true, selected.Serial
+		if selected.BaudRate != 0 && !cmd.IsSet("baud") {
+			baud = selected.BaudRate
+		}
+	}
+	if useSerial {
+		return eiscp.SerialDialer{Device: serial, BaudRate: baud}
+	}
+
+	if !cmd.IsSet("host") && selected.Host != "" {
+		host = selected.Host
+	}
+	if !cmd.IsSet("port") && selected.Port != "" {
+		port = selected.Port
+	}
+	return eiscp.EISCPDialer{Host: host, Port: port}
+}
+
+// Model of the selected context, unless given by the flag or the environment.
+// Empty when the model is to be detected.
+func contextModel(cmd *cli.Command, selected Context) string {
+	if !cmd.IsSet("model") && selected.Model != "" {
+		return selected.Model
+	}
+	return cmd.String("model")
+}
+
+// Input aliases of the selected context
+var inputAliases map[string]string
+
+// Resolves the input alias of the context, other names are kept
+func resolveInput(name string) string {
+	if input, ok := inputAliases[strings.ToLower(name)]; ok {
+		return strings.ToLower(input)
+	}
+	return strings.ToLower(name)
+}
+
+// Context as printed by context list
+type contextOutput struct {
+	Name    string `json:"name"`
+	Current bool   `json:"current"`
+	Context
+}
+
+func loadContexts() (string, CLIConfig, error) {
+	path, err := cliConfigPath()
+	if err != nil {
+		return "", CLIConfig{}, err
+	}
+	config, err := LoadCLIConfig(path)
+	return path, config, err
+}
+
+func printContexts(config CLIConfig) error {
+	results := make([]contextOutput, 0, len(config.Contexts))
+	var table strings.Builder
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CURRENT\tNAME\tTRANSPORT\tADDRESS\tZONE\tMODEL")
+	for _, name := range config.Names() {
+		context := config.Contexts[name]
+		current := name == config.CurrentContext
+		results = append(results, contextOutput{Name: name, Current: current, Context: context})
+
+		marker, model := "", context.Model
+		if current {
+			marker = "*"
+		}
+		if model == "" {
+			model = "detected"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", marker, name, context.transport(), context.address(), context.zone(), model)
+	}
+	w.Flush()
+	return printResult(results, strings.Split(strings.TrimSuffix(table.String(), "\n"), "\n")...)
+}
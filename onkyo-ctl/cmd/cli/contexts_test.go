@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+	"github.com/urfave/cli/v3"
+)
+
+func TestLoadCLIConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    CLIConfig
+		wantErr bool
+	}{
+		{"missing file", "", CLIConfig{Contexts: map[string]Context{}}, false},
+		{
+			"contexts",
+			`{"currentContext": "den", "contexts": {"den": {"host": "192.168.1.20", "model": "TX-L20D", "aliases": {"turntable": "vinyl"}}}}`,
+			CLIConfig{CurrentContext: "den", Contexts: map[string]Context{
+				"den": {Host: "192.168.1.20", Model: "TX-L20D", Aliases: map[string]string{"turntable": "vinyl"}},
+			}},
+			false,
+		},
+		{"no contexts", `{"contexts": null}`, CLIConfig{Contexts: map[string]Context{}}, false},
+		{"invalid json", `{"contexts": [`, CLIConfig{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if tt.data != "" {
+				if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			config, err := LoadCLIConfig(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("config = %+v, want error", config)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(config, tt.want) {
+				t.Fatalf("config = %+v, want %+v", config, tt.want)
+			}
+		})
+	}
+}
+
+func TestCLIConfigSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "onkyo", "config.json")
+	want := CLIConfig{CurrentContext: "den", Contexts: map[string]Context{
+		"den":     {Host: "192.168.1.20", Zone: "zone2"},
+		"bedroom": {Serial: "/dev/ttyUSB0", BaudRate: 19200},
+	}}
+	if err := want.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadCLIConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("config = %+v, want %+v", got, want)
+	}
+}
+
+func TestCLIConfigResolve(t *testing.T) {
+	config := CLIConfig{CurrentContext: "den", Contexts: map[string]Context{
+		"den":     {Host: "192.168.1.20"},
+		"bedroom": {Host: "192.168.1.30"},
+	}}
+	if name, selected, err := config.Resolve(""); err != nil || name != "den" || selected.Host != "192.168.1.20" {
+		t.Fatalf("Resolve(\"\") = %s, %+v, %v, want the current context", name, selected, err)
+	}
+	if name, _, err := config.Resolve("bedroom"); err != nil || name != "bedroom" {
+		t.Fatalf("Resolve(bedroom) = %s, %v", name, err)
+	}
+	if _, _, err := config.Resolve("attic"); !errors.Is(err, eiscp.ErrValidation) {
+		t.Fatalf("Resolve(attic) error = %v, want ErrValidation", err)
+	}
+	if name, selected, err := (CLIConfig{}).Resolve(""); err != nil || name != "" || !reflect.DeepEqual(selected, Context{}) {
+		t.Fatalf("Resolve without contexts = %s, %+v, %v, want the empty context", name, selected, err)
+	}
+}
+
+// Parses the args with the flags of onkyo and hands the command over
+func parseFlags(t *testing.T, env map[string]string, args []string, check func(cmd *cli.Command)) {
+	t.Helper()
+	clearSettingsEnv(t)
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+
+	app := newApp()
+	app.Before, app.After, app.Commands = nil, nil, nil
+	app.Action = func(ctx context.Context, cmd *cli.Command) error {
+		check(cmd)
+		return nil
+	}
+	if err := app.Run(context.Background(), append([]string{"onkyo"}, args...)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Flags beat the environment, which beats the context, which beats the defaults
+func TestContextDialer(t *testing.T) {
+	network := Context{Host: "192.168.1.20", Port: "60129"}
+	serial := Context{Serial: "/dev/ttyUSB0", BaudRate: 19200}
+	tests := []struct {
+		name     string
+		selected Context
+		env      map[string]string
+		args     []string
+		want     eiscp.Dialer
+	}{
+		{"defaults", Context{}, nil, nil, eiscp.EISCPDialer{Host: "127.0.0.1", Port: "60128"}},
+		{"context", network, nil, nil, eiscp.EISCPDialer{Host: "192.168.1.20", Port: "60129"}},
+		{"context default port", Context{Host: "192.168.1.20"}, nil, nil, eiscp.EISCPDialer{Host: "192.168.1.20", Port: "60128"}},
+		{"flag beats context", network, nil, []string{"--host", "10.0.0.5"}, eiscp.EISCPDialer{Host: "10.0.0.5", Port: "60129"}},
+		{"env beats context", network, map[string]string{"ONKYO_PORT": "60130"}, nil, eiscp.EISCPDialer{Host: "192.168.1.20", Port: "60130"}},
+		{
+			"flag beats env", network, map[string]string{"ONKYO_HOST": "10.0.0.6"}, []string{"--host", "10.0.0.5"},
+			eiscp.EISCPDialer{Host: "10.0.0.5", Port: "60129"},
+		},
+		{"serial context", serial, nil, nil, eiscp.SerialDialer{Device: "/dev/ttyUSB0", BaudRate: 19200}},
+		{"baud flag beats serial context", serial, nil, []string{"--baud", "9600"}, eiscp.SerialDialer{Device: "/dev/ttyUSB0", BaudRate: 9600}},
+		{"host flag beats serial context", serial, nil, []string{"--host", "10.0.0.5"}, eiscp.EISCPDialer{Host: "10.0.0.5", Port: "60128"}},
+		{
+			"serial env beats network context", network, map[string]string{"ONKYO_SERIAL": "/dev/ttyS0"}, nil,
+			eiscp.SerialDialer{Device: "/dev/ttyS0", BaudRate: eiscp.DefaultBaudRate},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parseFlags(t, tt.env, tt.args, func(cmd *cli.Command) {
+				if got := contextDialer(cmd, tt.selected); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("dialer = %#v, want %#v", got, tt.want)
+				}
+			})
+		})
+	}
+}
+
+func TestContextModel(t *testing.T) {
+	pinned := Context{Host: "192.168.1.20", Model: "TX-L20D"}
+	tests := []struct {
+		name     string
+		selected Context
+		env      map[string]string
+		args     []string
+		want     string
+	}{
+		{"detected", Context{}, nil, nil, ""},
+		{"context", pinned, nil, nil, "TX-L20D"},
+		{"flag", Context{}, nil, []string{"--model", "TX-NR696"}, "TX-NR696"},
+		{"flag beats context", pinned, nil, []string{"-M", "TX-NR696"}, "TX-NR696"},
+		{"env beats context", pinned, map[string]string{"ONKYO_MODEL": "DTR-50.7"}, nil, "DTR-50.7"},
+		{"flag beats env", pinned, map[string]string{"ONKYO_MODEL": "DTR-50.7"}, []string{"--model", "TX-NR696"}, "TX-NR696"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parseFlags(t, tt.env, tt.args, func(cmd *cli.Command) {
+				if got := contextModel(cmd, tt.selected); got != tt.want {
+					t.Errorf("model = %q, want %q", got, tt.want)
+				}
+			})
+		})
+	}
+}
+
+// A model pinned by the context is shown as is, without asking the receiver
+func TestDeviceModelPinnedByContext(t *testing.T) {
+	dir := t.TempDir()
+	replay := filepath.Join(dir, "replay.jsonl")
+	if err := os.WriteFile(replay, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	record := filepath.Join(dir, "record.jsonl")
+	config := CLIConfig{CurrentContext: "den", Contexts: map[string]Context{
+		"den": {Host: "192.168.1.20", Model: "TX-L20D"},
+	}}
+
+	stdout, err := runApp(t, config, "--replay", replay, "--record", record, "-o", "json", "device", "model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout, `"TX-L20D"`) {
+		t.Fatalf("output = %s, want the TX-L20D model", stdout)
+	}
+	data, err := os.ReadFile(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0 {
+		t.Fatalf("recorded %s, want no traffic", data)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+)
+
+// Commands shown on the dashboard, queried when it starts and on refresh
+var dashboardQueries = []string{"PWR", "MVL", "SWL", "AMT", "SLI", "LMD", "NST", "NTI", "NAT", "NAL", "NTM"}
+
+// Dashboard keeps the latest state the receiver reported and turns key presses into commands.
+// It knows nothing about the terminal, so it can be driven by the fake receiver too.
+type dashboard struct {
+	client   *eiscp.EISCPClient
+	profiles []Profile
+
+	mu sync.Mutex
+	// Latest parameter of every command
+	state map[string]string
+	// Last action or error, shown above the keys
+	status string
+}
+
+func newDashboard(client *eiscp.EISCPClient, profiles []Profile) *dashboard {
+	return &dashboard{client: client, profiles: profiles, state: make(map[string]string)}
+}
+
+// Records the reported state, reporting whether anything shown changed
+func (d *dashboard) apply(message eiscp.Message) bool {
+	if message.Parameter == eiscp.QueryParameter {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.state[message.Command] == message.Parameter {
+		return false
+	}
+	d.state[message.Command] = message.Parameter
+	return true
+}
+
+func (d *dashboard) setStatus(status string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.status = status
+}
+
+// Queries everything shown, answers arrive as events
+func (d *dashboard) refresh() {
+	model := d.client.Model()
+	for _, command := range dashboardQueries {
+		if model.Supports(command) {
+			d.client.Enqueue(eiscp.NewQuery(command), eiscp.PriorityLow)
+		}
+	}
+}
+
+// Action bound to the key with its description, nil for keys doing nothing
+func (d *dashboard) keyAction(key string) (func() error, string) {
+	switch key {
+	case "up", "+", "=":
+		return d.client.VolumeUp, "Volume up"
+	case "down", "-":
+		return d.client.VolumeDown, "Volume down"
+	case "]", "right":
+		return d.client.SubwooferUp, "Subwoofer up"
+	case "[", "left":
+		return d.client.SubwooferDown, "Subwoofer down"
+	case "m":
+		return func() error { return d.client.SendMessage(eiscp.NewMessage("AMT", "TG")) }, "Mute toggled"
+	case "i":
+		return func() error { return d.client.SendMessage(eiscp.NewMessage("SLI", "UP")) }, "Next input"
+	case "I":
+		return func() error { return d.client.SendMessage(eiscp.NewMessage("SLI", "DOWN")) }, "Previous input"
+	case "p":
+		d.mu.Lock()
+		on := d.state["PWR"] == "01"
+		d.mu.Unlock()
+		if on {
+			return d.client.PowerOff, "Power off"
+		}
+		return d.client.PowerOn, "Power on"
+	case "r":
+		return func() error { d.refresh(); return nil }, "Refreshing"
+	}
+
+	if number, err := strconv.Atoi(key); err == nil && number >= 1 && number <= len(d.profiles) && number <= 9 {
+		profile := d.profiles[number-1]
+		return func() error { return d.applyProfile(profile) }, "Profile " + profile.Name
+	}
+	return nil, ""
+}
+
+// Same steps as the API takes, with the profile named after its input
+func (d *dashboard) applyProfile(profile Profile) error {
+	if err := d.client.PowerOn(); err != nil {
+		return err
+	}
+	if err := d.client.SetMasterVolume(profile.VolumeLevel); err != nil {
+		return err
+	}
+	if err := d.client.SetSubwooferLevel(profile.SubwooferLevel); err != nil {
+		return err
+	}
+	return d.client.SetInputSelector(profile.Name)
+}
+
+// Draws the dashboard as lines fitting the width
+func (d *dashboard) render(width int) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	model := d.client.Model()
+
+	power := "unknown"
+	switch d.state["PWR"] {
+	case "01":
+		power = "on"
+	case "00":
+		power = "standby"
+	}
+	lines := []string{
+		fmt.Sprintf(" Onkyo %s   power: %s", model.Name, power),
+		" " + strings.Repeat("─", clamp(width-2, 10, 60)),
+		fmt.Sprintf(" %-12s%s", "Input", d.input()),
+		fmt.Sprintf(" %-12s%s", "Mode", d.describe("LMD")),
+		fmt.Sprintf(" %-12s%s", "Volume", d.volume(model, clamp(width-36, 10, 40))),
+		fmt.Sprintf(" %-12s%s", "Subwoofer", d.subwoofer(model)),
+		fmt.Sprintf(" %-12s%s", "Mute", d.describe("AMT")),
+		"",
+		fmt.Sprintf(" %-12s%s", "Playing", d.playStatus()),
+		fmt.Sprintf(" %-12s%s", "Title", d.state["NTI"]),
+		fmt.Sprintf(" %-12s%s", "Artist", d.state["NAT"]),
+		fmt.Sprintf(" %-12s%s", "Album", d.state["NAL"]),
+		fmt.Sprintf(" %-12s%s", "Time", strings.Replace(d.state["NTM"], "/", " / ", 1)),
+		"",
+		" " + d.status,
+		" ↑↓ volume  [] subwoofer  m mute  i/I input  p power  r refresh  q quit",
+	}
+	if len(d.profiles) > 0 {
+		var keys []string
+		for i, profile := range d.profiles {
+			if i == 9 {
+				break
+			}
+			keys = append(keys, fmt.Sprintf("%d %s", i+1, profile.Name))
+		}
+		lines = append(lines, " "+strings.Join(keys, "  "))
+	}
+	return lines
+}
+
+// Catalog description of the reported value, "-" until reported
+func (d *dashboard) describe(command string) string {
+	parameter, ok := d.state[command]
+	if !ok {
+		return "-"
+	}
+	if info, found := eiscp.LookupCommand(command); found {
+		if description := info.DescribeParameter(parameter); description != "" {
+			return description
+		}
+	}
+	return parameter
+}
+
+func (d *dashboard) input() string {
+	code, ok := d.state["SLI"]
+	if !ok {
+		return "-"
+	}
+	if name, found := d.client.InputName(code); found {
+		return name
+	}
+	return d.describe("SLI")
+}
+
+func (d *dashboard) volume(model eiscp.Model, width int) string {
+	level, err := strconv.ParseInt(d.state["MVL"], 16, 64)
+	if err != nil {
+		return d.describe("MVL")
+	}
+	filled := 0
+	if model.MaxVolume > 0 {
+		filled = clamp(int(level)*width/model.MaxVolume, 0, width)
+	}
+	text := fmt.Sprintf("%s%s  %d/%d  %s", strings.Repeat("█", filled), strings.Repeat("░", width-filled),
+		level, model.MaxVolume, eiscp.FormatVolume(d.client.VolumeToUnit(int(level), eiscp.VolumeDB, model.MaxVolume), eiscp.VolumeDB))
+	if d.state["AMT"] == "01" {
+		text += "  muted"
+	}
+	return text
+}
+
+// Bar centered at 0 dB, filled towards the level
+func (d *dashboard) subwoofer(model eiscp.Model) string {
+	level, err := eiscp.ParseSubwooferLevel(d.state["SWL"])
+	if err != nil || model.SubwooferMax <= model.SubwooferMin {
+		return d.describe("SWL")
+	}
+	var bar strings.Builder
+	for step := model.SubwooferMin; step <= model.SubwooferMax; step++ {
+		switch {
+		case step == 0:
+			bar.WriteString("│")
+		case (step > 0 && step <= level) || (step < 0 && step >= level):
+			bar.WriteString("█")
+		default:
+			bar.WriteString("░")
+		}
+	}
+	return fmt.Sprintf("%s  %+d dB", bar.String(), level)
+}
+
+// Play status comes first in NST, followed by repeat and shuffle
+func (d *dashboard) playStatus() string {
+	status := d.state["NST"]
+	if status == "" {
+		return "-"
+	}
+	switch status[0] {
+	case 'P':
+		return "playing"
+	case 'p':
+		return "paused"
+	case 'S':
+		return "stopped"
+	case 'F':
+		return "fast forward"
+	case 'R':
+		return "rewind"
+	}
+	return status
+}
+
+func clamp(value, min, max int) int {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
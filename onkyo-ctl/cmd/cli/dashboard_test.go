@@ -0,0 +1,158 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp/eiscptest"
+)
+
+// Receiver answering every dashboard query
+func respondDashboard(fake *eiscptest.Transport) {
+	fake.Respond("PWRQSTN", "PWR01")
+	fake.Respond("MVLQSTN", "MVL1E")
+	fake.Respond("SWLQSTN", "SWL-02C")
+	fake.Respond("AMTQSTN", "AMT00")
+	fake.Respond("SLIQSTN", "SLI12")
+	fake.Respond("LMDQSTN", "LMD0C")
+	fake.Respond("NSTQSTN", "NSTP--")
+	fake.Respond("NTIQSTN", "NTIBlue in Green")
+	fake.Respond("NATQSTN", "NATMiles Davis")
+	fake.Respond("NALQSTN", "NALKind of Blue")
+	fake.Respond("NTMQSTN", "NTM01:02/05:37")
+}
+
+// Feeds the dashboard everything received until the render shows the line
+func waitRender(t *testing.T, d *dashboard, messages <-chan eiscp.Message, want string) []string {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		lines := d.render(80)
+		if strings.Contains(strings.Join(lines, "\n"), want) {
+			return lines
+		}
+		select {
+		case message := <-messages:
+			d.apply(message)
+		case <-timeout:
+			t.Fatalf("dashboard never showed %q:\n%s", want, strings.Join(lines, "\n"))
+		}
+	}
+}
+
+func TestDashboardRefresh(t *testing.T) {
+	client, fake := newTestClient(t)
+	respondDashboard(fake)
+	d := newDashboard(client, nil)
+	messages, cancel := client.Subscribe()
+	defer cancel()
+
+	before := strings.Join(d.render(80), "\n")
+	for _, want := range []string{"power: unknown", "Input       -", "Volume      -"} {
+		if !strings.Contains(before, want) {
+			t.Fatalf("before any state, %q missing:\n%s", want, before)
+		}
+	}
+
+	d.refresh()
+	lines := waitRender(t, d, messages, "05:37")
+	screen := strings.Join(lines, "\n")
+	for _, want := range []string{
+		"power: on",
+		"Input       tv",
+		"30/50",
+		// Center suffix of some models does not hide the level
+		"-2 dB",
+		"Playing     playing",
+		"Title       Blue in Green",
+		"Artist      Miles Davis",
+		"Album       Kind of Blue",
+		"Time        01:02 / 05:37",
+	} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("%q missing:\n%s", want, screen)
+		}
+	}
+	if !strings.Contains(screen, "░░░░░░██│░░░░░░░░") {
+		t.Errorf("subwoofer bar not filled towards -2:\n%s", screen)
+	}
+	if len(fake.Sent()) != len(dashboardQueries) {
+		t.Errorf("sent %q, want one query per dashboard command", fake.Sent())
+	}
+}
+
+func TestDashboardFollowsReceiver(t *testing.T) {
+	client, fake := newTestClient(t)
+	d := newDashboard(client, nil)
+	messages, cancel := client.Subscribe()
+	defer cancel()
+
+	// Changes made with the remote show up without asking
+	fake.Push("MVL28", "AMT01", "SWL+03", "NSTp--")
+	screen := strings.Join(waitRender(t, d, messages, "paused"), "\n")
+	for _, want := range []string{"40/50", "muted", "+3 dB"} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("%q missing:\n%s", want, screen)
+		}
+	}
+
+	if d.apply(eiscp.NewMessage("MVL", "28")) {
+		t.Error("unchanged volume reported as a change")
+	}
+	if d.apply(eiscp.NewQuery("MVL")) {
+		t.Error("query echo reported as a change")
+	}
+}
+
+func TestDashboardKeys(t *testing.T) {
+	profiles := []Profile{{Name: "tv", VolumeLevel: 22, SubwooferLevel: -1, MaxVolume: 28}}
+	tests := []struct {
+		key         string
+		power       string
+		description string
+		sent        []string
+	}{
+		{"up", "", "Volume up", []string{"MVLUP"}},
+		{"-", "", "Volume down", []string{"MVLDOWN"}},
+		{"]", "", "Subwoofer up", []string{"SWLUP"}},
+		{"left", "", "Subwoofer down", []string{"SWLDOWN"}},
+		{"m", "", "Mute toggled", []string{"AMTTG"}},
+		{"i", "", "Next input", []string{"SLIUP"}},
+		{"I", "", "Previous input", []string{"SLIDOWN"}},
+		{"p", "01", "Power off", []string{"PWR00"}},
+		{"p", "00", "Power on", []string{"PWR01"}},
+		{"1", "01", "Profile tv", []string{"MVL16", "SWL-01", "SLI12"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			client, fake := newTestClient(t)
+			fake.Respond("PWR01", "PWR01")
+			d := newDashboard(client, profiles)
+			if tt.power != "" {
+				messages, cancel := client.Subscribe()
+				fake.Push("PWR" + tt.power)
+				d.apply(<-messages)
+				cancel()
+			}
+
+			action, description := d.keyAction(tt.key)
+			if action == nil || description != tt.description {
+				t.Fatalf("key %q = %q, want %q", tt.key, description, tt.description)
+			}
+			if err := action(); err != nil {
+				t.Fatal(err)
+			}
+			assertSentMessages(t, fake, tt.sent...)
+		})
+	}
+
+	client, _ := newTestClient(t)
+	d := newDashboard(client, profiles)
+	for _, key := range []string{"x", "2", "0"} {
+		if action, _ := d.keyAction(key); action != nil {
+			t.Errorf("key %q has an action", key)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/capture"
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+)
+
+// Message found in the capture, with where it came from when known
+type decodedMessage struct {
+	time    time.Time
+	route   string
+	message eiscp.Message
+	err     error
+}
+
+// Totals printed after the messages
+type decodeSummary struct {
+	streams int
+	skipped int
+	gaps    int
+}
+
+// Decodes a pcap or pcapng capture, or a hex dump of the eISCP stream, printing
+// every message with its catalog name. Only TCP streams to or from the port are decoded.
+func Decode(input io.Reader, port uint16, unknownOnly bool) error {
+	reader := bufio.NewReader(input)
+	header, _ := reader.Peek(4)
+
+	var messages []decodedMessage
+	var summary decodeSummary
+	var err error
+	if capture.IsPcap(header) {
+		messages, summary, err = decodePcap(reader, port)
+	} else {
+		messages, summary, err = decodeHexDump(reader)
+	}
+	if err != nil {
+		return err
+	}
+
+	if unknownOnly {
+		known := messages[:0]
+		for _, decoded := range messages {
+			if _, ok := eiscp.LookupCommand(decoded.message.Command); !ok || decoded.err != nil {
+				known = append(known, decoded)
+			}
+		}
+		messages = known
+	}
+	if output != OutputText {
+		if err := printDecoded(messages); err != nil {
+			return err
+		}
+		printDecodeSummary(len(messages), summary)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, decoded := range messages {
+		var columns []string
+		if !decoded.time.IsZero() {
+			columns = append(columns, decoded.time.Format("15:04:05.000"))
+		}
+		if decoded.route != "" {
+			columns = append(columns, decoded.route)
+		}
+		description := eiscp.Describe(decoded.message)
+		if decoded.err != nil {
+			description = decoded.err.Error()
+		} else if description == "" {
+			description = "unknown command"
+		}
+		columns = append(columns, formatFrame(decoded.message), description)
+		fmt.Fprintln(w, strings.Join(columns, "\t"))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	printDecodeSummary(len(messages), summary)
+	return nil
+}
+
+// Message as printed in JSON and YAML output
+type decodedOutput struct {
+	Time  string `json:"time,omitempty"`
+	Route string `json:"route,omitempty"`
+	messageOutput
+	Error string `json:"error,omitempty"`
+}
+
+func printDecoded(messages []decodedMessage) error {
+	results := make([]decodedOutput, 0, len(messages))
+	for _, decoded := range messages {
+		result := decodedOutput{Route: decoded.route, messageOutput: newMessageOutput(decoded.message)}
+		if !decoded.time.IsZero() {
+			result.Time = decoded.time.Format(time.RFC3339Nano)
+		}
+		if decoded.err != nil {
+			result.Error = decoded.err.Error()
+		}
+		results = append(results, result)
+	}
+	return printResult(results)
+}
+
+// Totals go to stderr, keeping the output clean for pipes
+func printDecodeSummary(count int, summary decodeSummary) {
+	fmt.Fprintf(os.Stderr, "%d messages in %d streams", count, summary.streams)
+	if summary.skipped > 0 {
+		fmt.Fprintf(os.Stderr, ", %d bytes not decoded", summary.skipped)
+	}
+	if summary.gaps > 0 {
+		fmt.Fprintf(os.Stderr, ", %d gaps in the capture", summary.gaps)
+	}
+	fmt.Fprintln(os.Stderr)
+}
+
+// Bare form, with the unit type when the message is not for the receiver
+func formatFrame(message eiscp.Message) string {
+	if message.UnitType != eiscp.UnitReceiver && message.UnitType != 0 {
+		return fmt.Sprintf("[%c] %s", message.UnitType, message)
+	}
+	return message.String()
+}
+
+func decodePcap(r io.Reader, port uint16) ([]decodedMessage, decodeSummary, error) {
+	var summary decodeSummary
+	packets, err := capture.ReadPackets(r)
+	if err != nil && len(packets) == 0 {
+		return nil, summary, err
+	}
+	if err != nil {
+		// Captures cut off by stopping tcpdump are still worth decoding
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	var segments []capture.Segment
+	for _, packet := range packets {
+		if segment, ok := capture.DecodeSegment(packet); ok {
+			segments = append(segments, segment)
+		}
+	}
+
+	var messages []decodedMessage
+	streams := capture.Reassemble(segments, port)
+	for _, stream := range streams {
+		found, skipped := eiscp.ScanEISCPStream(stream.Data)
+		summary.skipped += skipped
+		summary.gaps += stream.Gaps
+		for _, message := range found {
+			messages = append(messages, decodedMessage{
+				// Messages are complete once their last byte arrives
+				time:    stream.TimeAt(message.Offset + message.Length - 1),
+				route:   fmt.Sprintf("%s > %s", stream.Src, stream.Dst),
+				message: message.Message,
+				err:     message.Err,
+			})
+		}
+	}
+	summary.streams = len(streams)
+
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].time.Before(messages[j].time)
+	})
+	return messages, summary, nil
+}
+
+func decodeHexDump(r io.Reader) ([]decodedMessage, decodeSummary, error) {
+	data, err := capture.ParseHexDump(r)
+	if err != nil {
+		return nil, decodeSummary{}, err
+	}
+
+	found, skipped := eiscp.ScanEISCPStream(data)
+	messages := make([]decodedMessage, 0, len(found))
+	for _, message := range found {
+		messages = append(messages, decodedMessage{message: message.Message, err: message.Err})
+	}
+	return messages, decodeSummary{streams: 1, skipped: skipped}, nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func openKeyboard() (*os.File, func(), error) {
+	return nil, nil, errors.New("the dashboard is not supported on this platform")
+}
@@ -0,0 +1,30 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Opens stdin for reading keys in a way closing interrupts a pending read.
+// The copy is non-blocking so the runtime poller waits for it instead of a stuck read call.
+func openKeyboard() (*os.File, func(), error) {
+	stdin := int(os.Stdin.Fd())
+	fd, err := unix.Dup(stdin)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open keyboard: %w", err)
+	}
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, nil, fmt.Errorf("failed to open keyboard: %w", err)
+	}
+	keyboard := os.NewFile(uintptr(fd), "keyboard")
+	return keyboard, func() {
+		keyboard.Close()
+		// The flag is shared with stdin, the shell expects it blocking again
+		unix.SetNonblock(stdin, false)
+	}, nil
+}
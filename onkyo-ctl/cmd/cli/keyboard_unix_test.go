@@ -0,0 +1,55 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestKeyboardCloseInterruptsRead(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+
+	keyboard, closeKeyboard, err := openKeyboard()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make(chan string)
+	go readKeys(context.Background(), keyboard, keys)
+
+	w.WriteString("q")
+	if key := <-keys; key != "q" {
+		t.Fatalf("key %q, want q", key)
+	}
+
+	// Nothing more is typed, closing alone ends the reader
+	closeKeyboard()
+	select {
+	case _, ok := <-keys:
+		if ok {
+			t.Fatal("key read after close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reader still blocked after close")
+	}
+
+	flags, err := unix.FcntlInt(r.Fd(), unix.F_GETFL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags&unix.O_NONBLOCK != 0 {
+		t.Fatal("stdin left non-blocking")
+	}
+}
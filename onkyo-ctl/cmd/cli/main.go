@@ -2,23 +2,132 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/chzyer/readline"
 	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
 	"github.com/urfave/cli/v3"
 )
 
 var client *eiscp.EISCPClient
 
-func main() {
-	cmd := &cli.Command{
+// Dialer of the global connection, kept to reconnect with recording
+var dialer eiscp.Dialer
+
+// Recording file given with --record, closed after the command
+var recording *os.File
+
+// Opens the file recording traffic of the whole session
+func startRecording(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	return file, nil
+}
+
+// Commands working without the receiver, no connection is made for them
+var offlineCommands = map[string]bool{
+	"decode":  true,
+	"context": true,
+}
+
+// Plays the recorded session back instead of talking to a receiver.
+// Every connection gets its own replay from the start, e.g. when record reconnects.
+func loadReplay(path string) (eiscp.Dialer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replay: %w", err)
+	}
+	defer file.Close()
+
+	frames, err := eiscp.ReadRecording(file)
+	if err != nil {
+		return nil, err
+	}
+	return eiscp.ReplayDialer{Frames: frames}, nil
+}
+
+// Whether the device info was asked for in this session already
+var deviceInfoLoaded bool
+
+// Refines input names, limits and zones with what the device reports, once per session.
+// Models not answering NRI, e.g. over serial, keep the defaults and say so.
+func loadDeviceInfo() {
+	if deviceInfoLoaded {
+		return
+	}
+	deviceInfoLoaded = true
+	if _, err := client.QueryDeviceInfo(); err != nil {
+		fmt.Fprintf(os.Stderr, "Device info not available, using %s defaults: %v\n", client.Model().Name, err)
+	}
+}
+
+// Limits of pinned models are known without asking the device
+func loadLimits() {
+	if !client.ModelPinned() {
+		loadDeviceInfo()
+	}
+}
+
+// Arguments not matching the usage exit with the validation error code
+func usageError(usage string) error {
+	return fmt.Errorf("%w: usage: %s", eiscp.ErrValidation, usage)
+}
+
+func invalidArgument(name string, err error) error {
+	return fmt.Errorf("%w: invalid %s: %v", eiscp.ErrValidation, name, err)
+}
+
+func newVolumeUnitFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "unit",
+		Usage: "Volume unit (raw, db, pct of the profile max volume)",
+		Value: string(eiscp.VolumeRaw),
+	}
+}
+
+// Parses the level argument given in --unit into raw volume steps
+func parseVolumeLevel(cmd *cli.Command) (int, error) {
+	unit, err := eiscp.ParseVolumeUnit(cmd.String("unit"))
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseFloat(cmd.Args().First(), 64)
+	if err != nil {
+		return 0, invalidArgument("volume level", err)
+	}
+	loadLimits()
+	maxVolume := 0
+	if unit == eiscp.VolumePercent {
+		profiles, err := loadProfiles(cmd.String("config"))
+		if err != nil {
+			return 0, err
+		}
+		maxVolume = percentReference(profiles)
+	}
+	return client.VolumeFromUnit(value, unit, maxVolume)
+}
+
+// The onkyo command with all its subcommands
+func newApp() *cli.Command {
+	return &cli.Command{
 		Name:  "onkyo",
-		Usage: "Onkyo TX-L20D client",
+		Usage: "Onkyo receiver client",
 		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "context",
+				Aliases: []string{"c"},
+				Usage:   "Named receiver of the CLI config file, the current one by default",
+				Sources: cli.EnvVars("ONKYO_CONTEXT"),
+			},
 			&cli.StringFlag{
 				Name:    "host",
 				Aliases: []string{"H"},
@@ -33,33 +142,367 @@ func main() {
 				Value:   "60128",
 				Sources: cli.EnvVars("ONKYO_PORT"),
 			},
+			&cli.StringFlag{
+				Name:    "serial",
+				Usage:   "Serial device to use instead of the network, e.g. /dev/ttyUSB0",
+				Sources: cli.EnvVars("ONKYO_SERIAL"),
+			},
+			&cli.IntFlag{
+				Name:    "baud",
+				Usage:   "Serial port baud rate",
+				Value:   eiscp.DefaultBaudRate,
+				Sources: cli.EnvVars("ONKYO_BAUD"),
+			},
+			&cli.StringFlag{
+				Name:    "model",
+				Aliases: []string{"M"},
+				Usage:   "Receiver model or family, detected when not given",
+				Sources: cli.EnvVars("ONKYO_MODEL"),
+			},
+			&cli.StringFlag{
+				Name:    "zone",
+				Usage:   "Zone power, volume and source commands control (main, zone2, zone3, zone4)",
+				Sources: cli.EnvVars("ONKYO_ZONE"),
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "Output format (text, json, yaml)",
+				Value:   string(OutputText),
+				Sources: cli.EnvVars("ONKYO_OUTPUT"),
+			},
+			&cli.StringFlag{
+				Name:    "config",
+				Usage:   "API config file with the profiles, for percent volumes and the dashboard",
+				Sources: cli.EnvVars("ONKYO_CONFIG"),
+			},
+			&cli.StringFlag{
+				Name:  "record",
+				Usage: "Append all sent and received messages to the JSONL file",
+			},
+			&cli.StringFlag{
+				Name:  "replay",
+				Usage: "Play the recorded JSONL session back instead of connecting to the receiver",
+			},
 		},
 		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
-			var err error
-			host := cmd.String("host")
-			port := cmd.String("port")
+			format, err := ParseOutputFormat(cmd.String("output"))
+			if err != nil {
+				return nil, err
+			}
+			output = format
+			if offlineCommands[cmd.Args().First()] {
+				return nil, nil
+			}
 
-			client, err = eiscp.NewEISCPClient(host, port)
+			path, err := cliConfigPath()
+			if err != nil {
+				return nil, err
+			}
+			config, err := LoadCLIConfig(path)
+			if err != nil {
+				return nil, err
+			}
+			_, selected, err := config.Resolve(cmd.String("context"))
+			if err != nil {
+				return nil, err
+			}
+			zone = selected.zone()
+			if cmd.IsSet("zone") {
+				zone = cmd.String("zone")
+			}
+			if err := validateZone(zone); err != nil {
+				return nil, err
+			}
+			inputAliases = make(map[string]string, len(selected.Aliases))
+			for alias, input := range selected.Aliases {
+				inputAliases[strings.ToLower(alias)] = input
+			}
+
+			dialer = contextDialer(cmd, selected)
+			if replay := cmd.String("replay"); replay != "" {
+				if dialer, err = loadReplay(replay); err != nil {
+					return nil, err
+				}
+			}
+			if path := cmd.String("record"); path != "" {
+				if recording, err = startRecording(path); err != nil {
+					return nil, err
+				}
+				dialer = eiscp.RecordingDialer{Dialer: dialer, Writer: recording}
+			}
+
+			client, err = eiscp.Dial(dialer)
 			if err != nil {
 				return nil, fmt.Errorf("error connecting to server: %w", err)
 			}
+			if model := contextModel(cmd, selected); model != "" {
+				if err := client.SetModel(model); err != nil {
+					return nil, err
+				}
+			}
 			return nil, nil
 		},
 		After: func(ctx context.Context, cmd *cli.Command) error {
-			if client != nil && client.Conn != nil {
-				return client.Conn.Close()
+			var err error
+			if client != nil {
+				err = client.Close()
+			}
+			if recording != nil {
+				recording.Close()
 			}
-			return nil
+			return err
 		},
 		EnableShellCompletion: true,
 		Commands: []*cli.Command{
 			{
 				Name:  "chat",
 				Usage: "Chat with onkyo using raw eiscp messages",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "script",
+						Usage: "Run the ISCP script non-interactively, - for stdin (default when stdin is not a terminal)",
+					},
+				},
 				Action: func(ctx context.Context, cmd *cli.Command) error {
+					path := cmd.String("script")
+					if path == "" && readline.IsTerminal(int(os.Stdin.Fd())) {
+						return StartChatSession(client)
+					}
+					if path == "" || path == "-" {
+						return RunScript(client, "stdin", os.Stdin, os.Stdout)
+					}
+					file, err := os.Open(path)
+					if err != nil {
+						return fmt.Errorf("failed to open script: %w", err)
+					}
+					defer file.Close()
+					return RunScript(client, path, file, os.Stdout)
+				},
+			},
+			{
+				Name:      "send",
+				Usage:     "Send raw eiscp message, e.g. MVLQSTN, and print the responses",
+				ArgsUsage: "<message>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "wait",
+						Usage: "Wait for the response to the same command",
+					},
+					&cli.StringFlag{
+						Name:  "expect",
+						Usage: "Wait for the response starting with the prefix, e.g. MVL or PWR01",
+					},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Usage: "How long to wait for the response",
+						Value: eiscp.DefaultTimeout,
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					if cmd.Args().Len() != 1 {
+						return usageError("send <message>, e.g. onkyo send MVLQSTN")
+					}
+					return Send(client, cmd.Args().First(), cmd.Bool("wait"), cmd.String("expect"), cmd.Duration("timeout"))
+				},
+			},
+			{
+				Name:  "watch",
+				Usage: "Print state changes the receiver reports until interrupted",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:  "only",
+						Usage: "Watch only the groups or commands, e.g. power,volume,SLI (" + strings.Join(watchGroupNames(), ", ") + ")",
+					},
+					&cli.BoolFlag{
+						Name:  "all",
+						Usage: "Show repeated reports of unchanged values too",
+					},
+					&cli.BoolFlag{
+						Name:  "table",
+						Usage: "Show the latest values in a table updated in place",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					watched, err := parseWatchFilter(cmd.StringSlice("only"))
+					if err != nil {
+						return err
+					}
+					ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+					defer stop()
+					return Watch(ctx, client, os.Stdout, watched, cmd.Bool("all"), cmd.Bool("table"))
+				},
+			},
+			{
+				Name:  "tui",
+				Usage: "Show full-screen dashboard updated live, with keys for volume, subwoofer, input and power",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					profiles, err := loadProfiles(cmd.String("config"))
+					if err != nil {
+						return err
+					}
+					loadDeviceInfo()
+					ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+					defer stop()
+					return RunDashboard(ctx, client, profiles)
+				},
+			},
+			{
+				Name:      "decode",
+				Usage:     "Decode eISCP messages from a pcap capture or hex dump, stdin by default",
+				ArgsUsage: "[file]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "unknown",
+						Usage: "Show only commands missing from the catalog",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					port, err := strconv.ParseUint(cmd.String("port"), 10, 16)
+					if err != nil {
+						return invalidArgument("port", err)
+					}
+
+					input := os.Stdin
+					if path := cmd.Args().First(); path != "" && path != "-" {
+						file, err := os.Open(path)
+						if err != nil {
+							return fmt.Errorf("failed to open capture: %w", err)
+						}
+						defer file.Close()
+						input = file
+					}
+					return Decode(input, uint16(port), cmd.Bool("unknown"))
+				},
+			},
+			{
+				Name:      "record",
+				Usage:     "Chat with onkyo, recording the whole session to JSONL file for bug reports",
+				ArgsUsage: "[file]",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					path := cmd.Args().First()
+					if path == "" {
+						path = fmt.Sprintf("onkyo-%s.jsonl", time.Now().Format("20060102-150405"))
+					}
+					file, err := startRecording(path)
+					if err != nil {
+						return err
+					}
+					defer file.Close()
+
+					// Reconnect, so messages the receiver sends on connect are recorded too
+					client.Close()
+					client, err = eiscp.Dial(eiscp.RecordingDialer{Dialer: dialer, Writer: file})
+					if err != nil {
+						return fmt.Errorf("error connecting to server: %w", err)
+					}
+					fmt.Printf("Recording to %s, replay with: onkyo --replay %s chat\n", path, path)
 					return StartChatSession(client)
 				},
 			},
+			{
+				Name:  "context",
+				Usage: "Manage named receivers of the CLI config file",
+				Commands: []*cli.Command{
+					{
+						Name:  "list",
+						Usage: "List contexts, the current one marked with *",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							path, config, err := loadContexts()
+							if err != nil {
+								return err
+							}
+							if len(config.Contexts) == 0 && output == OutputText {
+								fmt.Fprintf(os.Stderr, "No contexts in %s, add one with onkyo context add\n", path)
+								return nil
+							}
+							return printContexts(config)
+						},
+					},
+					{
+						Name:      "use",
+						Usage:     "Make the context current",
+						ArgsUsage: "<name>",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							if cmd.Args().Len() != 1 {
+								return usageError("context use <name>")
+							}
+							path, config, err := loadContexts()
+							if err != nil {
+								return err
+							}
+							name, _, err := config.Resolve(cmd.Args().First())
+							if err != nil {
+								return err
+							}
+							config.CurrentContext = name
+							if err := config.Save(path); err != nil {
+								return err
+							}
+							fmt.Fprintf(os.Stderr, "Switched to context %s\n", name)
+							return printDone(cmd, nil)
+						},
+					},
+					{
+						Name:      "add",
+						Usage:     "Add or replace the context, the first one added becomes current",
+						ArgsUsage: "<name>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{Name: "host", Usage: "Receiver ip address or host name"},
+							&cli.StringFlag{Name: "port", Usage: "Receiver port, 60128 by default"},
+							&cli.StringFlag{Name: "transport", Usage: "eiscp or serial, serial when only --serial is given"},
+							&cli.StringFlag{Name: "serial", Usage: "Serial device, e.g. /dev/ttyUSB0"},
+							&cli.IntFlag{Name: "baud", Usage: "Serial port baud rate"},
+							&cli.StringFlag{Name: "model", Usage: "Receiver model or family, detected when not given"},
+							&cli.StringFlag{Name: "zone", Usage: "Zone controlled by default (main, zone2, zone3, zone4)"},
+							&cli.StringSliceFlag{Name: "alias", Usage: "Own name of an input, e.g. turntable=vinyl"},
+							&cli.BoolFlag{Name: "use", Usage: "Make the context current"},
+						},
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							if cmd.Args().Len() != 1 {
+								return usageError("context add <name> --host <address>")
+							}
+							added := Context{
+								Host:      cmd.String("host"),
+								Port:      cmd.String("port"),
+								Transport: cmd.String("transport"),
+								Serial:    cmd.String("serial"),
+								BaudRate:  int(cmd.Int("baud")),
+								Model:     cmd.String("model"),
+								Zone:      cmd.String("zone"),
+							}
+							for _, alias := range cmd.StringSlice("alias") {
+								name, input, ok := strings.Cut(alias, "=")
+								if !ok || name == "" || input == "" {
+									return fmt.Errorf("%w: invalid alias '%s', expected name=input", eiscp.ErrValidation, alias)
+								}
+								if added.Aliases == nil {
+									added.Aliases = make(map[string]string)
+								}
+								added.Aliases[strings.ToLower(name)] = strings.ToLower(input)
+							}
+							if err := added.validate(); err != nil {
+								return err
+							}
+
+							path, config, err := loadContexts()
+							if err != nil {
+								return err
+							}
+							name := cmd.Args().First()
+							config.Contexts[name] = added
+							if config.CurrentContext == "" || cmd.Bool("use") {
+								config.CurrentContext = name
+							}
+							if err := config.Save(path); err != nil {
+								return err
+							}
+							fmt.Fprintf(os.Stderr, "Context %s saved to %s\n", name, path)
+							return printDone(cmd, nil)
+						},
+					},
+				},
+			},
 			{
 				Name:  "power",
 				Usage: "Control device power",
@@ -68,14 +511,14 @@ func main() {
 						Name:  "on",
 						Usage: "Turn device on",
 						Action: func(ctx context.Context, cmd *cli.Command) error {
-							return client.PowerOn()
+							return printDone(cmd, zonePower(true))
 						},
 					},
 					{
 						Name:  "off",
 						Usage: "Turn device off",
 						Action: func(ctx context.Context, cmd *cli.Command) error {
-							return client.PowerOff()
+							return printDone(cmd, zonePower(false))
 						},
 					},
 				},
@@ -87,38 +530,97 @@ func main() {
 					{
 						Name:  "query",
 						Usage: "Query current volume level",
+						Flags: []cli.Flag{newVolumeUnitFlag()},
 						Action: func(ctx context.Context, cmd *cli.Command) error {
-							result, err := client.QueryVolume()
-							fmt.Print(result)
-							return err
+							unit, err := eiscp.ParseVolumeUnit(cmd.String("unit"))
+							if err != nil {
+								return err
+							}
+							result, err := zoneQueryVolume()
+							if err != nil {
+								return err
+							}
+							value := float64(result)
+							if unit != eiscp.VolumeRaw {
+								loadLimits()
+								maxVolume := 0
+								if unit == eiscp.VolumePercent {
+									profiles, err := loadProfiles(cmd.String("config"))
+									if err != nil {
+										return err
+									}
+									maxVolume = percentReference(profiles)
+								}
+								value = client.VolumeToUnit(result, unit, maxVolume)
+							}
+							return printResult(volumeOutput{Level: result, Value: value, Unit: unit}, eiscp.FormatVolume(value, unit))
 						},
 					},
 					{
 						Name:  "set",
 						Usage: "Set volume level",
+						Flags: []cli.Flag{newVolumeUnitFlag()},
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							if cmd.Args().Len() != 1 {
-								return fmt.Errorf("usage: volume set <level>")
+								return usageError("volume set <level>")
 							}
-							level, err := strconv.Atoi(cmd.Args().First())
+							level, err := parseVolumeLevel(cmd)
+							if err != nil {
+								return err
+							}
+							return printDone(cmd, zoneSetVolume(level))
+						},
+					},
+					{
+						Name:  "fade",
+						Usage: "Gradually change volume level",
+						Flags: []cli.Flag{
+							&cli.DurationFlag{
+								Name:  "over",
+								Usage: "Fade duration",
+								Value: 10 * time.Second,
+							},
+							&cli.StringFlag{
+								Name:  "curve",
+								Usage: "Fade curve (linear, ease-in, ease-out, s-curve)",
+								Value: string(eiscp.FadeLinear),
+							},
+							newVolumeUnitFlag(),
+						},
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							if cmd.Args().Len() != 1 {
+								return usageError("volume fade <level> [--over duration]")
+							}
+							if zone != eiscp.MainZone {
+								return fmt.Errorf("%w: fades only work in the main zone", eiscp.ErrValidation)
+							}
+							level, err := parseVolumeLevel(cmd)
 							if err != nil {
-								return fmt.Errorf("invalid volume level: %w", err)
+								return err
 							}
-							return client.SetMasterVolume(level)
+
+							// Ctrl+C stops the fade where it is
+							ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+							defer stop()
+							err = client.FadeVolume(ctx, level, cmd.Duration("over"), eiscp.FadeCurve(cmd.String("curve")))
+							if errors.Is(err, context.Canceled) {
+								err = nil
+							}
+							return printDone(cmd, err)
 						},
 					},
 					{
 						Name:  "up",
 						Usage: "Increase volume",
 						Action: func(ctx context.Context, cmd *cli.Command) error {
-							return client.VolumeUp()
+							return printDone(cmd, zoneVolumeStep(true))
 						},
 					},
 					{
 						Name:  "down",
 						Usage: "Decrease volume",
 						Action: func(ctx context.Context, cmd *cli.Command) error {
-							return client.VolumeDown()
+							return printDone(cmd, zoneVolumeStep(false))
 						},
 					},
 				},
@@ -132,8 +634,10 @@ func main() {
 						Usage: "Query current subwoofer level",
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							result, err := client.QuerySubwooferLevel()
-							fmt.Print(result)
-							return err
+							if err != nil {
+								return err
+							}
+							return printResult(levelOutput{Level: result}, strconv.Itoa(result))
 						},
 					},
 					{
@@ -141,13 +645,14 @@ func main() {
 						Usage: "Set subwoofer level",
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							if cmd.Args().Len() != 1 {
-								return fmt.Errorf("usage: subwoofer set <level>")
+								return usageError("subwoofer set <level>")
 							}
 							level, err := strconv.Atoi(cmd.Args().First())
 							if err != nil {
-								return fmt.Errorf("invalid subwoofer level: %w", err)
+								return invalidArgument("subwoofer level", err)
 							}
-							return client.SetSubwooferLevel(level)
+							loadLimits()
+							return printDone(cmd, client.SetSubwooferLevel(level))
 						},
 					},
 				},
@@ -160,47 +665,205 @@ func main() {
 						Name:  "query",
 						Usage: "Query current input source",
 						Action: func(ctx context.Context, cmd *cli.Command) error {
-							result, err := client.QueryInputSelector()
+							result, err := zoneQueryInput()
 							if err != nil {
 								return err
 							}
-							fmt.Println(result)
-							return nil
+							return printResult(inputOutput{Input: result}, result)
 						},
 					},
 					{
 						Name:  "set",
-						Usage: "Set input source (tv, spotify, dj, vinyl)",
+						Usage: "Set input source",
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							if cmd.Args().Len() != 1 {
-								return fmt.Errorf("usage: source set <source>")
+								return usageError("source set <source>")
 							}
-
-							source := strings.ToLower(cmd.Args().First())
-							validSources := map[string]bool{
-								"tv":      true,
-								"spotify": true,
-								"dj":      true,
-								"vinyl":   true,
-							}
-
-							if !validSources[source] {
-								return fmt.Errorf("invalid source '%s'. Available sources: tv, spotify, dj, vinyl", source)
-							}
-
-							return client.SetInputSelector(source)
+							loadDeviceInfo()
+							return printDone(cmd, zoneSetInput(resolveInput(cmd.Args().First())))
 						},
 					},
 					{
 						Name:  "list",
 						Usage: "List available input sources",
 						Action: func(ctx context.Context, cmd *cli.Command) error {
-							fmt.Println("Available sources:")
-							fmt.Println("  - tv")
-							fmt.Println("  - spotify")
-							fmt.Println("  - dj")
-							fmt.Println("  - vinyl")
-							return nil
+							loadDeviceInfo()
+							return printResult(client.Inputs(), client.Inputs()...)
+						},
+					},
+				},
+			},
+			{
+				Name:  "tuner",
+				Usage: "Control FM/AM/DAB tuner",
+				Commands: []*cli.Command{
+					{
+						Name:  "query",
+						Usage: "Query current tuner frequency",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							result, err := client.QueryTunerFrequency()
+							if err != nil {
+								return err
+							}
+							return printResult(result, result.String())
+						},
+					},
+					{
+						Name:  "band",
+						Usage: "Switch to tuner band (fm, am, dab)",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							if cmd.Args().Len() != 1 {
+								return usageError("tuner band <band>")
+							}
+							return printDone(cmd, client.SetTunerBand(strings.ToLower(cmd.Args().First())))
+						},
+					},
+					{
+						Name:  "tune",
+						Usage: "Tune to frequency in MHz for fm or kHz for am",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							if cmd.Args().Len() != 2 {
+								return usageError("tuner tune <band> <frequency>")
+							}
+							band := strings.ToLower(cmd.Args().Get(0))
+							frequency, err := strconv.ParseFloat(cmd.Args().Get(1), 64)
+							if err != nil {
+								return invalidArgument("frequency", err)
+							}
+							if err := client.SetTunerBand(band); err != nil {
+								return err
+							}
+							return printDone(cmd, client.SetTunerFrequency(band, frequency))
+						},
+					},
+					{
+						Name:  "up",
+						Usage: "Tune up",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							return printDone(cmd, client.TunerUp())
+						},
+					},
+					{
+						Name:  "down",
+						Usage: "Tune down",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							return printDone(cmd, client.TunerDown())
+						},
+					},
+					{
+						Name:  "preset",
+						Usage: "Select preset (1-40)",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							if cmd.Args().Len() != 1 {
+								return usageError("tuner preset <number>")
+							}
+							preset, err := strconv.Atoi(cmd.Args().First())
+							if err != nil {
+								return invalidArgument("preset", err)
+							}
+							return printDone(cmd, client.SelectPreset(preset))
+						},
+					},
+					{
+						Name:  "store",
+						Usage: "Store current station as preset (1-40)",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							if cmd.Args().Len() != 1 {
+								return usageError("tuner store <number>")
+							}
+							preset, err := strconv.Atoi(cmd.Args().First())
+							if err != nil {
+								return invalidArgument("preset", err)
+							}
+							return printDone(cmd, client.StorePreset(preset))
+						},
+					},
+					{
+						Name:  "station",
+						Usage: "Query station name",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							result, err := client.QueryStationName()
+							if err != nil {
+								return err
+							}
+							return printResult(stationOutput{Station: result}, result)
+						},
+					},
+					{
+						Name:  "rds",
+						Usage: "Show RDS information on display (rt, pty, tp)",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							if cmd.Args().Len() != 1 {
+								return usageError("tuner rds <mode>")
+							}
+							return printDone(cmd, client.SetRDSDisplay(strings.ToLower(cmd.Args().First())))
+						},
+					},
+				},
+			},
+			{
+				Name:  "device",
+				Usage: "Show device information",
+				Commands: []*cli.Command{
+					{
+						Name:  "info",
+						Usage: "Show model, firmware, zones, inputs and services",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							info, err := client.QueryDeviceInfo()
+							if err != nil {
+								return err
+							}
+							return printResult(info, deviceInfoLines(info)...)
+						},
+					},
+					{
+						Name:  "model",
+						Usage: "Show model capabilities used for validation",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							// Models given by the flag or the context are not detected
+							model := client.Model()
+							if !client.ModelPinned() {
+								var err error
+								if model, err = client.DetectModel(); err != nil {
+									fmt.Fprintf(os.Stderr, "Model detection failed, assuming %s: %v\n", model.Name, err)
+								}
+							}
+							return printResult(model, modelLines(model)...)
+						},
+					},
+					{
+						Name:  "models",
+						Usage: "List known models and families",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							return printResult(eiscp.Models(), eiscp.Models()...)
+						},
+					},
+				},
+			},
+			{
+				Name:  "info",
+				Usage: "Show signal information",
+				Commands: []*cli.Command{
+					{
+						Name:  "audio",
+						Usage: "Show audio signal information",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							info, err := client.QueryAudioInformation()
+							if err != nil {
+								return err
+							}
+							return printResult(info, audioInformationLines(info)...)
+						},
+					},
+					{
+						Name:  "video",
+						Usage: "Show video signal information",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							info, err := client.QueryVideoInformation()
+							if err != nil {
+								return err
+							}
+							return printResult(info, videoInformationLines(info)...)
 						},
 					},
 				},
@@ -210,19 +873,48 @@ func main() {
 				Usage: "Set brightness level",
 				Action: func(ctx context.Context, cmd *cli.Command) error {
 					if cmd.Args().Len() != 1 {
-						return fmt.Errorf("usage: brightness (0|1|2)")
+						return usageError("brightness <level>")
 					}
 					level, err := strconv.Atoi(cmd.Args().First())
 					if err != nil {
-						return fmt.Errorf("invalid brightness level: %w", err)
+						return invalidArgument("brightness level", err)
 					}
-					return client.SetBrightness(level)
+					loadLimits()
+					return printDone(cmd, client.SetBrightness(level))
+				},
+			},
+			{
+				Name:  "art",
+				Usage: "Fetch album art of the currently playing track",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "file",
+						Aliases: []string{"f"},
+						Usage:   "Save the image to a file",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					art, err := client.QueryAlbumArt()
+					if err != nil {
+						return err
+					}
+					if art.URL != "" {
+						return printResult(artOutput{URL: art.URL}, art.URL)
+					}
+					result := artOutput{ContentType: art.ContentType, Size: len(art.Data), File: cmd.String("file")}
+					if result.File == "" {
+						return printResult(result, fmt.Sprintf("%s, %d bytes", art.ContentType, len(art.Data)))
+					}
+					if err := os.WriteFile(result.File, art.Data, 0644); err != nil {
+						return err
+					}
+					return printResult(result)
 				},
 			},
 			{
 				Name: "blink",
 				Action: func(ctx context.Context, cmd *cli.Command) error {
-					return client.AnimateBlink()
+					return printDone(cmd, client.AnimateBlink())
 				},
 			},
 		},
@@ -230,8 +922,10 @@ func main() {
 			return cli.ShowAppHelp(cmd)
 		},
 	}
+}
 
-	if err := cmd.Run(context.Background(), os.Args); err != nil {
-		log.Fatal(err)
+func main() {
+	if err := newApp().Run(context.Background(), os.Args); err != nil {
+		exitWithError(err)
 	}
 }
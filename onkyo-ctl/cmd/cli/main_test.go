@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp/eiscptest"
+)
+
+// Points the commands at a fresh test client, for the test only
+func useClient(t *testing.T) *eiscptest.Transport {
+	t.Helper()
+	testClient, fake := newTestClient(t)
+	previousClient, previousLoaded := client, deviceInfoLoaded
+	client, deviceInfoLoaded = testClient, false
+	t.Cleanup(func() { client, deviceInfoLoaded = previousClient, previousLoaded })
+	return fake
+}
+
+const testRecording = `{"time":"2024-05-01T20:31:47Z","direction":"sent","frame":"!1MVLQSTN"}
+{"time":"2024-05-01T20:31:47Z","direction":"received","frame":"!1MVL1E"}
+`
+
+func TestLoadReplayDialsFreshSessions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	if err := os.WriteFile(path, []byte(testRecording), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dialer, err := loadReplay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Closing the first session must not break the next one, as record does
+	for session := 0; session < 2; session++ {
+		client, err := eiscp.Dial(dialer)
+		if err != nil {
+			t.Fatalf("session %d: Dial: %v", session, err)
+		}
+		client.SetTimeout(time.Second)
+		level, err := client.QueryVolume()
+		client.Close()
+		if err != nil || level != 30 {
+			t.Fatalf("session %d: QueryVolume = %d, %v, want 30", session, level, err)
+		}
+	}
+}
+
+// Connection settings of the environment, cleared so they do not leak into the tests
+var settingsEnv = []string{"ONKYO_CONTEXT", "ONKYO_HOST", "ONKYO_PORT", "ONKYO_SERIAL", "ONKYO_BAUD", "ONKYO_MODEL", "ONKYO_ZONE", "ONKYO_OUTPUT", "ONKYO_CONFIG"}
+
+func clearSettingsEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range settingsEnv {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+// Runs onkyo with the args against the CLI config, returning what it printed on stdout.
+// The globals set up by the command are restored afterwards.
+func runApp(t *testing.T, config CLIConfig, args ...string) (string, error) {
+	t.Helper()
+	clearSettingsEnv(t)
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := config.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ONKYO_CLI_CONFIG", path)
+
+	previousClient, previousDialer, previousRecording := client, dialer, recording
+	previousZone, previousAliases, previousOutput, previousLoaded := zone, inputAliases, output, deviceInfoLoaded
+	deviceInfoLoaded = false
+	t.Cleanup(func() {
+		client, dialer, recording = previousClient, previousDialer, previousRecording
+		zone, inputAliases, output, deviceInfoLoaded = previousZone, previousAliases, previousOutput, previousLoaded
+	})
+
+	var err error
+	stdout := captureStdout(t, func() {
+		err = newApp().Run(context.Background(), append([]string{"onkyo"}, args...))
+	})
+	return stdout, err
+}
+
+// Returns what the function printed on stdout
+func captureStdout(t *testing.T, run func()) string {
+	t.Helper()
+	file, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	previous := os.Stdout
+	os.Stdout = file
+	defer func() { os.Stdout = previous }()
+	run()
+
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// Receivers not answering NRI are asked once per session
+func TestLoadDeviceInfoOnce(t *testing.T) {
+	fake := useClient(t)
+
+	loadDeviceInfo()
+	loadDeviceInfo()
+	assertSentMessages(t, fake, "NRIQSTN")
+}
+
+func TestLoadLimits(t *testing.T) {
+	fake := useClient(t)
+	loadLimits()
+	assertSentMessages(t, fake, "NRIQSTN")
+
+	fake = useClient(t)
+	if err := client.SetModel("TX-NR696"); err != nil {
+		t.Fatal(err)
+	}
+	loadLimits()
+	assertSentMessages(t, fake)
+}
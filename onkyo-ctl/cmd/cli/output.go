@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/capture"
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+	"github.com/urfave/cli/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// Format of command results and errors, given with --output
+type OutputFormat string
+
+const (
+	OutputText OutputFormat = "text"
+	OutputJSON OutputFormat = "json"
+	OutputYAML OutputFormat = "yaml"
+)
+
+// Output format of the whole invocation
+var output = OutputText
+
+func ParseOutputFormat(format string) (OutputFormat, error) {
+	switch OutputFormat(format) {
+	case OutputText, OutputJSON, OutputYAML:
+		return OutputFormat(format), nil
+	}
+	return "", fmt.Errorf("%w: unknown output format '%s', expected text, json or yaml", eiscp.ErrValidation, format)
+}
+
+// Exit codes scripts can branch on
+const (
+	ExitFailure      = 1
+	ExitValidation   = 2
+	ExitExpectFailed = 3
+	ExitTimeout      = 4
+	ExitConnection   = 5
+)
+
+func exitCode(err error) int {
+	var scriptErr *ScriptError
+	switch {
+	case errors.As(err, &scriptErr) && scriptErr.Code != 0:
+		return scriptErr.Code
+	case errors.Is(err, eiscp.ErrValidation), errors.Is(err, capture.ErrUnsupportedFormat):
+		return ExitValidation
+	case errors.Is(err, eiscp.ErrTimeout):
+		return ExitTimeout
+	case errors.Is(err, eiscp.ErrConnection), errors.Is(err, eiscp.ErrTransport):
+		return ExitConnection
+	}
+	return ExitFailure
+}
+
+// Error as printed on stderr in JSON and YAML output
+type errorOutput struct {
+	Error    string `json:"error"`
+	ExitCode int    `json:"exitCode"`
+}
+
+// Prints the error on stderr in the output format and exits with its code
+func exitWithError(err error) {
+	code := exitCode(err)
+	if output == OutputText {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	} else {
+		writeResult(os.Stderr, output, errorOutput{Error: err.Error(), ExitCode: code}, nil)
+	}
+	os.Exit(code)
+}
+
+// Prints the result of a command in the global output format.
+// Text output is one line per entry, structured output encodes the value.
+func printResult(value interface{}, lines ...string) error {
+	return writeResult(os.Stdout, output, value, lines)
+}
+
+// Result of commands changing the state rather than reporting it
+type doneOutput struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	OK      bool     `json:"ok"`
+}
+
+// Reports the command done in JSON and YAML output, so every command prints something
+// to parse. Text output stays quiet, errors are printed by exitWithError.
+func printDone(cmd *cli.Command, err error) error {
+	if err != nil || output == OutputText {
+		return err
+	}
+	name := strings.TrimPrefix(cmd.FullName(), cmd.Root().Name+" ")
+	return printResult(doneOutput{Command: name, Args: append([]string{}, cmd.Args().Slice()...), OK: true})
+}
+
+func writeResult(w io.Writer, format OutputFormat, value interface{}, lines []string) error {
+	switch format {
+	case OutputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(value)
+	case OutputYAML:
+		return encodeYAML(w, value)
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// YAML follows the JSON encoding, so both formats share field names and order
+func encodeYAML(w io.Writer, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	resetYAMLStyle(&node)
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// JSON parses as flow style YAML with quoted strings, block style reads better
+func resetYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetYAMLStyle(child)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/capture"
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"plain error", errors.New("boom"), ExitFailure},
+		{"mismatch", &eiscp.MismatchError{Requested: eiscp.NewMessage("MVL", "1E")}, ExitFailure},
+		{"validation", fmt.Errorf("%w: bad level", eiscp.ErrValidation), ExitValidation},
+		{"unsupported capture", fmt.Errorf("reading: %w", capture.ErrUnsupportedFormat), ExitValidation},
+		{"failed expectation", &ScriptError{Name: "test", Line: 3, Err: errors.New("expected PWR01"), Code: ExitExpectFailed}, ExitExpectFailed},
+		{"timeout", fmt.Errorf("%w: no response", eiscp.ErrTimeout), ExitTimeout},
+		{"script line timing out", &ScriptError{Name: "test", Line: 1, Err: eiscp.ErrTimeout}, ExitTimeout},
+		{"connection", fmt.Errorf("%w: refused", eiscp.ErrConnection), ExitConnection},
+		{"transport", fmt.Errorf("%w: broken pipe", eiscp.ErrTransport), ExitConnection},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Fatalf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	for _, format := range []string{"text", "json", "yaml"} {
+		if got, err := ParseOutputFormat(format); err != nil || string(got) != format {
+			t.Fatalf("ParseOutputFormat(%q) = %q, %v", format, got, err)
+		}
+	}
+	if _, err := ParseOutputFormat("xml"); !errors.Is(err, eiscp.ErrValidation) {
+		t.Fatalf("ParseOutputFormat(xml) error = %v, want ErrValidation", err)
+	}
+}
+
+func TestWriteResult(t *testing.T) {
+	value := volumeOutput{Level: 30, Value: -52, Unit: eiscp.VolumeDB}
+	tests := []struct {
+		format OutputFormat
+		value  interface{}
+		want   string
+	}{
+		{OutputText, value, "-52.0 dB\nlevel 30\n"},
+		{OutputJSON, value, "{\n  \"level\": 30,\n  \"value\": -52,\n  \"unit\": \"db\"\n}\n"},
+		{OutputYAML, value, "level: 30\nvalue: -52\nunit: db\n"},
+		{OutputJSON, []string{"tv", "<vinyl>"}, "[\n  \"tv\",\n  \"<vinyl>\"\n]\n"},
+		{OutputYAML, []string{"tv", "vinyl"}, "- tv\n- vinyl\n"},
+		{OutputYAML, errorOutput{Error: "timeout error", ExitCode: ExitTimeout}, "error: timeout error\nexitCode: 4\n"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var out bytes.Buffer
+			if err := writeResult(&out, tt.format, tt.value, []string{"-52.0 dB", "level 30"}); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Fatalf("output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+// Replays nothing, commands only writing work against it
+func emptyReplay(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "replay.jsonl")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Commands changing the state report it in structured output, text output stays quiet
+func TestPrintDone(t *testing.T) {
+	replay := emptyReplay(t)
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"json", []string{"-o", "json", "volume", "up"}, "{\n  \"command\": \"volume up\",\n  \"args\": [],\n  \"ok\": true\n}\n"},
+		{"yaml", []string{"-o", "yaml", "--model", "TX-L20D", "volume", "set", "30"}, "command: volume set\nargs:\n  - \"30\"\nok: true\n"},
+		{"text", []string{"volume", "down"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, err := runApp(t, CLIConfig{}, append([]string{"--replay", replay}, tt.args...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stdout != tt.want {
+				t.Fatalf("output = %q, want %q", stdout, tt.want)
+			}
+		})
+	}
+}
+
+// Failed commands print the error only, which is left to exitWithError
+func TestPrintDoneError(t *testing.T) {
+	stdout, err := runApp(t, CLIConfig{}, "--replay", emptyReplay(t), "-o", "json", "--model", "TX-L20D", "volume", "set", "99")
+	if exitCode(err) != ExitValidation {
+		t.Fatalf("error = %v, want validation error", err)
+	}
+	if stdout != "" {
+		t.Fatalf("output = %q, want nothing", stdout)
+	}
+}
+
+// Every command prints JSON, whether it reports or changes the state
+func TestOutputJSONParses(t *testing.T) {
+	replay := emptyReplay(t)
+	for _, args := range [][]string{
+		{"volume", "up"},
+		{"blink"},
+		{"device", "models"},
+		{"--model", "TX-L20D", "device", "model"},
+	} {
+		stdout, err := runApp(t, CLIConfig{}, append([]string{"--replay", replay, "-o", "json"}, args...)...)
+		if err != nil {
+			t.Fatalf("%q: %v", args, err)
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(stdout), &value); err != nil {
+			t.Fatalf("%q printed %q: %v", args, stdout, err)
+		}
+	}
+
+	var done doneOutput
+	stdout, _ := runApp(t, CLIConfig{}, "--replay", replay, "-o", "json", "blink")
+	if err := json.Unmarshal([]byte(stdout), &done); err != nil {
+		t.Fatal(err)
+	}
+	if want := (doneOutput{Command: "blink", Args: []string{}, OK: true}); !reflect.DeepEqual(done, want) {
+		t.Fatalf("result = %+v, want %+v", done, want)
+	}
+}
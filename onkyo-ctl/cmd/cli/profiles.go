@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Profile of the API config file, named after its input
+type Profile struct {
+	Name           string
+	VolumeLevel    int `json:"volumeLevel"`
+	SubwooferLevel int `json:"subwooferLevel"`
+	MaxVolume      int `json:"maxVolume"`
+}
+
+// Reads the profiles of the API config file, keyed by input and sorted by name.
+// Empty path means no profiles.
+func loadProfiles(path string) ([]Profile, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	var config struct {
+		Profiles map[string]Profile `json:"profiles"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	profiles := make([]Profile, 0, len(config.Profiles))
+	for input, profile := range config.Profiles {
+		profile.Name = input
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	return profiles, nil
+}
+
+// Percentages are relative to the max volume of the current input profile, like in the API.
+// Inputs without a profile use the max volume of the model.
+func percentReference(profiles []Profile) int {
+	if input, err := client.QueryInputSelector(); err == nil {
+		for _, profile := range profiles {
+			if profile.Name == input && profile.MaxVolume > 0 {
+				return profile.MaxVolume
+			}
+		}
+	}
+	return client.MaxVolume()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+)
+
+// Volume in raw steps and in the requested unit
+type volumeOutput struct {
+	Level int              `json:"level"`
+	Value float64          `json:"value"`
+	Unit  eiscp.VolumeUnit `json:"unit"`
+}
+
+type levelOutput struct {
+	Level int `json:"level"`
+}
+
+type inputOutput struct {
+	Input string `json:"input"`
+}
+
+type stationOutput struct {
+	Station string `json:"station"`
+}
+
+// Album art is either a URL or an image, saved when a file is given
+type artOutput struct {
+	URL         string `json:"url,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Size        int    `json:"size,omitempty"`
+	File        string `json:"file,omitempty"`
+}
+
+func deviceInfoLines(info *eiscp.DeviceInfo) []string {
+	lines := []string{
+		fmt.Sprintf("Model:    %s %s", info.Brand, info.Model),
+		fmt.Sprintf("Name:     %s", info.FriendlyName),
+		fmt.Sprintf("Firmware: %s", info.FirmwareVersion),
+		"Zones:",
+	}
+	for _, zone := range info.Zones {
+		if zone.Available {
+			lines = append(lines, fmt.Sprintf("  - %s (max volume %d)", zone.Name, zone.MaxVolume))
+		}
+	}
+	lines = append(lines, "Inputs:")
+	for _, input := range info.Inputs {
+		lines = append(lines, fmt.Sprintf("  - %s (%s)", input.Name, input.Code))
+	}
+	lines = append(lines, "Tuners:")
+	for _, tuner := range info.Tuners {
+		lines = append(lines, fmt.Sprintf("  - %s %d-%d kHz", strings.ToUpper(tuner.Band), tuner.Min, tuner.Max))
+	}
+	lines = append(lines, "Network services:")
+	for _, service := range info.NetServices {
+		lines = append(lines, fmt.Sprintf("  - %s", service.Name))
+	}
+	return lines
+}
+
+func modelLines(model eiscp.Model) []string {
+	zones := "any"
+	if model.Zones != nil {
+		zones = strings.Join(model.Zones, ", ")
+	}
+	lines := []string{
+		fmt.Sprintf("Model:      %s", model.Name),
+		fmt.Sprintf("Volume:     0-%d", model.MaxVolume),
+		fmt.Sprintf("Subwoofer:  %d-%d", model.SubwooferMin, model.SubwooferMax),
+		fmt.Sprintf("Brightness: 0-%d", model.MaxBrightness),
+		fmt.Sprintf("Zones:      %s", zones),
+	}
+	if model.Commands != nil {
+		lines = append(lines, fmt.Sprintf("Commands:   %s", strings.Join(model.Commands, " ")))
+	}
+	return lines
+}
+
+func audioInformationLines(info eiscp.AudioInformation) []string {
+	return []string{
+		fmt.Sprintf("Input port:      %s", info.InputPort),
+		fmt.Sprintf("Input format:    %s", info.InputFormat),
+		fmt.Sprintf("Sample rate:     %s", info.SampleRate),
+		fmt.Sprintf("Input channels:  %s", info.InputChannels),
+		fmt.Sprintf("Listening mode:  %s", info.ListeningMode),
+		fmt.Sprintf("Output channels: %s", info.OutputChannels),
+	}
+}
+
+func videoInformationLines(info eiscp.VideoInformation) []string {
+	return []string{
+		fmt.Sprintf("Input port:         %s", info.InputPort),
+		fmt.Sprintf("Input resolution:   %s", info.InputResolution),
+		fmt.Sprintf("Input color space:  %s", info.InputColorSpace),
+		fmt.Sprintf("Input color depth:  %s", info.InputColorDepth),
+		fmt.Sprintf("Output port:        %s", info.OutputPort),
+		fmt.Sprintf("Output resolution:  %s", info.OutputResolution),
+		fmt.Sprintf("Output color space: %s", info.OutputColorSpace),
+		fmt.Sprintf("Output color depth: %s", info.OutputColorDepth),
+		fmt.Sprintf("Picture mode:       %s", info.PictureMode),
+	}
+}
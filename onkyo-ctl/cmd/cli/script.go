@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+)
+
+// ScriptError reports the failing line of a script and the exit code it ends with,
+// the one of the wrapped error when zero
+type ScriptError struct {
+	Name string
+	Line int
+	Err  error
+	Code int
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.Name, e.Line, e.Err)
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+type scriptStepKind int
+
+const (
+	stepSend scriptStepKind = iota
+	stepMeta
+	stepWait
+	stepExpect
+	stepExit
+)
+
+// Line of the script, checked before anything is sent
+type scriptStep struct {
+	line    int
+	text    string
+	kind    scriptStepKind
+	message eiscp.Message
+	// Wait duration, or how long to wait for the expected message
+	duration time.Duration
+}
+
+// Parses the whole script, so a typo on the last line fails before the first command is sent.
+// Lines are raw messages, chat commands like "volume 30", "wait 500ms",
+// "expect MVL1E [timeout]" or comments starting with #.
+func parseScript(name string, r io.Reader) ([]scriptStep, error) {
+	var steps []scriptStep
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		step, err := parseScriptLine(text)
+		if err != nil {
+			return nil, &ScriptError{Name: name, Line: line, Err: err, Code: ExitValidation}
+		}
+		step.line, step.text = line, text
+		steps = append(steps, step)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read script: %w", err)
+	}
+	return steps, nil
+}
+
+func parseScriptLine(text string) (scriptStep, error) {
+	words := strings.Fields(text)
+	command := strings.ToLower(words[0])
+	switch command {
+	case "wait":
+		if len(words) != 2 {
+			return scriptStep{}, errors.New("usage: wait DURATION, e.g. wait 500ms")
+		}
+		duration, err := time.ParseDuration(words[1])
+		if err != nil || duration < 0 {
+			return scriptStep{}, fmt.Errorf("invalid duration '%s'", words[1])
+		}
+		return scriptStep{kind: stepWait, duration: duration}, nil
+	case "expect":
+		if len(words) < 2 || len(words) > 3 {
+			return scriptStep{}, errors.New("usage: expect MESSAGE [TIMEOUT], e.g. expect MVL1E 2s")
+		}
+		message, err := eiscp.ParseMessage(words[1])
+		if err != nil {
+			return scriptStep{}, err
+		}
+		step := scriptStep{kind: stepExpect, message: message}
+		if len(words) == 3 {
+			if step.duration, err = time.ParseDuration(words[2]); err != nil || step.duration <= 0 {
+				return scriptStep{}, fmt.Errorf("invalid timeout '%s'", words[2])
+			}
+		}
+		return step, nil
+	case "exit":
+		return scriptStep{kind: stepExit}, nil
+	}
+
+	if _, ok := metaCommands[command]; ok {
+		return scriptStep{kind: stepMeta}, nil
+	}
+	message, err := eiscp.ParseMessage(text)
+	if err != nil {
+		return scriptStep{}, err
+	}
+	return scriptStep{kind: stepSend, message: message}, nil
+}
+
+// Expected message matches the whole message, or any parameter when only the command is given
+func expectationMatches(expected, message eiscp.Message) bool {
+	if !strings.EqualFold(expected.Command, message.Command) {
+		return false
+	}
+	return expected.Parameter == "" || strings.EqualFold(expected.Parameter, message.Parameter)
+}
+
+// Runs the script without a prompt, printing what is sent and everything received.
+// Expectations look at messages received since the previous expectation, waiting for
+// the client timeout unless the line gives its own. The first failing line ends the script.
+func RunScript(client *eiscp.EISCPClient, name string, r io.Reader, out io.Writer) error {
+	steps, err := parseScript(name, r)
+	if err != nil {
+		return err
+	}
+
+	model := client.Model().Name
+	messages, cancel := client.Subscribe()
+	defer cancel()
+
+	// Prints messages as they are consumed, reporting false once the connection is gone
+	receive := func(timer <-chan time.Time) (eiscp.Message, bool, bool) {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				return eiscp.Message{}, false, false
+			}
+			fmt.Fprintf(out, "%s: %s\n", model, annotate(message))
+			return message, true, true
+		case <-timer:
+			return eiscp.Message{}, false, true
+		}
+	}
+	fail := func(step scriptStep, code int, err error) error {
+		return &ScriptError{Name: name, Line: step.line, Err: err, Code: code}
+	}
+
+	for _, step := range steps {
+		switch step.kind {
+		case stepSend, stepMeta:
+			fmt.Fprintf(out, "> %s\n", step.text)
+			if step.kind == stepSend {
+				err = client.SendMessage(step.message)
+			} else {
+				_, err = runMetaCommand(client, out, step.text)
+			}
+			if err != nil {
+				return fail(step, 0, err)
+			}
+		case stepWait:
+			timer := time.After(step.duration)
+			for {
+				if _, received, open := receive(timer); !received {
+					if !open {
+						return fail(step, 0, fmt.Errorf("%w: connection closed", eiscp.ErrConnection))
+					}
+					break
+				}
+			}
+		case stepExpect:
+			timeout := step.duration
+			if timeout == 0 {
+				timeout = client.Timeout()
+			}
+			timer := time.After(timeout)
+			var last *eiscp.Message
+			for {
+				message, received, open := receive(timer)
+				if !open {
+					return fail(step, ExitExpectFailed, fmt.Errorf("expected %s, connection closed", step.message))
+				}
+				if !received {
+					if last != nil {
+						return fail(step, ExitExpectFailed, fmt.Errorf("expected %s, got %s", step.message, last))
+					}
+					return fail(step, ExitExpectFailed, fmt.Errorf("expected %s, nothing received in %v", step.message, timeout))
+				}
+				if expectationMatches(step.message, message) {
+					break
+				}
+				if strings.EqualFold(message.Command, step.message.Command) {
+					last = &message
+				}
+			}
+		case stepExit:
+			return nil
+		}
+	}
+	return nil
+}
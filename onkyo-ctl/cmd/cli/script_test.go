@@ -0,0 +1,269 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp/eiscptest"
+)
+
+// Client of the fake receiver, writing right away and giving up on responses quickly
+func newTestClient(t *testing.T) (*eiscp.EISCPClient, *eiscptest.Transport) {
+	t.Helper()
+	fake := eiscptest.NewTransport()
+	client := fake.Client()
+	client.SetCommandGap(0)
+	client.SetTimeout(50 * time.Millisecond)
+	client.SetSettleTime(0)
+	t.Cleanup(func() { client.Close() })
+	return client, fake
+}
+
+func TestParseScript(t *testing.T) {
+	script := `# Evening routine
+PWR01
+
+  # indented comment
+	wait 500ms
+volume 30
+expect MVL1E 2s
+expect mvl
+mvlQSTN
+exit
+`
+	steps, err := parseScript("evening", strings.NewReader(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type parsed struct {
+		line     int
+		kind     scriptStepKind
+		message  string
+		duration time.Duration
+	}
+	want := []parsed{
+		{2, stepSend, "PWR01", 0},
+		{5, stepWait, "", 500 * time.Millisecond},
+		{6, stepMeta, "", 0},
+		{7, stepExpect, "MVL1E", 2 * time.Second},
+		{8, stepExpect, "MVL", 0},
+		{9, stepSend, "MVLQSTN", 0},
+		{10, stepExit, "", 0},
+	}
+	got := make([]parsed, len(steps))
+	for i, step := range steps {
+		got[i] = parsed{step.line, step.kind, step.message.String(), step.duration}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parsed\n%+v\nwant\n%+v", got, want)
+	}
+	if steps[2].text != "volume 30" {
+		t.Fatalf("meta command text %q", steps[2].text)
+	}
+}
+
+func TestParseScriptErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		line   int
+		want   string
+	}{
+		{"invalid duration", "PWR01\n\n# soon\nwait soon\n", 4, "invalid duration 'soon'"},
+		{"negative duration", "wait -1s", 1, "invalid duration '-1s'"},
+		{"wait without duration", "MVL1E\nwait", 2, "usage: wait"},
+		{"wait with two durations", "wait 1s 2s", 1, "usage: wait"},
+		{"expect without message", "expect", 1, "usage: expect"},
+		{"expect with extra words", "expect MVL1E 2s now", 1, "usage: expect"},
+		{"expect invalid timeout", "expect MVL1E 0s", 1, "invalid timeout '0s'"},
+		{"expect short message", "expect MV", 1, "MV"},
+		{"short message", "PWR01\r\nMV\r\n", 2, "MV"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseScript("test", strings.NewReader(tt.script))
+			var scriptErr *ScriptError
+			if !errors.As(err, &scriptErr) {
+				t.Fatalf("error = %v, want ScriptError", err)
+			}
+			if scriptErr.Line != tt.line || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %q, want line %d with %q", err, tt.line, tt.want)
+			}
+			if !strings.HasPrefix(err.Error(), "test:") {
+				t.Fatalf("error %q does not name the script", err)
+			}
+			if exitCode(err) != ExitValidation {
+				t.Fatalf("exit code %d, want %d", exitCode(err), ExitValidation)
+			}
+		})
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	client, fake := newTestClient(t)
+	fake.Respond("PWR01", "PWR01")
+	fake.Respond("MVL1E", "NLSC-P", "MVL1E")
+	fake.Respond("MVLUP", "MVL1F")
+
+	script := `PWR01
+expect PWR01
+volume 30
+# only the command, any level
+expect MVL
+volume up
+expect mvl1f 200ms
+wait 10ms
+`
+	var out strings.Builder
+	if err := RunScript(client, "test", strings.NewReader(script), &out); err != nil {
+		t.Fatalf("RunScript: %v\n%s", err, out.String())
+	}
+	assertSentMessages(t, fake, "PWR01", "MVL1E", "MVLUP")
+	for _, line := range []string{"> PWR01", "> volume 30", "> volume up", "unknown: MVL1F"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("output does not show %q:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestRunScriptFailsFast(t *testing.T) {
+	tests := []struct {
+		name      string
+		script    string
+		responses map[string][]string
+		line      int
+		code      int
+		want      string
+		sent      []string
+	}{
+		{
+			name:      "expected other value",
+			script:    "MVL1E\nexpect MVL1E\nPWR00\n",
+			responses: map[string][]string{"MVL1E": {"MVL1D"}},
+			line:      2,
+			code:      ExitExpectFailed,
+			want:      "expected MVL1E, got MVL1D",
+			sent:      []string{"MVL1E"},
+		},
+		{
+			name:   "nothing received",
+			script: "# quiet receiver\nMVL1E\nexpect MVL1E 20ms\nPWR00\n",
+			line:   3,
+			code:   ExitExpectFailed,
+			want:   "expected MVL1E, nothing received in 20ms",
+			sent:   []string{"MVL1E"},
+		},
+		{
+			name:      "unrelated messages only",
+			script:    "MVL1E\nexpect PWR01\nPWR00\n",
+			responses: map[string][]string{"MVL1E": {"MVL1E", "NLSC-P"}},
+			line:      2,
+			code:      ExitExpectFailed,
+			want:      "expected PWR01, nothing received",
+			sent:      []string{"MVL1E"},
+		},
+		{
+			name:   "invalid meta command argument",
+			script: "PWR01\nvolume loud\nPWR00\n",
+			line:   2,
+			code:   ExitFailure,
+			want:   "invalid volume level 'loud'",
+			sent:   []string{"PWR01"},
+		},
+		{
+			name:   "invalid level",
+			script: "volume 99\nPWR00\n",
+			line:   1,
+			code:   ExitValidation,
+			want:   "must be between 0 and 50",
+		},
+		{
+			name:   "typo on the last line",
+			script: "PWR01\nMVL1E\nwait forever\n",
+			line:   3,
+			code:   ExitValidation,
+			want:   "invalid duration 'forever'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newTestClient(t)
+			for message, responses := range tt.responses {
+				fake.Respond(message, responses...)
+			}
+
+			var out strings.Builder
+			err := RunScript(client, "test", strings.NewReader(tt.script), &out)
+			var scriptErr *ScriptError
+			if !errors.As(err, &scriptErr) {
+				t.Fatalf("error = %v, want ScriptError", err)
+			}
+			if scriptErr.Line != tt.line || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %q, want line %d with %q", err, tt.line, tt.want)
+			}
+			if exitCode(err) != tt.code {
+				t.Fatalf("exit code %d, want %d", exitCode(err), tt.code)
+			}
+			// Nothing after the failing line is sent
+			assertSentMessages(t, fake, tt.sent...)
+		})
+	}
+}
+
+func TestRunScriptExit(t *testing.T) {
+	client, fake := newTestClient(t)
+	var out strings.Builder
+	if err := RunScript(client, "test", strings.NewReader("MVL1E\nexit\nPWR00\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	assertSentMessages(t, fake, "MVL1E")
+}
+
+func TestRunScriptWriteFailure(t *testing.T) {
+	client, fake := newTestClient(t)
+	fake.FailWrites(errors.New("cable unplugged"))
+
+	var out strings.Builder
+	err := RunScript(client, "test", strings.NewReader("# first\nPWR01\nPWR00\n"), &out)
+	var scriptErr *ScriptError
+	if !errors.As(err, &scriptErr) || scriptErr.Line != 2 {
+		t.Fatalf("error = %v, want ScriptError on line 2", err)
+	}
+	if exitCode(err) != ExitConnection {
+		t.Fatalf("exit code %d, want %d", exitCode(err), ExitConnection)
+	}
+}
+
+func TestRunScriptConnectionClosed(t *testing.T) {
+	for _, tt := range []struct {
+		script string
+		code   int
+	}{
+		{"expect PWR01 1s", ExitExpectFailed},
+		{"wait 1s", ExitConnection},
+	} {
+		client, fake := newTestClient(t)
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			fake.Close()
+		}()
+
+		var out strings.Builder
+		err := RunScript(client, "test", strings.NewReader(tt.script), &out)
+		if err == nil || !strings.Contains(err.Error(), "connection closed") || exitCode(err) != tt.code {
+			t.Errorf("%s: error = %v with exit code %d, want connection closed with %d", tt.script, err, exitCode(err), tt.code)
+		}
+	}
+}
+
+func assertSentMessages(t *testing.T, fake *eiscptest.Transport, want ...string) {
+	t.Helper()
+	if got := fake.Sent(); !reflect.DeepEqual(got, want) && !(len(got) == 0 && len(want) == 0) {
+		t.Fatalf("sent %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"time"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+)
+
+// Message as printed in JSON output, with its catalog description
+type messageOutput struct {
+	Message     string `json:"message"`
+	Command     string `json:"command"`
+	Parameter   string `json:"parameter"`
+	Description string `json:"description,omitempty"`
+}
+
+func newMessageOutput(message eiscp.Message) messageOutput {
+	return messageOutput{
+		Message:     message.String(),
+		Command:     message.Command,
+		Parameter:   message.Parameter,
+		Description: eiscp.Describe(message),
+	}
+}
+
+type sendOutput struct {
+	Sent      string          `json:"sent"`
+	Responses []messageOutput `json:"responses"`
+}
+
+// Sends the raw message given in the bare form. Waiting collects everything received
+// until the expected response arrives, the response to the same command by default.
+// Responses received before a timeout are printed too.
+func Send(client *eiscp.EISCPClient, text string, wait bool, expect string, timeout time.Duration) error {
+	message, err := eiscp.ParseMessage(text)
+	if err != nil {
+		return err
+	}
+
+	var responses []eiscp.Message
+	if wait || expect != "" {
+		responses, err = client.Exchange(message, expect, timeout)
+	} else {
+		err = client.SendMessage(message)
+	}
+
+	result := sendOutput{Sent: message.String(), Responses: []messageOutput{}}
+	lines := make([]string, 0, len(responses))
+	for _, response := range responses {
+		result.Responses = append(result.Responses, newMessageOutput(response))
+		lines = append(lines, annotate(response))
+	}
+	if printErr := printResult(result, lines...); printErr != nil {
+		return printErr
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+)
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		wait     bool
+		expect   string
+		timeout  time.Duration
+		wantErr  error
+		wantCode int
+		want     []string
+	}{
+		{"without waiting", "mvl1e", false, "", 0, nil, 0, []string{}},
+		{"wait for the same command", "MVLQSTN", true, "", 0, nil, 0, []string{"NLSC-P", "MVL1E"}},
+		{"expect the prefix", "PWRQSTN", false, "PWR01", 0, nil, 0, []string{"NLSC-P", "PWR01"}},
+		{"timeout keeps the replies", "PWRQSTN", false, "PWR00", 50 * time.Millisecond, eiscp.ErrTimeout, ExitTimeout, []string{"NLSC-P", "PWR01"}},
+		{"nothing received", "SLIQSTN", true, "", 50 * time.Millisecond, eiscp.ErrTimeout, ExitTimeout, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useOutput(t, OutputJSON)
+			client, fake := newTestClient(t)
+			fake.Respond("MVLQSTN", "NLSC-P", "MVL1E")
+			fake.Respond("PWRQSTN", "NLSC-P", "PWR01")
+
+			var err error
+			stdout := captureStdout(t, func() {
+				err = Send(client, tt.message, tt.wait, tt.expect, tt.timeout)
+			})
+			if !errors.Is(err, tt.wantErr) || (err != nil && exitCode(err) != tt.wantCode) {
+				t.Fatalf("error = %v, want %v exiting with %d", err, tt.wantErr, tt.wantCode)
+			}
+
+			var result sendOutput
+			if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+				t.Fatalf("output %q: %v", stdout, err)
+			}
+			var received []string
+			for _, response := range result.Responses {
+				received = append(received, response.Message)
+			}
+			if received == nil {
+				received = []string{}
+			}
+			if !reflect.DeepEqual(received, tt.want) {
+				t.Fatalf("responses %q, want %q", received, tt.want)
+			}
+			if sent, _ := eiscp.ParseMessage(tt.message); result.Sent != sent.String() {
+				t.Fatalf("sent %q, want %q", result.Sent, sent)
+			}
+			assertSentMessages(t, fake, result.Sent)
+		})
+	}
+}
+
+func TestSendOutputShape(t *testing.T) {
+	useOutput(t, OutputJSON)
+	client, fake := newTestClient(t)
+	fake.Respond("MVLQSTN", "MVL1E")
+
+	stdout := captureStdout(t, func() {
+		if err := Send(client, "MVLQSTN", true, "", 0); err != nil {
+			t.Fatal(err)
+		}
+	})
+	want := `{
+  "sent": "MVLQSTN",
+  "responses": [
+    {
+      "message": "MVL1E",
+      "command": "MVL",
+      "parameter": "1E",
+      "description": "master-volume: level 30"
+    }
+  ]
+}
+`
+	if stdout != want {
+		t.Fatalf("output:\n%s\nwant:\n%s", stdout, want)
+	}
+}
+
+// Text output is one annotated line per reply
+func TestSendText(t *testing.T) {
+	useOutput(t, OutputText)
+	client, fake := newTestClient(t)
+	fake.Respond("PWRQSTN", "PWR01", "XYZ12")
+
+	stdout := captureStdout(t, func() {
+		if err := Send(client, "PWRQSTN", false, "XYZ", 0); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if want := "PWR01 → system-power: on\nXYZ12\n"; stdout != want {
+		t.Fatalf("output = %q, want %q", stdout, want)
+	}
+}
+
+func TestSendErrors(t *testing.T) {
+	useOutput(t, OutputJSON)
+	client, fake := newTestClient(t)
+
+	stdout := captureStdout(t, func() {
+		if err := Send(client, "MV", false, "", 0); exitCode(err) != ExitValidation {
+			t.Fatalf("invalid message error = %v, want validation error", err)
+		}
+	})
+	if stdout != "" {
+		t.Fatalf("invalid message printed %q", stdout)
+	}
+	assertSentMessages(t, fake)
+
+	fake.FailWrites(errors.New("broken pipe"))
+	captureStdout(t, func() {
+		if err := Send(client, "PWR01", true, "", 0); exitCode(err) != ExitConnection {
+			t.Fatalf("failed write error = %v, want connection error", err)
+		}
+	})
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chzyer/readline"
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+)
+
+// How often the terminal size is checked, the dashboard is redrawn when it changes
+const resizeCheckInterval = 500 * time.Millisecond
+
+// Names of the keys read from the terminal in raw mode, other keys are passed as typed.
+// Ends when reading fails or the context is done, closing the keys.
+func readKeys(ctx context.Context, r io.Reader, keys chan<- string) {
+	defer close(keys)
+	send := func(key string) bool {
+		select {
+		case keys <- key:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	buf := make([]byte, 16)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		input := buf[:n]
+		var pressed []string
+		switch {
+		case n >= 3 && input[0] == 0x1b && input[1] == '[':
+			arrows := map[byte]string{'A': "up", 'B': "down", 'C': "right", 'D': "left"}
+			if key, ok := arrows[input[2]]; ok {
+				pressed = append(pressed, key)
+			}
+		case n == 1 && input[0] == 0x1b:
+			pressed = append(pressed, "esc")
+		case n == 1 && (input[0] == 0x03 || input[0] == 0x04):
+			pressed = append(pressed, "ctrl-c")
+		default:
+			for _, r := range string(input) {
+				pressed = append(pressed, string(r))
+			}
+		}
+		for _, key := range pressed {
+			if !send(key) {
+				return
+			}
+		}
+	}
+}
+
+// RunDashboard shows the full-screen dashboard until q is pressed, the context is done
+// or the connection closes. Returns once the key reader and running commands are finished.
+func RunDashboard(ctx context.Context, client *eiscp.EISCPClient, profiles []Profile) error {
+	fd := int(os.Stdin.Fd())
+	if !readline.IsTerminal(fd) || !readline.IsTerminal(int(os.Stdout.Fd())) {
+		return fmt.Errorf("%w: the dashboard needs a terminal, use watch for pipes", eiscp.ErrValidation)
+	}
+	keyboard, closeKeyboard, err := openKeyboard()
+	if err != nil {
+		return err
+	}
+	state, err := readline.MakeRaw(fd)
+	if err != nil {
+		closeKeyboard()
+		return fmt.Errorf("failed to set up terminal: %w", err)
+	}
+	defer readline.Restore(fd, state)
+
+	// Alternate screen without cursor, the shell comes back as it was
+	fmt.Print("\033[?1049h\033[?25l")
+	defer fmt.Print("\033[?25h\033[?1049l")
+
+	// Deferred in reverse: the keyboard is closed and the context cancelled,
+	// then the goroutines are waited for before the terminal is restored
+	ctx, stop := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer stop()
+	defer closeKeyboard()
+
+	d := newDashboard(client, profiles)
+	messages, cancel := client.Subscribe()
+	defer cancel()
+	keys := make(chan string)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		readKeys(ctx, keyboard, keys)
+	}()
+	statuses := make(chan string)
+
+	width, _, _ := readline.GetSize(int(os.Stdout.Fd()))
+	draw := func() {
+		drawDashboard(os.Stdout, d.render(width), width)
+	}
+	d.refresh()
+	draw()
+
+	ticker := time.NewTicker(resizeCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case message, ok := <-messages:
+			if !ok {
+				return fmt.Errorf("%w: connection closed", eiscp.ErrConnection)
+			}
+			if d.apply(message) {
+				draw()
+			}
+		case key, ok := <-keys:
+			if !ok || key == "q" || key == "esc" || key == "ctrl-c" {
+				return nil
+			}
+			action, description := d.keyAction(key)
+			if action == nil {
+				continue
+			}
+			d.setStatus(description)
+			draw()
+			// Commands wait for their turn in the writer, the screen keeps updating meanwhile
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := action(); err != nil {
+					select {
+					case statuses <- fmt.Sprintf("%s failed: %v", description, err):
+					case <-ctx.Done():
+					}
+				}
+			}()
+		case status := <-statuses:
+			d.setStatus(status)
+			draw()
+		case <-ticker.C:
+			if current, _, _ := readline.GetSize(int(os.Stdout.Fd())); current != width {
+				width = current
+				draw()
+			}
+		}
+	}
+}
+
+// Redraws the screen from the top, lines cut to the width.
+// Raw mode needs carriage returns, lines are cleared to the end instead of clearing the screen to avoid flicker.
+func drawDashboard(w io.Writer, lines []string, width int) {
+	var screen strings.Builder
+	screen.WriteString("\033[H")
+	for _, line := range lines {
+		if runes := []rune(line); width > 0 && len(runes) > width {
+			line = string(runes[:width])
+		}
+		screen.WriteString(line)
+		screen.WriteString("\033[K\r\n")
+	}
+	screen.WriteString("\033[J")
+	io.WriteString(w, screen.String())
+}
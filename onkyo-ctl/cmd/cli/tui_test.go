@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []string
+		want  []string
+	}{
+		{"arrows", []string{"\x1b[A", "\x1b[B", "\x1b[C", "\x1b[D"}, []string{"up", "down", "right", "left"}},
+		{"escape", []string{"\x1b"}, []string{"esc"}},
+		{"ctrl-c and ctrl-d", []string{"\x03", "\x04"}, []string{"ctrl-c", "ctrl-c"}},
+		{"typed together", []string{"m]q"}, []string{"m", "]", "q"}},
+		{"unknown escape sequence", []string{"\x1b[Z", "q"}, []string{"q"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, w := io.Pipe()
+			keys := make(chan string)
+			go readKeys(context.Background(), r, keys)
+			go func() {
+				// One read per write, as the terminal delivers a key press at once
+				for _, input := range tt.input {
+					w.Write([]byte(input))
+				}
+				w.Close()
+			}()
+
+			var got []string
+			for key := range keys {
+				got = append(got, key)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("keys %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadKeysCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	keys := make(chan string)
+	done := make(chan struct{})
+	go func() {
+		readKeys(ctx, strings.NewReader("abc"), keys)
+		close(done)
+	}()
+
+	// Nobody takes the keys any more, the reader must not stay blocked on them
+	<-keys
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("readKeys kept running after cancel")
+	}
+}
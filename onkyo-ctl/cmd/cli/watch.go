@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+)
+
+// Part of the receiver state watched together, queried when watching starts
+type watchGroup struct {
+	name     string
+	commands []string
+	queries  []string
+}
+
+var watchGroups = []watchGroup{
+	{"power", []string{"PWR"}, []string{"PWR"}},
+	{"volume", []string{"MVL", "SWL", "CTL", "TFR"}, []string{"MVL", "SWL"}},
+	{"mute", []string{"AMT"}, []string{"AMT"}},
+	{"input", []string{"SLI", "SLA", "LMD"}, []string{"SLI", "LMD"}},
+	{"tuner", []string{"TUN", "PRS", "RDS", "DSN"}, nil},
+	{"now-playing", []string{"NST", "NTI", "NAT", "NAL", "NTM", "NTR"}, []string{"NST", "NTI", "NAT", "NAL"}},
+	{"signal", []string{"IFA", "IFV"}, []string{"IFA", "IFV"}},
+	{"display", []string{"DIM", "DIF"}, []string{"DIM"}},
+	{"zones", []string{"ZPW", "ZMT", "ZVL", "SLZ", "PW3", "MT3", "VL3", "SL3", "PW4", "MT4", "VL4", "SL4"}, nil},
+}
+
+// Group of the command and its position for sorting, other commands come last
+func watchGroupOf(command string) (string, int) {
+	for i, group := range watchGroups {
+		for _, groupCommand := range group.commands {
+			if groupCommand == command {
+				return group.name, i
+			}
+		}
+	}
+	return "other", len(watchGroups)
+}
+
+// Parses group names and three letter commands given with --only, nil watches everything
+func parseWatchFilter(only []string) (map[string]bool, error) {
+	if len(only) == 0 {
+		return nil, nil
+	}
+	watched := make(map[string]bool)
+	for _, entry := range only {
+		for _, name := range strings.Split(entry, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			found := false
+			for _, group := range watchGroups {
+				if strings.EqualFold(group.name, name) {
+					for _, command := range group.commands {
+						watched[command] = true
+					}
+					found = true
+				}
+			}
+			if !found {
+				if _, ok := eiscp.LookupCommand(name); !ok {
+					return nil, fmt.Errorf("%w: unknown group or command '%s', expected one of %s",
+						eiscp.ErrValidation, name, strings.Join(watchGroupNames(), ", "))
+				}
+				watched[strings.ToUpper(name)] = true
+			}
+		}
+	}
+	return watched, nil
+}
+
+func watchGroupNames() []string {
+	names := make([]string, 0, len(watchGroups))
+	for _, group := range watchGroups {
+		names = append(names, group.name)
+	}
+	return names
+}
+
+// State change as printed in JSON lines and YAML output
+type watchEvent struct {
+	Time  string `json:"time"`
+	Group string `json:"group"`
+	messageOutput
+}
+
+// Latest reported value of a command, for the table
+type watchRow struct {
+	order   int
+	group   string
+	message eiscp.Message
+	since   time.Time
+}
+
+// Prints state changes the receiver reports until the context is done or the connection closes.
+// Repeated reports of the same value are skipped unless all is set. The table is redrawn in place
+// on every change instead of logging it.
+func Watch(ctx context.Context, client *eiscp.EISCPClient, out io.Writer, watched map[string]bool, all, table bool) error {
+	if table && output != OutputText {
+		return fmt.Errorf("%w: the table is only shown with text output", eiscp.ErrValidation)
+	}
+
+	messages, cancel := client.Subscribe()
+	defer cancel()
+
+	// Current state is reported like any change, so the log starts complete
+	model := client.Model()
+	for _, group := range watchGroups {
+		for _, command := range group.queries {
+			if (watched == nil || watched[command]) && model.Supports(command) {
+				client.Enqueue(eiscp.NewQuery(command), eiscp.PriorityLow)
+			}
+		}
+	}
+
+	rows := make(map[string]*watchRow)
+	if table {
+		renderWatchTable(out, model.Name, rows)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case message, ok := <-messages:
+			if !ok {
+				return fmt.Errorf("%w: connection closed", eiscp.ErrConnection)
+			}
+			if watched != nil && !watched[message.Command] {
+				continue
+			}
+			if message.Parameter == eiscp.QueryParameter {
+				continue
+			}
+
+			row, seen := rows[message.Command]
+			if seen && row.message.Parameter == message.Parameter && !all {
+				continue
+			}
+			now := time.Now()
+			group, order := watchGroupOf(message.Command)
+			rows[message.Command] = &watchRow{order: order, group: group, message: message, since: now}
+
+			if table {
+				renderWatchTable(out, model.Name, rows)
+			} else if err := printWatchEvent(out, now, group, message); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// One line per event in every format, so the output can be piped as it comes
+func printWatchEvent(w io.Writer, now time.Time, group string, message eiscp.Message) error {
+	event := watchEvent{Time: now.Format(time.RFC3339Nano), Group: group, messageOutput: newMessageOutput(message)}
+	switch output {
+	case OutputJSON:
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case OutputYAML:
+		// Items of one YAML sequence, growing with every event
+		return encodeYAML(w, []watchEvent{event})
+	}
+	_, err := fmt.Fprintf(w, "%s  %-11s  %s\n", now.Format("15:04:05.000"), group, annotate(message))
+	return err
+}
+
+func renderWatchTable(w io.Writer, model string, rows map[string]*watchRow) {
+	sorted := make([]*watchRow, 0, len(rows))
+	for _, row := range rows {
+		sorted = append(sorted, row)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].order != sorted[j].order {
+			return sorted[i].order < sorted[j].order
+		}
+		return sorted[i].message.Command < sorted[j].message.Command
+	})
+
+	// Cursor home and clear screen
+	fmt.Fprint(w, "\033[H\033[2J")
+	fmt.Fprintf(w, "Watching Onkyo %s, Ctrl+C to quit\n\n", model)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "GROUP\tCOMMAND\tVALUE\tSINCE")
+	for _, row := range sorted {
+		name := row.message.Command
+		value := row.message.Parameter
+		if info, ok := eiscp.LookupCommand(name); ok {
+			name = info.Name
+			if description := info.DescribeParameter(value); description != "" {
+				value = description
+			}
+		}
+		if len(value) > maxChatParameter {
+			value = value[:maxChatParameter] + "…"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", row.group, name, value, row.since.Format("15:04:05"))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp/eiscptest"
+)
+
+func TestParseWatchFilter(t *testing.T) {
+	tests := []struct {
+		name string
+		only []string
+		want []string
+	}{
+		{"everything", nil, nil},
+		{"group", []string{"mute"}, []string{"AMT"}},
+		{"groups and commands", []string{"power,SLI", "Display"}, []string{"DIF", "DIM", "PWR", "SLI"}},
+		{"lower case command", []string{"tun"}, []string{"TUN"}},
+		{"blank entries", []string{" power , ,"}, []string{"PWR"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			watched, err := parseWatchFilter(tt.only)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == nil {
+				if watched != nil {
+					t.Fatalf("watched = %v, want everything", watched)
+				}
+				return
+			}
+			var got []string
+			for command := range watched {
+				got = append(got, command)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("watched = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWatchFilterUnknown(t *testing.T) {
+	for _, only := range []string{"volume,loudness", "XYZ"} {
+		if _, err := parseWatchFilter([]string{only}); !errors.Is(err, eiscp.ErrValidation) {
+			t.Errorf("parseWatchFilter(%q) error = %v, want ErrValidation", only, err)
+		}
+	}
+}
+
+// Buffer read while Watch writes to it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Split(strings.TrimSuffix(b.buf.String(), "\n"), "\n")
+}
+
+// Prints in the format for the test only
+func useOutput(t *testing.T, format OutputFormat) {
+	t.Helper()
+	previous := output
+	output = format
+	t.Cleanup(func() { output = previous })
+}
+
+// Watches until the test ends, returning the output and the error channel
+func startWatch(t *testing.T, client *eiscp.EISCPClient, only []string, all bool) (*syncBuffer, <-chan error) {
+	t.Helper()
+	watched, err := parseWatchFilter(only)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	out := &syncBuffer{}
+	done := make(chan error, 1)
+	finished := make(chan struct{})
+	go func() {
+		done <- Watch(ctx, client, out, watched, all, false)
+		close(finished)
+	}()
+	t.Cleanup(func() {
+		stop()
+		<-finished
+	})
+	return out, done
+}
+
+// Waits for the number of events printed as JSON lines and returns their messages
+func waitEvents(t *testing.T, out *syncBuffer, count int) []watchEvent {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		lines := out.lines()
+		if len(lines) >= count && lines[0] != "" {
+			events := make([]watchEvent, 0, len(lines))
+			for _, line := range lines {
+				var event watchEvent
+				if err := json.Unmarshal([]byte(line), &event); err != nil {
+					t.Fatalf("line %q is not JSON: %v", line, err)
+				}
+				events = append(events, event)
+			}
+			return events
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("printed %q, want %d events", lines, count)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func eventMessages(events []watchEvent) []string {
+	messages := make([]string, 0, len(events))
+	for _, event := range events {
+		messages = append(messages, event.Message)
+	}
+	return messages
+}
+
+func TestWatch(t *testing.T) {
+	tests := []struct {
+		name string
+		all  bool
+		want []string
+	}{
+		{"changes only", false, []string{"MVL1E", "SWL+02", "MVL20"}},
+		{"all reports", true, []string{"MVL1E", "SWL+02", "MVL1E", "MVL20"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useOutput(t, OutputJSON)
+			client, fake := newTestClient(t)
+			fake.Respond("MVLQSTN", "MVL1E")
+			fake.Respond("SWLQSTN", "SWL+02")
+
+			out, _ := startWatch(t, client, []string{"volume"}, tt.all)
+			waitEvents(t, out, 2)
+			// Power is not watched, the volume is reported again unchanged
+			fake.Push("PWR00", "MVL1E", "MVL20")
+
+			events := waitEvents(t, out, len(tt.want))
+			if got := eventMessages(events); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("events %q, want %q", got, tt.want)
+			}
+			last := events[len(events)-1]
+			if last.Group != "volume" || last.Command != "MVL" || last.Parameter != "20" || last.Description == "" {
+				t.Fatalf("last event = %+v, want described MVL20 of the volume group", last)
+			}
+			if _, err := time.Parse(time.RFC3339Nano, last.Time); err != nil {
+				t.Fatalf("event time %q: %v", last.Time, err)
+			}
+		})
+	}
+}
+
+func TestWatchCommandFilter(t *testing.T) {
+	useOutput(t, OutputJSON)
+	client, fake := newTestClient(t)
+	fake.Respond("AMTQSTN", "AMT00")
+
+	out, _ := startWatch(t, client, []string{"mute,TUN"}, false)
+	waitEvents(t, out, 1)
+	fake.Push("MVL20", "TUN10230", "AMT01")
+
+	events := waitEvents(t, out, 3)
+	if got, want := eventMessages(events), []string{"AMT00", "TUN10230", "AMT01"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("events %q, want %q", got, want)
+	}
+}
+
+// Waits until the client wrote the number of messages
+func waitSentCount(t *testing.T, fake *eiscptest.Transport, count int) []string {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		sent := fake.Sent()
+		if len(sent) >= count {
+			return sent
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sent %q, want %d messages", sent, count)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// The current state is asked for with the commands the model supports
+func TestWatchInitialQueries(t *testing.T) {
+	tests := []struct {
+		name  string
+		model string
+		want  []string
+	}{
+		{"unknown model", "", []string{"IFAQSTN", "IFVQSTN", "PWRQSTN"}},
+		{"model without video", "TX-L20D", []string{"IFAQSTN", "PWRQSTN"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useOutput(t, OutputJSON)
+			client, fake := newTestClient(t)
+			if tt.model != "" {
+				if err := client.SetModel(tt.model); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			startWatch(t, client, []string{"signal,power"}, false)
+			sent := waitSentCount(t, fake, len(tt.want))
+			// Nothing else follows
+			time.Sleep(20 * time.Millisecond)
+			sent = fake.Sent()
+			sort.Strings(sent)
+			if !reflect.DeepEqual(sent, tt.want) {
+				t.Fatalf("sent %q, want %q", sent, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchConnectionClosed(t *testing.T) {
+	useOutput(t, OutputJSON)
+	client, fake := newTestClient(t)
+	_, done := startWatch(t, client, []string{"power"}, false)
+	fake.Close()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, eiscp.ErrConnection) {
+			t.Fatalf("error = %v, want ErrConnection", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watch did not end with the connection")
+	}
+}
+
+func TestWatchTableNeedsText(t *testing.T) {
+	useOutput(t, OutputJSON)
+	client, fake := newTestClient(t)
+	err := Watch(context.Background(), client, &syncBuffer{}, nil, false, true)
+	if !errors.Is(err, eiscp.ErrValidation) {
+		t.Fatalf("error = %v, want ErrValidation", err)
+	}
+	assertSentMessages(t, fake)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+)
+
+// Zone the power, volume and source commands control, given by --zone or the context.
+// The main zone goes through the client, other zones are sent their own commands.
+var zone = eiscp.MainZone
+
+func zoneCommands() eiscp.ZoneCommands {
+	commands, _ := eiscp.LookupZone(zone)
+	return commands
+}
+
+func validateZone(name string) error {
+	if _, ok := eiscp.LookupZone(name); !ok {
+		return fmt.Errorf("%w: unknown zone '%s', expected one of %s", eiscp.ErrValidation, name, strings.Join(eiscp.Zones(), ", "))
+	}
+	return nil
+}
+
+// Fails for zones the receiver does not have. Models know their zones once pinned or
+// detected from the device info, any zone goes until then.
+func checkZone() error {
+	if zone == eiscp.MainZone {
+		return nil
+	}
+	if client.Model().Zones == nil {
+		loadDeviceInfo()
+	}
+	if model := client.Model(); !model.HasZone(zone) {
+		return fmt.Errorf("%w: %s has no %s, expected one of %s", eiscp.ErrValidation, model.Name, zone, strings.Join(model.Zones, ", "))
+	}
+	return nil
+}
+
+// Queries the zone command, reporting receivers without the zone as not available
+func zoneQuery(command string) (eiscp.Message, error) {
+	responses, err := client.Exchange(eiscp.NewQuery(command), "", 0)
+	if err != nil {
+		return eiscp.Message{}, err
+	}
+	response := responses[len(responses)-1]
+	if response.Parameter == "N/A" {
+		return eiscp.Message{}, fmt.Errorf("%w: %s is not available", eiscp.ErrNotAvailable, zone)
+	}
+	return response, nil
+}
+
+func zonePower(on bool) error {
+	if zone == eiscp.MainZone {
+		if on {
+			return client.PowerOn()
+		}
+		return client.PowerOff()
+	}
+	if err := checkZone(); err != nil {
+		return err
+	}
+	parameter := "00"
+	if on {
+		parameter = "01"
+	}
+	return client.SendMessage(eiscp.NewMessage(zoneCommands().Power, parameter))
+}
+
+func zoneVolumeStep(up bool) error {
+	if zone == eiscp.MainZone {
+		if up {
+			return client.VolumeUp()
+		}
+		return client.VolumeDown()
+	}
+	if err := checkZone(); err != nil {
+		return err
+	}
+	parameter := "DOWN"
+	if up {
+		parameter = "UP"
+	}
+	return client.SendMessage(eiscp.NewMessage(zoneCommands().Volume, parameter))
+}
+
+// Zone volumes are hex steps like the main one
+func zoneSetVolume(level int) error {
+	if zone == eiscp.MainZone {
+		return client.SetMasterVolume(level)
+	}
+	if err := checkZone(); err != nil {
+		return err
+	}
+	if maxVolume := client.MaxVolume(); level < 0 || level > maxVolume {
+		return fmt.Errorf("%w: volume level %d must be between 0 and %d", eiscp.ErrValidation, level, maxVolume)
+	}
+	return client.SendMessage(eiscp.NewMessage(zoneCommands().Volume, fmt.Sprintf("%02X", level)))
+}
+
+func zoneQueryVolume() (int, error) {
+	if zone == eiscp.MainZone {
+		return client.QueryVolume()
+	}
+	if err := checkZone(); err != nil {
+		return 0, err
+	}
+	response, err := zoneQuery(zoneCommands().Volume)
+	if err != nil {
+		return 0, err
+	}
+	level, err := strconv.ParseInt(response.Parameter, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid volume level '%s'", eiscp.ErrValidation, response.Parameter)
+	}
+	return int(level), nil
+}
+
+// Zone selectors take the same input codes as the main one
+func zoneSetInput(input string) error {
+	if zone == eiscp.MainZone {
+		return client.SetInputSelector(input)
+	}
+	if err := checkZone(); err != nil {
+		return err
+	}
+	code, ok := client.InputCode(input)
+	if !ok {
+		return fmt.Errorf("%w: invalid input selector '%s'", eiscp.ErrValidation, input)
+	}
+	return client.SendMessage(eiscp.NewMessage(zoneCommands().Input, code))
+}
+
+func zoneQueryInput() (string, error) {
+	if zone == eiscp.MainZone {
+		return client.QueryInputSelector()
+	}
+	if err := checkZone(); err != nil {
+		return "", err
+	}
+	response, err := zoneQuery(zoneCommands().Input)
+	if err != nil {
+		return "", err
+	}
+	if name, ok := client.InputName(response.Parameter); ok {
+		return name, nil
+	}
+	return "", fmt.Errorf("%w: unknown input code '%s'", eiscp.ErrValidation, response.Parameter)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp/eiscptest"
+)
+
+// Points the commands at a test client and the zone, for the test only
+func useZone(t *testing.T, name string) *eiscptest.Transport {
+	t.Helper()
+	fake := useClient(t)
+	previous := zone
+	zone = name
+	t.Cleanup(func() { zone = previous })
+	return fake
+}
+
+func TestZonePowerMissingZone(t *testing.T) {
+	fake := useZone(t, "zone2")
+	if err := client.SetModel("TX-L20D"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := zonePower(true); !errors.Is(err, eiscp.ErrValidation) {
+		t.Fatalf("zonePower() error = %v, want ErrValidation", err)
+	}
+	assertSentMessages(t, fake)
+}
+
+func TestZonePowerModelZone(t *testing.T) {
+	fake := useZone(t, "zone2")
+	if err := client.SetModel("TX-NR696"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := zonePower(true); err != nil {
+		t.Fatal(err)
+	}
+	assertSentMessages(t, fake, "ZPW01")
+}
+
+// Receivers not telling their zones get any zone
+func TestZonePowerUnknownModel(t *testing.T) {
+	fake := useZone(t, "zone3")
+
+	if err := zonePower(false); err != nil {
+		t.Fatal(err)
+	}
+	assertSentMessages(t, fake, "NRIQSTN", "PW300")
+}
@@ -3,11 +3,9 @@ module github.com/mtyszkiewicz/eiscp
 go 1.19
 
 require (
+	github.com/chzyer/readline v1.5.1
 	github.com/go-chi/chi/v5 v5.0.12
 	github.com/urfave/cli/v3 v3.0.0-beta1
-)
-
-require (
-	github.com/chzyer/readline v1.5.1 // indirect
-	golang.org/x/sys v0.0.0-20220310020820-b874c991c1a5 // indirect
+	golang.org/x/sys v0.0.0-20220310020820-b874c991c1a5
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,64 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Reads the bytes of a hex dump, as printed by xxd, hexdump -C, tcpdump -X,
+// Wireshark or as plain hex. Offsets, ASCII columns and lines starting with #
+// are ignored.
+func ParseHexDump(r io.Reader) ([]byte, error) {
+	var data []byte
+	// hexdump -C ends with a line holding only the offset past the data
+	hexdumpC := false
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxCaptureSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		// hexdump -C puts the ASCII column between bars
+		barred := false
+		if i := strings.Index(text, "|"); i >= 0 {
+			text, barred, hexdumpC = text[:i], true, true
+		} else if hexdumpC && len(strings.Fields(text)) == 1 {
+			continue
+		}
+
+		// Offsets end with a colon, or are set apart by at least two spaces
+		if fields := strings.Fields(text); len(fields) > 1 {
+			first := fields[0]
+			rest := strings.TrimPrefix(text, first)
+			if strings.HasSuffix(first, ":") || barred || strings.HasPrefix(rest, "  ") {
+				text = strings.TrimLeft(rest, " \t")
+			}
+		}
+		// Other dumps put the ASCII column after two spaces
+		if i := strings.Index(text, "  "); i >= 0 && !barred {
+			text = text[:i]
+		}
+
+		var digits strings.Builder
+		for _, field := range strings.FieldsFunc(text, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ','
+		}) {
+			field = strings.TrimPrefix(strings.TrimPrefix(field, "0x"), "0X")
+			digits.WriteString(field)
+		}
+		decoded, err := hex.DecodeString(digits.String())
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid hex on line %d: %v", ErrUnsupportedFormat, line, err)
+		}
+		data = append(data, decoded...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read hex dump: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,64 @@
+package capture_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/capture"
+)
+
+// "!1MVL1E" answer of the receiver, as dumped in testdata/mvl.*.txt
+var mvlPacket = []byte("ISCP\x00\x00\x00\x10\x00\x00\x00\x0a\x01\x00\x00\x00!1MVL1E\x1a\r\n")
+
+func TestParseHexDump(t *testing.T) {
+	for _, name := range []string{"xxd", "hexdump", "tcpdump", "wireshark", "plain"} {
+		t.Run(name, func(t *testing.T) {
+			file, err := os.Open("testdata/mvl." + name + ".txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			data, err := capture.ParseHexDump(file)
+			if err != nil {
+				t.Fatalf("ParseHexDump: %v", err)
+			}
+			if !bytes.Equal(data, mvlPacket) {
+				t.Fatalf("parsed % x, want % x", data, mvlPacket)
+			}
+		})
+	}
+}
+
+func TestParseHexDumpInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		dump string
+		line string
+	}{
+		{"not hex", "4953 4350\nhello world\n", "line 2"},
+		{"odd digits", "495\n", "line 1"},
+		{"after comments", "# dump\n\n00000000: 4953 43zz  ISC.\n", "line 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := capture.ParseHexDump(strings.NewReader(tt.dump))
+			if !errors.Is(err, capture.ErrUnsupportedFormat) {
+				t.Fatalf("error = %v, want ErrUnsupportedFormat", err)
+			}
+			if !strings.Contains(err.Error(), tt.line) {
+				t.Fatalf("error %q does not name %s", err, tt.line)
+			}
+		})
+	}
+}
+
+func TestParseHexDumpEmpty(t *testing.T) {
+	data, err := capture.ParseHexDump(strings.NewReader("# nothing\n\n"))
+	if err != nil || len(data) != 0 {
+		t.Fatalf("ParseHexDump = % x, %v, want nothing", data, err)
+	}
+}
@@ -0,0 +1,228 @@
+// Package capture reads network captures and hex dumps of eISCP traffic
+// for offline decoding.
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported capture format")
+
+// Packet as captured, with the link type needed to decode it
+type Packet struct {
+	Time     time.Time
+	LinkType uint32
+	Data     []byte
+}
+
+const (
+	pcapMagicMicro  = 0xa1b2c3d4
+	pcapMagicNano   = 0xa1b23c4d
+	pcapngMagic     = 0x0a0d0d0a
+	pcapngByteOrder = 0x1a2b3c4d
+
+	// Largest block or packet we agree to allocate
+	maxCaptureSize = 16 << 20
+)
+
+// Reports whether the header starts a pcap or pcapng file
+func IsPcap(header []byte) bool {
+	if len(header) < 4 {
+		return false
+	}
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		switch order.Uint32(header) {
+		case pcapMagicMicro, pcapMagicNano, pcapngMagic:
+			return true
+		}
+	}
+	return false
+}
+
+// Reads all packets of a pcap or pcapng file
+func ReadPackets(r io.Reader) ([]Packet, error) {
+	reader := bufio.NewReader(r)
+	header, err := reader.Peek(4)
+	if err != nil || !IsPcap(header) {
+		return nil, fmt.Errorf("%w: not a pcap or pcapng file", ErrUnsupportedFormat)
+	}
+	if binary.BigEndian.Uint32(header) == pcapngMagic {
+		return readPcapng(reader)
+	}
+	return readPcap(reader)
+}
+
+// Classic libpcap format: global header followed by records
+func readPcap(r io.Reader) ([]Packet, error) {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("%w: pcap header cut short", ErrUnsupportedFormat)
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if magic := binary.BigEndian.Uint32(header); magic == pcapMagicMicro || magic == pcapMagicNano {
+		order = binary.BigEndian
+	}
+	nano := order.Uint32(header) == pcapMagicNano
+	linkType := order.Uint32(header[20:]) & 0x0fffffff
+
+	var packets []Packet
+	record := make([]byte, 16)
+	for {
+		if _, err := io.ReadFull(r, record); err == io.EOF {
+			return packets, nil
+		} else if err != nil {
+			return packets, fmt.Errorf("pcap record header cut short after %d packets", len(packets))
+		}
+
+		seconds := int64(order.Uint32(record[0:]))
+		fraction := int64(order.Uint32(record[4:]))
+		length := order.Uint32(record[8:])
+		if length > maxCaptureSize {
+			return packets, fmt.Errorf("pcap record of %d bytes is too large", length)
+		}
+		if !nano {
+			fraction *= int64(time.Microsecond)
+		}
+
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return packets, fmt.Errorf("pcap record cut short after %d packets", len(packets))
+		}
+		packets = append(packets, Packet{Time: time.Unix(seconds, fraction), LinkType: linkType, Data: data})
+	}
+}
+
+// Interface of a pcapng section, packets refer to it by index
+type pcapngInterface struct {
+	linkType uint32
+	// Timestamp units per second
+	resolution uint64
+}
+
+// Next generation format: blocks, each section with its own byte order and interfaces
+func readPcapng(r io.Reader) ([]Packet, error) {
+	var packets []Packet
+	var order binary.ByteOrder = binary.LittleEndian
+	var interfaces []pcapngInterface
+
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err == io.EOF {
+			return packets, nil
+		} else if err != nil {
+			return packets, fmt.Errorf("pcapng block header cut short after %d packets", len(packets))
+		}
+
+		blockType := order.Uint32(header)
+		if binary.BigEndian.Uint32(header) == pcapngMagic {
+			// Section header tells the byte order for everything up to the next one
+			blockType = pcapngMagic
+			magic := make([]byte, 4)
+			if _, err := io.ReadFull(r, magic); err != nil {
+				return packets, fmt.Errorf("pcapng section header cut short")
+			}
+			order = binary.LittleEndian
+			if binary.BigEndian.Uint32(magic) == pcapngByteOrder {
+				order = binary.BigEndian
+			}
+			interfaces = nil
+			header = append(header[:8], magic...)
+		}
+
+		length := order.Uint32(header[4:8])
+		if length < 12 || length%4 != 0 || length > maxCaptureSize {
+			return packets, fmt.Errorf("%w: invalid pcapng block length %d", ErrUnsupportedFormat, length)
+		}
+		// Body without the type, the length and the trailing length copy
+		body := make([]byte, int(length)-12)
+		read := len(header) - 8
+		copy(body, header[8:])
+		if _, err := io.ReadFull(r, body[read:]); err != nil {
+			return packets, fmt.Errorf("pcapng block cut short after %d packets", len(packets))
+		}
+		if _, err := io.ReadFull(r, make([]byte, 4)); err != nil {
+			return packets, fmt.Errorf("pcapng block cut short after %d packets", len(packets))
+		}
+		header = header[:8]
+
+		switch blockType {
+		case 1: // Interface description
+			if len(body) < 8 {
+				continue
+			}
+			interfaces = append(interfaces, pcapngInterface{
+				linkType:   uint32(order.Uint16(body[0:])),
+				resolution: pcapngResolution(order, body[8:]),
+			})
+		case 6: // Enhanced packet
+			if len(body) < 20 {
+				continue
+			}
+			index := order.Uint32(body[0:])
+			if int(index) >= len(interfaces) {
+				continue
+			}
+			timestamp := uint64(order.Uint32(body[4:]))<<32 | uint64(order.Uint32(body[8:]))
+			captured := order.Uint32(body[12:])
+			if int(captured) > len(body)-20 {
+				continue
+			}
+			iface := interfaces[index]
+			packets = append(packets, Packet{
+				Time:     pcapngTime(timestamp, iface.resolution),
+				LinkType: iface.linkType,
+				Data:     body[20 : 20+captured],
+			})
+		case 3: // Simple packet, without timestamp
+			if len(body) < 4 || len(interfaces) == 0 {
+				continue
+			}
+			captured := order.Uint32(body[0:])
+			if int(captured) > len(body)-4 {
+				captured = uint32(len(body) - 4)
+			}
+			packets = append(packets, Packet{LinkType: interfaces[0].linkType, Data: body[4 : 4+captured]})
+		}
+	}
+}
+
+// Finds the if_tsresol option, microseconds by default
+func pcapngResolution(order binary.ByteOrder, options []byte) uint64 {
+	for len(options) >= 4 {
+		code := order.Uint16(options[0:])
+		length := int(order.Uint16(options[2:]))
+		if code == 0 || len(options) < 4+length {
+			break
+		}
+		if code == 9 && length >= 1 {
+			value := options[4]
+			resolution := uint64(1)
+			for i := 0; i < int(value&0x7f); i++ {
+				if value&0x80 != 0 {
+					resolution *= 2
+				} else {
+					resolution *= 10
+				}
+			}
+			return resolution
+		}
+		// Options are padded to 32 bits
+		options = options[4+(length+3)/4*4:]
+	}
+	return 1000000
+}
+
+func pcapngTime(timestamp, resolution uint64) time.Time {
+	if resolution == 0 {
+		resolution = 1000000
+	}
+	seconds := timestamp / resolution
+	fraction := timestamp % resolution
+	return time.Unix(int64(seconds), int64(fraction*uint64(time.Second)/resolution))
+}
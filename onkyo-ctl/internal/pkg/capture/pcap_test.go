@@ -0,0 +1,152 @@
+package capture_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/capture"
+)
+
+// Fixtures under testdata, crafted byte by byte to keep them small:
+//   - session.pcap: Ethernet, IPv4, a client asking for the volume and the receiver answering
+//     out of order, retransmitting and overlapping, with a UDP broadcast in between
+//   - session.pcapng: the same packets with nanosecond timestamps and blocks to skip
+//   - lost.pcap: two answers with five bytes between them missing
+//   - ipv6.pcap: big endian nanosecond pcap of raw IPv6 with a hop-by-hop header
+var captureStart = time.Unix(1714595507, 0)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func readPackets(t *testing.T, name string) []capture.Packet {
+	t.Helper()
+	packets, err := capture.ReadPackets(bytes.NewReader(readFixture(t, name)))
+	if err != nil {
+		t.Fatalf("ReadPackets(%s): %v", name, err)
+	}
+	return packets
+}
+
+func TestIsPcap(t *testing.T) {
+	tests := []struct {
+		header []byte
+		want   bool
+	}{
+		{[]byte{0xd4, 0xc3, 0xb2, 0xa1}, true},
+		{[]byte{0xa1, 0xb2, 0xc3, 0xd4}, true},
+		{[]byte{0x4d, 0x3c, 0xb2, 0xa1}, true},
+		{[]byte{0x0a, 0x0d, 0x0d, 0x0a, 0x1c}, true},
+		{[]byte("ISCP"), false},
+		{[]byte{0xd4, 0xc3, 0xb2}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := capture.IsPcap(tt.header); got != tt.want {
+			t.Errorf("IsPcap(% x) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestReadPackets(t *testing.T) {
+	tests := []struct {
+		file     string
+		count    int
+		linkType uint32
+		// Packets are a millisecond apart in every fixture
+		step time.Duration
+	}{
+		{"session.pcap", 10, capture.LinkTypeEthernet, time.Millisecond},
+		{"session.pcapng", 10, capture.LinkTypeEthernet, time.Millisecond},
+		{"lost.pcap", 2, capture.LinkTypeEthernet, time.Millisecond},
+		{"ipv6.pcap", 2, capture.LinkTypeRaw, time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			packets := readPackets(t, tt.file)
+			if len(packets) != tt.count {
+				t.Fatalf("read %d packets, want %d", len(packets), tt.count)
+			}
+			for i, packet := range packets {
+				if packet.LinkType != tt.linkType {
+					t.Errorf("packet %d link type %d, want %d", i, packet.LinkType, tt.linkType)
+				}
+				if want := captureStart.Add(time.Duration(i) * tt.step); !packet.Time.Equal(want) {
+					t.Errorf("packet %d time %v, want %v", i, packet.Time, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReadPacketsPcapngMatchesPcap(t *testing.T) {
+	pcap := readPackets(t, "session.pcap")
+	pcapng := readPackets(t, "session.pcapng")
+	if len(pcap) != len(pcapng) {
+		t.Fatalf("%d packets in pcap, %d in pcapng", len(pcap), len(pcapng))
+	}
+	for i := range pcap {
+		if !bytes.Equal(pcap[i].Data, pcapng[i].Data) {
+			t.Errorf("packet %d differs:\n% x\n% x", i, pcap[i].Data, pcapng[i].Data)
+		}
+	}
+}
+
+// Copy of the fixture with a 32 bit value replaced
+func patched(data []byte, offset int, order binary.ByteOrder, value uint32) []byte {
+	data = append([]byte(nil), data...)
+	order.PutUint32(data[offset:], value)
+	return data
+}
+
+func TestReadPacketsMalformed(t *testing.T) {
+	pcap := readFixture(t, "session.pcap")
+	pcapng := readFixture(t, "session.pcapng")
+	const firstRecord = 24
+	// The pcapng fixture ends with a 36 byte packet block of an unknown interface
+	const lastPcapngBlock = 36
+
+	tests := []struct {
+		name string
+		data []byte
+		// Packets read before the damage, still returned
+		packets     int
+		unsupported bool
+	}{
+		{"empty", nil, 0, true},
+		{"not a capture", []byte("ISCP\x00\x00\x00\x10"), 0, true},
+		{"pcap header cut short", pcap[:20], 0, true},
+		{"pcap record header cut short", pcap[:firstRecord+8], 0, false},
+		{"pcap record cut short", pcap[:len(pcap)-5], 9, false},
+		{"pcap record too large", patched(pcap, firstRecord+8, binary.LittleEndian, 0xffffffff), 0, false},
+		{"pcapng section header cut short", pcapng[:10], 0, false},
+		{"pcapng block cut short", pcapng[:len(pcapng)-lastPcapngBlock-30], 9, false},
+		{"pcapng trailing length missing", pcapng[:len(pcapng)-2], 10, false},
+		{"pcapng block length not aligned", patched(pcapng, 4, binary.LittleEndian, 30), 0, true},
+		{"pcapng block length too small", patched(pcapng, 4, binary.LittleEndian, 8), 0, true},
+		{"pcapng block length too large", patched(pcapng, 4, binary.LittleEndian, 1<<30), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packets, err := capture.ReadPackets(bytes.NewReader(tt.data))
+			if err == nil {
+				t.Fatal("no error")
+			}
+			if errors.Is(err, capture.ErrUnsupportedFormat) != tt.unsupported {
+				t.Fatalf("error %v, want ErrUnsupportedFormat %v", err, tt.unsupported)
+			}
+			if len(packets) != tt.packets {
+				t.Fatalf("returned %d packets, want %d", len(packets), tt.packets)
+			}
+		})
+	}
+}
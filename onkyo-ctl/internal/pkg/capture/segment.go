@@ -0,0 +1,164 @@
+package capture
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"time"
+)
+
+// Link types we know how to decode
+const (
+	LinkTypeNull        = 0
+	LinkTypeEthernet    = 1
+	LinkTypeRaw         = 101
+	LinkTypeLoop        = 108
+	LinkTypeLinuxSLL    = 113
+	LinkTypePktapDarwin = 149
+	LinkTypeIPv4        = 228
+	LinkTypeIPv6        = 229
+	LinkTypePktap       = 258
+	LinkTypeLinuxSLL2   = 276
+)
+
+// Segment is a TCP segment carried by a captured packet
+type Segment struct {
+	Time    time.Time
+	Src     netip.AddrPort
+	Dst     netip.AddrPort
+	Seq     uint32
+	SYN     bool
+	FIN     bool
+	RST     bool
+	Payload []byte
+}
+
+// Decodes the TCP segment of the packet. Anything else, including IP fragments,
+// reports false.
+func DecodeSegment(packet Packet) (Segment, bool) {
+	ip, ok := linkPayload(packet.LinkType, packet.Data)
+	if !ok {
+		return Segment{}, false
+	}
+	src, dst, tcp, ok := ipPayload(ip)
+	if !ok || len(tcp) < 20 {
+		return Segment{}, false
+	}
+
+	offset := int(tcp[12]>>4) * 4
+	if offset < 20 || offset > len(tcp) {
+		return Segment{}, false
+	}
+	flags := tcp[13]
+	return Segment{
+		Time:    packet.Time,
+		Src:     netip.AddrPortFrom(src, binary.BigEndian.Uint16(tcp[0:])),
+		Dst:     netip.AddrPortFrom(dst, binary.BigEndian.Uint16(tcp[2:])),
+		Seq:     binary.BigEndian.Uint32(tcp[4:]),
+		FIN:     flags&0x01 != 0,
+		SYN:     flags&0x02 != 0,
+		RST:     flags&0x04 != 0,
+		Payload: tcp[offset:],
+	}, true
+}
+
+// Strips the link layer, leaving the IP packet
+func linkPayload(linkType uint32, data []byte) ([]byte, bool) {
+	switch linkType {
+	case LinkTypeEthernet:
+		if len(data) < 14 {
+			return nil, false
+		}
+		etherType := binary.BigEndian.Uint16(data[12:])
+		data = data[14:]
+		// VLAN tags, possibly stacked
+		for (etherType == 0x8100 || etherType == 0x88a8) && len(data) >= 4 {
+			etherType = binary.BigEndian.Uint16(data[2:])
+			data = data[4:]
+		}
+		return data, etherType == 0x0800 || etherType == 0x86dd
+	case LinkTypeNull, LinkTypeLoop:
+		// Address family in host or network byte order
+		if len(data) < 4 {
+			return nil, false
+		}
+		return data[4:], true
+	case LinkTypeRaw, LinkTypeIPv4, LinkTypeIPv6:
+		return data, true
+	case LinkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil, false
+		}
+		return data[16:], true
+	case LinkTypeLinuxSLL2:
+		if len(data) < 20 {
+			return nil, false
+		}
+		return data[20:], true
+	case LinkTypePktap, LinkTypePktapDarwin:
+		// Apple packet tap, used by rvictl for iOS devices, wraps another link type
+		if len(data) < 8 {
+			return nil, false
+		}
+		length := binary.LittleEndian.Uint32(data[0:])
+		if length < 8 || int(length) > len(data) {
+			return nil, false
+		}
+		return linkPayload(binary.LittleEndian.Uint32(data[4:]), data[length:])
+	}
+	return nil, false
+}
+
+// Strips the IP header, leaving the TCP segment
+func ipPayload(data []byte) (src, dst netip.Addr, payload []byte, ok bool) {
+	if len(data) < 1 {
+		return src, dst, nil, false
+	}
+	switch data[0] >> 4 {
+	case 4:
+		if len(data) < 20 {
+			return src, dst, nil, false
+		}
+		headerLength := int(data[0]&0x0f) * 4
+		totalLength := int(binary.BigEndian.Uint16(data[2:]))
+		fragment := binary.BigEndian.Uint16(data[6:])
+		if headerLength < 20 || totalLength < headerLength || data[9] != 6 || fragment&0x3fff != 0 {
+			return src, dst, nil, false
+		}
+		// Ethernet pads short frames, captures may cut long ones
+		if totalLength < len(data) {
+			data = data[:totalLength]
+		}
+		if headerLength > len(data) {
+			return src, dst, nil, false
+		}
+		src, _ = netip.AddrFromSlice(data[12:16])
+		dst, _ = netip.AddrFromSlice(data[16:20])
+		return src, dst, data[headerLength:], true
+	case 6:
+		if len(data) < 40 {
+			return src, dst, nil, false
+		}
+		payloadLength := int(binary.BigEndian.Uint16(data[4:]))
+		next := data[6]
+		src, _ = netip.AddrFromSlice(data[8:24])
+		dst, _ = netip.AddrFromSlice(data[24:40])
+		data = data[40:]
+		if payloadLength < len(data) {
+			data = data[:payloadLength]
+		}
+		// Hop-by-hop, routing and destination options may precede TCP, fragments are not reassembled
+		for next == 0 || next == 43 || next == 60 {
+			if len(data) < 8 {
+				return src, dst, nil, false
+			}
+			length := (int(data[1]) + 1) * 8
+			if length > len(data) {
+				return src, dst, nil, false
+			}
+			next = data[0]
+			data = data[length:]
+		}
+		return src, dst, data, next == 6
+	}
+	return src, dst, nil, false
+}
@@ -0,0 +1,147 @@
+package capture_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"testing"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/capture"
+)
+
+var (
+	client   = netip.MustParseAddrPort("192.168.1.10:50000")
+	receiver = netip.MustParseAddrPort("192.168.1.20:60128")
+)
+
+// eISCP packet of "!1MVLQSTN\r" the client sends in the fixtures
+var queryPacket = []byte("ISCP\x00\x00\x00\x10\x00\x00\x00\x0a\x01\x00\x00\x00!1MVLQSTN\r")
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestDecodeSegment(t *testing.T) {
+	packets := readPackets(t, "session.pcap")
+
+	syn, ok := capture.DecodeSegment(packets[0])
+	if !ok || !syn.SYN || syn.FIN || syn.Src != client || syn.Dst != receiver || syn.Seq != 1000 {
+		t.Fatalf("SYN = %+v, %v", syn, ok)
+	}
+	// Ethernet padding is not payload
+	if len(syn.Payload) != 0 {
+		t.Fatalf("SYN payload % x", syn.Payload)
+	}
+
+	query, ok := capture.DecodeSegment(packets[3])
+	if !ok || query.SYN || query.Seq != 1001 || !bytes.Equal(query.Payload, queryPacket) {
+		t.Fatalf("query = %+v, %v", query, ok)
+	}
+	if !query.Time.Equal(packets[3].Time) {
+		t.Fatalf("time %v, want %v", query.Time, packets[3].Time)
+	}
+
+	fin, ok := capture.DecodeSegment(packets[9])
+	if !ok || !fin.FIN || fin.RST {
+		t.Fatalf("FIN = %+v, %v", fin, ok)
+	}
+
+	if _, ok := capture.DecodeSegment(packets[7]); ok {
+		t.Fatal("UDP broadcast decoded as TCP")
+	}
+}
+
+func TestDecodeSegmentIPv6(t *testing.T) {
+	packets := readPackets(t, "ipv6.pcap")
+	segment, ok := capture.DecodeSegment(packets[1])
+	if !ok {
+		t.Fatal("segment behind hop-by-hop header not decoded")
+	}
+	if segment.Src != netip.MustParseAddrPort("[fd00::10]:50001") || segment.Dst.Port() != 60128 {
+		t.Fatalf("segment %s -> %s", segment.Src, segment.Dst)
+	}
+	if !bytes.Equal(segment.Payload, queryPacket) {
+		t.Fatalf("payload % x", segment.Payload)
+	}
+}
+
+func TestDecodeSegmentLinkTypes(t *testing.T) {
+	frame := readPackets(t, "session.pcap")[3].Data
+	macs, ip := frame[:12], frame[14:]
+	pktap := make([]byte, 108)
+	binary.LittleEndian.PutUint32(pktap[0:], 108)
+	binary.LittleEndian.PutUint32(pktap[4:], capture.LinkTypeEthernet)
+
+	tests := []struct {
+		name     string
+		linkType uint32
+		data     []byte
+	}{
+		{"raw", capture.LinkTypeRaw, ip},
+		{"ipv4", capture.LinkTypeIPv4, ip},
+		{"null", capture.LinkTypeNull, concat([]byte{2, 0, 0, 0}, ip)},
+		{"loop", capture.LinkTypeLoop, concat([]byte{0, 0, 0, 2}, ip)},
+		{"linux cooked", capture.LinkTypeLinuxSLL, concat(make([]byte, 16), ip)},
+		{"linux cooked v2", capture.LinkTypeLinuxSLL2, concat(make([]byte, 20), ip)},
+		{"vlan", capture.LinkTypeEthernet, concat(macs, []byte{0x81, 0x00, 0, 5, 0x08, 0x00}, ip)},
+		{"stacked vlan", capture.LinkTypeEthernet, concat(macs, []byte{0x88, 0xa8, 0, 5, 0x81, 0x00, 0, 6, 0x08, 0x00}, ip)},
+		{"pktap", capture.LinkTypePktap, concat(pktap, frame)},
+		{"darwin pktap", capture.LinkTypePktapDarwin, concat(pktap, frame)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segment, ok := capture.DecodeSegment(capture.Packet{LinkType: tt.linkType, Data: tt.data})
+			if !ok {
+				t.Fatal("not decoded")
+			}
+			if segment.Src != client || !bytes.Equal(segment.Payload, queryPacket) {
+				t.Fatalf("segment %+v", segment)
+			}
+		})
+	}
+}
+
+func TestDecodeSegmentMalformed(t *testing.T) {
+	frame := readPackets(t, "session.pcap")[3].Data
+	ip := frame[14:]
+
+	fragment := append([]byte(nil), ip...)
+	fragment[6] |= 0x20
+	shortOffset := append([]byte(nil), ip...)
+	shortOffset[20+12] = 4 << 4
+	longOffset := append([]byte(nil), ip...)
+	longOffset[20+12] = 15 << 4
+	pktap := make([]byte, 8)
+	binary.LittleEndian.PutUint32(pktap, 200)
+
+	ipv6 := readPackets(t, "ipv6.pcap")[1].Data
+
+	tests := []struct {
+		name     string
+		linkType uint32
+		data     []byte
+	}{
+		{"unknown link type", 999, frame},
+		{"ethernet cut short", capture.LinkTypeEthernet, frame[:10]},
+		{"not ip", capture.LinkTypeEthernet, concat(frame[:12], []byte{0x08, 0x06}, ip)},
+		{"empty ip", capture.LinkTypeRaw, nil},
+		{"ip version 5", capture.LinkTypeRaw, concat([]byte{0x55}, ip[1:])},
+		{"ipv4 header cut short", capture.LinkTypeRaw, ip[:15]},
+		{"ipv4 fragment", capture.LinkTypeRaw, fragment},
+		{"tcp header cut short", capture.LinkTypeRaw, ip[:30]},
+		{"tcp data offset too small", capture.LinkTypeRaw, shortOffset},
+		{"tcp data offset past the end", capture.LinkTypeRaw, longOffset[:60]},
+		{"ipv6 header cut short", capture.LinkTypeRaw, ipv6[:30]},
+		{"ipv6 extension cut short", capture.LinkTypeRaw, ipv6[:44]},
+		{"null cut short", capture.LinkTypeNull, []byte{2, 0}},
+		{"linux cooked cut short", capture.LinkTypeLinuxSLL, make([]byte, 10)},
+		{"pktap header past the end", capture.LinkTypePktap, pktap},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if segment, ok := capture.DecodeSegment(capture.Packet{LinkType: tt.linkType, Data: tt.data}); ok {
+				t.Fatalf("decoded %+v", segment)
+			}
+		})
+	}
+}
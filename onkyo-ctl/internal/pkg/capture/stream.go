@@ -0,0 +1,160 @@
+package capture
+
+import (
+	"net/netip"
+	"sort"
+	"time"
+)
+
+// Stream is one direction of a TCP connection, with its data put back in order
+type Stream struct {
+	Src  netip.AddrPort
+	Dst  netip.AddrPort
+	Data []byte
+	// Ranges of data lost from the capture, the data after them is kept anyway
+	Gaps int
+
+	chunks []chunk
+}
+
+// Stretch of data captured at once
+type chunk struct {
+	offset int
+	time   time.Time
+}
+
+// Time the byte at the offset was captured
+func (s *Stream) TimeAt(offset int) time.Time {
+	i := sort.Search(len(s.chunks), func(i int) bool {
+		return s.chunks[i].offset > offset
+	})
+	if i == 0 {
+		return time.Time{}
+	}
+	return s.chunks[i-1].time
+}
+
+func (s *Stream) append(segment Segment, payload []byte) {
+	if len(payload) == 0 {
+		return
+	}
+	s.chunks = append(s.chunks, chunk{offset: len(s.Data), time: segment.Time})
+	s.Data = append(s.Data, payload...)
+}
+
+// Direction of a connection being reassembled
+type flow struct {
+	stream  *Stream
+	next    uint32
+	pending []Segment
+}
+
+// Appends the segment if it continues the stream, trimming what was already seen.
+// Reports false for segments from the future.
+func (f *flow) accept(segment Segment) bool {
+	ahead := int32(segment.Seq - f.next)
+	if ahead > 0 {
+		return false
+	}
+	// Retransmitted or overlapping data
+	seen := int(-ahead)
+	if seen >= len(segment.Payload) {
+		return true
+	}
+	f.stream.append(segment, segment.Payload[seen:])
+	f.next += uint32(len(segment.Payload) - seen)
+	return true
+}
+
+// Appends pending segments that became contiguous
+func (f *flow) drain() {
+	for accepted := true; accepted; {
+		accepted = false
+		for i, segment := range f.pending {
+			if f.accept(segment) {
+				f.pending = append(f.pending[:i], f.pending[i+1:]...)
+				accepted = true
+				break
+			}
+		}
+	}
+}
+
+// Appends whatever is left after lost segments, noting the gaps
+func (f *flow) flush() {
+	for len(f.pending) > 0 {
+		f.drain()
+		if len(f.pending) == 0 {
+			break
+		}
+		sort.Slice(f.pending, func(i, j int) bool {
+			return int32(f.pending[i].Seq-f.pending[j].Seq) < 0
+		})
+		f.stream.Gaps++
+		f.next = f.pending[0].Seq
+	}
+}
+
+type flowKey struct {
+	src netip.AddrPort
+	dst netip.AddrPort
+}
+
+// Puts TCP segments to and from the port back in order, one stream per direction
+// of each connection. Streams are ordered by their first data.
+func Reassemble(segments []Segment, port uint16) []*Stream {
+	flows := make(map[flowKey]*flow)
+	var streams []*Stream
+
+	start := func(key flowKey, next uint32) *flow {
+		if f, ok := flows[key]; ok {
+			f.flush()
+		}
+		f := &flow{stream: &Stream{Src: key.src, Dst: key.dst}, next: next}
+		flows[key] = f
+		streams = append(streams, f.stream)
+		return f
+	}
+
+	for _, segment := range segments {
+		if segment.Src.Port() != port && segment.Dst.Port() != port {
+			continue
+		}
+		key := flowKey{src: segment.Src, dst: segment.Dst}
+		f, ok := flows[key]
+		switch {
+		case segment.SYN && (!ok || len(f.stream.Data) > 0 || f.next != segment.Seq+1):
+			// New connection, possibly reusing the ports of an old one
+			start(key, segment.Seq+1)
+			continue
+		case !ok:
+			// Connection established before the capture started
+			f = start(key, segment.Seq)
+		}
+
+		if len(segment.Payload) == 0 {
+			continue
+		}
+		if !f.accept(segment) {
+			f.pending = append(f.pending, segment)
+			continue
+		}
+		f.drain()
+	}
+
+	for _, f := range flows {
+		f.flush()
+	}
+
+	// Streams without data are only handshakes
+	withData := streams[:0]
+	for _, stream := range streams {
+		if len(stream.Data) > 0 {
+			withData = append(withData, stream)
+		}
+	}
+	sort.SliceStable(withData, func(i, j int) bool {
+		return withData[i].chunks[0].time.Before(withData[j].chunks[0].time)
+	})
+	return withData
+}
@@ -0,0 +1,142 @@
+package capture_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/capture"
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+)
+
+// eISCP packet of "!1PWR01" the receiver sends after the volume in the fixtures
+var powerPacket = []byte("ISCP\x00\x00\x00\x10\x00\x00\x00\x0a\x01\x00\x00\x00!1PWR01\x1a\r\n")
+
+func readSegments(t *testing.T, name string) []capture.Segment {
+	t.Helper()
+	var segments []capture.Segment
+	for _, packet := range readPackets(t, name) {
+		if segment, ok := capture.DecodeSegment(packet); ok {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+func TestReassembleCaptures(t *testing.T) {
+	for _, name := range []string{"session.pcap", "session.pcapng"} {
+		t.Run(name, func(t *testing.T) {
+			streams := capture.Reassemble(readSegments(t, name), 60128)
+			if len(streams) != 2 {
+				t.Fatalf("%d streams, want 2", len(streams))
+			}
+
+			sent, received := streams[0], streams[1]
+			if sent.Src != client || sent.Dst != receiver || !bytes.Equal(sent.Data, queryPacket) {
+				t.Fatalf("first stream %s -> %s: % x", sent.Src, sent.Dst, sent.Data)
+			}
+			// Out of order, retransmitted and overlapping segments leave each byte once
+			if received.Src != receiver || received.Gaps != 0 || !bytes.Equal(received.Data, concat(mvlPacket, powerPacket)) {
+				t.Fatalf("second stream %s -> %s, %d gaps: %q", received.Src, received.Dst, received.Gaps, received.Data)
+			}
+			messages, skipped := eiscp.ScanEISCPStream(received.Data)
+			if skipped != 0 || len(messages) != 2 || messages[0].Message.String() != "MVL1E" || messages[1].Message.String() != "PWR01" {
+				t.Fatalf("scanned %+v, skipped %d", messages, skipped)
+			}
+
+			// The first half came in a millisecond after the second, the power packet
+			// three milliseconds after that
+			if got, want := received.TimeAt(0), captureStart.Add(5*time.Millisecond); !got.Equal(want) {
+				t.Errorf("TimeAt(0) = %v, want %v", got, want)
+			}
+			if got, want := received.TimeAt(10), captureStart.Add(4*time.Millisecond); !got.Equal(want) {
+				t.Errorf("TimeAt(10) = %v, want %v", got, want)
+			}
+			if got, want := received.TimeAt(len(mvlPacket)), captureStart.Add(8*time.Millisecond); !got.Equal(want) {
+				t.Errorf("TimeAt(%d) = %v, want %v", len(mvlPacket), got, want)
+			}
+		})
+	}
+}
+
+func TestReassembleLostData(t *testing.T) {
+	streams := capture.Reassemble(readSegments(t, "lost.pcap"), 60128)
+	if len(streams) != 1 {
+		t.Fatalf("%d streams, want 1", len(streams))
+	}
+	// Data after the hole is kept
+	if streams[0].Gaps != 1 || !bytes.Equal(streams[0].Data, concat(mvlPacket, powerPacket)) {
+		t.Fatalf("%d gaps: %q", streams[0].Gaps, streams[0].Data)
+	}
+}
+
+func TestReassembleIPv6(t *testing.T) {
+	streams := capture.Reassemble(readSegments(t, "ipv6.pcap"), 60128)
+	if len(streams) != 1 || !bytes.Equal(streams[0].Data, queryPacket) {
+		t.Fatalf("streams %+v", streams)
+	}
+}
+
+func TestReassembleOtherPort(t *testing.T) {
+	if streams := capture.Reassemble(readSegments(t, "session.pcap"), 60129); len(streams) != 0 {
+		t.Fatalf("%d streams of another port", len(streams))
+	}
+}
+
+func TestReassemble(t *testing.T) {
+	at := func(ms int) time.Time { return captureStart.Add(time.Duration(ms) * time.Millisecond) }
+	syn := func(ms int, seq uint32) capture.Segment {
+		return capture.Segment{Time: at(ms), Src: receiver, Dst: client, Seq: seq, SYN: true}
+	}
+	data := func(ms int, seq uint32, payload string) capture.Segment {
+		return capture.Segment{Time: at(ms), Src: receiver, Dst: client, Seq: seq, Payload: []byte(payload)}
+	}
+
+	tests := []struct {
+		name     string
+		segments []capture.Segment
+		want     []string
+		gaps     int
+	}{
+		{"in order", []capture.Segment{syn(0, 99), data(1, 100, "abc"), data(2, 103, "def")}, []string{"abcdef"}, 0},
+		{"out of order", []capture.Segment{syn(0, 99), data(1, 103, "def"), data(2, 106, "ghi"), data(3, 100, "abc")}, []string{"abcdefghi"}, 0},
+		{"retransmitted", []capture.Segment{syn(0, 99), data(1, 100, "abc"), data(2, 100, "abc"), data(3, 103, "def")}, []string{"abcdef"}, 0},
+		{"overlapping", []capture.Segment{syn(0, 99), data(1, 100, "abcd"), data(2, 102, "cdef")}, []string{"abcdef"}, 0},
+		{"retransmitted out of order", []capture.Segment{syn(0, 99), data(1, 103, "def"), data(2, 103, "def"), data(3, 100, "abc")}, []string{"abcdef"}, 0},
+		{"lost", []capture.Segment{syn(0, 99), data(1, 100, "abc"), data(2, 106, "ghi"), data(3, 112, "mno")}, []string{"abcghimno"}, 2},
+		{"started before the capture", []capture.Segment{data(1, 5000, "abc"), data(2, 5003, "def")}, []string{"abcdef"}, 0},
+		{"sequence wraps around", []capture.Segment{syn(0, 0xfffffffd), data(1, 0xfffffffe, "ab"), data(2, 0, "cd")}, []string{"abcd"}, 0},
+		{"ports reused", []capture.Segment{syn(0, 99), data(1, 100, "abc"), syn(2, 7000), data(3, 7001, "def")}, []string{"abc", "def"}, 0},
+		{"handshake only", []capture.Segment{syn(0, 99)}, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streams := capture.Reassemble(tt.segments, 60128)
+			if len(streams) != len(tt.want) {
+				t.Fatalf("%d streams, want %d", len(streams), len(tt.want))
+			}
+			gaps := 0
+			for i, stream := range streams {
+				if string(stream.Data) != tt.want[i] {
+					t.Errorf("stream %d = %q, want %q", i, stream.Data, tt.want[i])
+				}
+				gaps += stream.Gaps
+			}
+			if gaps != tt.gaps {
+				t.Errorf("%d gaps, want %d", gaps, tt.gaps)
+			}
+		})
+	}
+}
+
+func TestStreamTimeAt(t *testing.T) {
+	stream := capture.Reassemble([]capture.Segment{
+		{Time: captureStart, Src: receiver, Dst: client, Seq: 1, Payload: []byte("abc")},
+	}, 60128)[0]
+	if !stream.TimeAt(-1).IsZero() {
+		t.Fatalf("TimeAt(-1) = %v, want zero", stream.TimeAt(-1))
+	}
+	if !stream.TimeAt(100).Equal(captureStart) {
+		t.Fatalf("TimeAt past the end = %v, want the last chunk", stream.TimeAt(100))
+	}
+}
@@ -0,0 +1,131 @@
+package eiscp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// AlbumArt is the jacket art of the currently playing track.
+// The receiver either streams the image itself or points to it with an URL.
+type AlbumArt struct {
+	ContentType string
+	Data        []byte
+	URL         string
+	UpdatedAt   time.Time
+}
+
+// How long QueryAlbumArt waits for the whole image, large JPEGs arrive in many chunks
+var albumArtTimeout = 10 * time.Second
+
+var albumArtContentTypes = map[byte]string{
+	'0': "image/bmp",
+	'1': "image/jpeg",
+}
+
+// Collects NJA chunks into complete images
+type albumArtAssembler struct {
+	mu          sync.Mutex
+	buf         bytes.Buffer
+	contentType string
+	latest      *AlbumArt
+	updated     chan struct{}
+}
+
+func newAlbumArtAssembler() *albumArtAssembler {
+	return &albumArtAssembler{updated: make(chan struct{})}
+}
+
+// Handles NJA payload in the "tp{data}" format, where t is the image type
+// (0 - BMP, 1 - JPEG, 2 - URL, n - no image) and p is the packet flag
+// (0 - start, 1 - next, 2 - end, "-" - not used)
+func (a *albumArtAssembler) handle(payload string) {
+	if len(payload) < 2 {
+		return
+	}
+	imageType, flag, data := payload[0], payload[1], payload[2:]
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch imageType {
+	case 'n':
+		a.buf.Reset()
+		a.publish(nil)
+	case '2':
+		a.buf.Reset()
+		a.publish(&AlbumArt{URL: data, UpdatedAt: time.Now()})
+	case '0', '1':
+		chunk, err := hex.DecodeString(data)
+		if err != nil {
+			// A corrupted chunk spoils the whole image
+			a.buf.Reset()
+			a.contentType = ""
+			return
+		}
+		if flag == '0' {
+			a.buf.Reset()
+			a.contentType = albumArtContentTypes[imageType]
+		}
+		if a.contentType == "" {
+			// Chunk of an image we never saw start
+			return
+		}
+		a.buf.Write(chunk)
+		if flag == '2' {
+			a.publish(&AlbumArt{
+				ContentType: a.contentType,
+				Data:        append([]byte(nil), a.buf.Bytes()...),
+				UpdatedAt:   time.Now(),
+			})
+			a.buf.Reset()
+			a.contentType = ""
+		}
+	}
+}
+
+// Replaces the latest art and wakes up everyone waiting for it.
+// Must be called with the mutex held.
+func (a *albumArtAssembler) publish(art *AlbumArt) {
+	a.latest = art
+	close(a.updated)
+	a.updated = make(chan struct{})
+}
+
+func (a *albumArtAssembler) get() (*AlbumArt, <-chan struct{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.latest, a.updated
+}
+
+// Returns the most recently received album art, if any
+func (c *EISCPClient) AlbumArt() (*AlbumArt, bool) {
+	art, _ := c.albumArt.get()
+	return art, art != nil
+}
+
+// Asks the receiver to send the album art again
+func (c *EISCPClient) RequestAlbumArt() error {
+	return c.send("NJA", "REQ")
+}
+
+// Requests the album art and waits until the whole image arrives
+func (c *EISCPClient) QueryAlbumArt() (*AlbumArt, error) {
+	_, updated := c.albumArt.get()
+	if err := c.RequestAlbumArt(); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-updated:
+		art, _ := c.albumArt.get()
+		if art == nil {
+			return nil, fmt.Errorf("%w: no album art for the current track", ErrNotAvailable)
+		}
+		return art, nil
+	case <-time.After(albumArtTimeout):
+		return nil, fmt.Errorf("%w: album art not received within timeout", ErrTimeout)
+	}
+}
@@ -0,0 +1,366 @@
+package eiscp
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CommandInfo describes a command of the ISCP protocol
+type CommandInfo struct {
+	Command string `json:"command"`
+	// Name used by the onkyo-eiscp project, e.g. "master-volume"
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Meaning of the fixed parameters, e.g. "00": "standby"
+	Values map[string]string `json:"values,omitempty"`
+
+	// Describes parameters not listed in values
+	describe func(parameter string) string
+}
+
+var (
+	upDownValues = map[string]string{
+		"UP":   "up",
+		"DOWN": "down",
+	}
+	volumeValues = map[string]string{
+		"UP":    "up",
+		"DOWN":  "down",
+		"UP1":   "up 1 dB",
+		"DOWN1": "down 1 dB",
+	}
+	onOffValues = map[string]string{
+		"00": "off",
+		"01": "on",
+	}
+	toggleValues = map[string]string{
+		"00": "off",
+		"01": "on",
+		"TG": "toggle",
+	}
+	powerValues = map[string]string{
+		"00":  "standby",
+		"01":  "on",
+		"ALL": "all standby",
+	}
+	inputValues = map[string]string{
+		"00":   "video1 (vcr/dvr)",
+		"01":   "video2 (cbl/sat)",
+		"02":   "video3 (game)",
+		"03":   "video4 (aux1)",
+		"04":   "video5 (aux2)",
+		"05":   "video6 (pc)",
+		"06":   "video7",
+		"10":   "dvd (bd/dvd)",
+		"11":   "strm-box",
+		"12":   "tv",
+		"20":   "tape1 (tv/tape)",
+		"21":   "tape2",
+		"22":   "phono",
+		"23":   "cd (tv/cd)",
+		"24":   "fm",
+		"25":   "am",
+		"26":   "tuner",
+		"27":   "music-server (dlna)",
+		"28":   "internet-radio",
+		"29":   "usb front",
+		"2A":   "usb rear",
+		"2B":   "network",
+		"2C":   "usb toggle",
+		"2D":   "airplay",
+		"2E":   "bluetooth",
+		"30":   "multi-ch",
+		"31":   "xm",
+		"32":   "sirius",
+		"33":   "dab",
+		"40":   "universal-port",
+		"55":   "hdmi5",
+		"56":   "hdmi6",
+		"57":   "hdmi7",
+		"80":   "source",
+		"UP":   "up",
+		"DOWN": "down",
+	}
+)
+
+// Numeric parameters sent as hex, e.g. volume "1E" is 30
+func describeHexLevel(parameter string) string {
+	level, err := strconv.ParseInt(parameter, 16, 64)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("level %d", level)
+}
+
+func describePreset(parameter string) string {
+	preset, err := strconv.ParseInt(parameter, 16, 64)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("preset %d", preset)
+}
+
+// Signed decimal levels, e.g. subwoofer "-04"
+func describeSignedLevel(parameter string) string {
+	level, err := strconv.Atoi(strings.TrimSuffix(parameter, "C"))
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%+d dB", level)
+}
+
+func describeSleep(parameter string) string {
+	if parameter == "OFF" {
+		return "off"
+	}
+	minutes, err := strconv.ParseInt(parameter, 16, 64)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d min", minutes)
+}
+
+// Joins the fields the model reported
+func joinReported(fields ...string) string {
+	var reported []string
+	for _, field := range fields {
+		if field != "" {
+			reported = append(reported, field)
+		}
+	}
+	return strings.Join(reported, ", ")
+}
+
+func describeAudioInformation(parameter string) string {
+	info := ParseAudioInformation(parameter)
+	return joinReported(info.InputFormat, info.SampleRate, info.InputChannels, info.ListeningMode)
+}
+
+func describeVideoInformation(parameter string) string {
+	info := ParseVideoInformation(parameter)
+	return joinReported(info.InputResolution, info.OutputResolution, info.PictureMode)
+}
+
+// Long payloads are only measured, they would not fit on a line
+func describeLength(parameter string) string {
+	return fmt.Sprintf("%d bytes", len(parameter))
+}
+
+// Commands of the main and other zones, as documented by Onkyo and the onkyo-eiscp project
+var catalog = map[string]CommandInfo{
+	"PWR": {Name: "system-power", Description: "Main zone power", Values: powerValues},
+	"AMT": {Name: "audio-muting", Description: "Main zone muting", Values: toggleValues},
+	"SPA": {Name: "speaker-a", Description: "Speaker A switch", Values: toggleValues},
+	"SPB": {Name: "speaker-b", Description: "Speaker B switch", Values: toggleValues},
+	"MVL": {Name: "master-volume", Description: "Main zone volume, hex steps", Values: volumeValues, describe: describeHexLevel},
+	"TFR": {Name: "tone-front", Description: "Front bass and treble, e.g. B+2T-1"},
+	"SWL": {Name: "subwoofer-temporary-level", Description: "Subwoofer level in dB", Values: upDownValues, describe: describeSignedLevel},
+	"CTL": {Name: "center-temporary-level", Description: "Center speaker level in dB", Values: upDownValues, describe: describeSignedLevel},
+	"DIF": {Name: "display-mode", Description: "Front panel display mode", Values: map[string]string{
+		"00": "selector and volume",
+		"01": "selector and listening mode",
+		"02": "digital format",
+		"03": "video format",
+		"TG": "toggle",
+	}},
+	"DIM": {Name: "dimmer-level", Description: "Front panel brightness", Values: map[string]string{
+		"00":  "bright",
+		"01":  "dim",
+		"02":  "dark",
+		"03":  "shut off",
+		"08":  "bright and led off",
+		"DIM": "cycle",
+	}},
+	"OSD": {Name: "setup", Description: "On screen setup menu navigation"},
+	"MEM": {Name: "memory-setup", Description: "Store or recall settings", Values: map[string]string{
+		"STR":  "store",
+		"RCL":  "recall",
+		"LOCK": "lock",
+		"UNLK": "unlock",
+	}},
+	"IFA": {Name: "audio-information", Description: "Audio signal information", describe: describeAudioInformation},
+	"IFV": {Name: "video-information", Description: "Video signal information", describe: describeVideoInformation},
+	"SLI": {Name: "input-selector", Description: "Main zone input", Values: inputValues},
+	"SLA": {Name: "audio-selector", Description: "Audio input of the selected source", Values: map[string]string{
+		"00": "auto",
+		"01": "multi-channel",
+		"02": "analog",
+		"03": "ilink",
+		"04": "hdmi",
+		"05": "coax/opt",
+		"06": "balance",
+		"07": "arc",
+		"UP": "up",
+	}},
+	"HDO": {Name: "hdmi-output-selector", Description: "HDMI output", Values: map[string]string{
+		"00": "no",
+		"01": "main",
+		"02": "sub",
+		"03": "both",
+		"UP": "up",
+	}},
+	"RES": {Name: "monitor-out-resolution", Description: "Video output resolution"},
+	"SLP": {Name: "sleep-set", Description: "Sleep timer, hex minutes", Values: upDownValues, describe: describeSleep},
+	"LMD": {Name: "listening-mode", Description: "Listening mode", Values: map[string]string{
+		"00":    "stereo",
+		"01":    "direct",
+		"02":    "surround",
+		"03":    "film",
+		"04":    "thx",
+		"05":    "action",
+		"06":    "musical",
+		"08":    "orchestra",
+		"09":    "unplugged",
+		"0A":    "studio-mix",
+		"0B":    "tv-logic",
+		"0C":    "all-ch-stereo",
+		"0D":    "theater-dimensional",
+		"0F":    "mono",
+		"11":    "pure-audio",
+		"13":    "full-mono",
+		"40":    "straight-decode",
+		"80":    "plii movie",
+		"81":    "plii music",
+		"86":    "plii game",
+		"UP":    "up",
+		"DOWN":  "down",
+		"MOVIE": "movie cycle",
+		"MUSIC": "music cycle",
+		"GAME":  "game cycle",
+	}},
+	"LTN": {Name: "late-night", Description: "Late night dynamic range", Values: map[string]string{
+		"00": "off",
+		"01": "low",
+		"02": "high",
+		"03": "auto",
+		"UP": "up",
+	}},
+	"ADY": {Name: "audyssey-2eq-multeq-multeq-xt", Description: "Audyssey room correction", Values: toggleValues},
+	"ADQ": {Name: "audyssey-dynamic-eq", Description: "Audyssey dynamic EQ", Values: toggleValues},
+	"ADV": {Name: "audyssey-dynamic-volume", Description: "Audyssey dynamic volume", Values: map[string]string{
+		"00": "off",
+		"01": "light",
+		"02": "medium",
+		"03": "heavy",
+		"UP": "up",
+	}},
+	"MOT": {Name: "music-optimizer", Description: "Compressed music enhancer", Values: toggleValues},
+	"TUN": {Name: "tuning", Description: "Tuner frequency, 10 kHz for FM and kHz for AM", Values: upDownValues},
+	"PRS": {Name: "preset", Description: "Tuner preset, hex", Values: upDownValues, describe: describePreset},
+	"PRM": {Name: "preset-memory", Description: "Stores the station as the hex preset", describe: describePreset},
+	"RDS": {Name: "rds-information", Description: "RDS display", Values: map[string]string{
+		"00": "radio text",
+		"01": "program type",
+		"02": "traffic program",
+		"UP": "cycle",
+	}},
+	"PTS": {Name: "pty-scan", Description: "Program type scan"},
+	"TPS": {Name: "tp-scan", Description: "Traffic program scan"},
+	"DSN": {Name: "dab-station-name", Description: "DAB station name"},
+	"ECN": {Name: "model-name", Description: "Model announced on discovery, model/port/region/mac"},
+	"NRI": {Name: "receiver-information", Description: "Device information XML", describe: describeLength},
+	"NJA": {Name: "jacket-art", Description: "Album art chunks", Values: map[string]string{
+		"REQ": "request",
+		"ENA": "enable",
+		"DIS": "disable",
+		"n-":  "no image",
+	}, describe: describeLength},
+	"NLS": {Name: "net-list-info", Description: "Network service list line"},
+	"NLT": {Name: "net-list-title-info", Description: "Network service list title"},
+	"NLU": {Name: "net-list-update", Description: "Network service list update"},
+	"NST": {Name: "net-play-status", Description: "Play, repeat and shuffle status, e.g. P--"},
+	"NTC": {Name: "net-usb", Description: "Network and USB playback control", Values: map[string]string{
+		"PLAY":    "play",
+		"STOP":    "stop",
+		"PAUSE":   "pause",
+		"P/P":     "play/pause",
+		"TRUP":    "next track",
+		"TRDN":    "previous track",
+		"FF":      "fast forward",
+		"REW":     "rewind",
+		"REPEAT":  "repeat",
+		"RANDOM":  "random",
+		"DISPLAY": "display",
+		"RETURN":  "return",
+		"MENU":    "menu",
+		"TOP":     "top menu",
+	}},
+	"NTM": {Name: "net-time-info", Description: "Elapsed and total time, mm:ss/mm:ss"},
+	"NTR": {Name: "net-track-info", Description: "Track number and total, cccc/tttt"},
+	"NAT": {Name: "net-artist-name-info", Description: "Artist name"},
+	"NAL": {Name: "net-album-name-info", Description: "Album name"},
+	"NTI": {Name: "net-title-name-info", Description: "Title name"},
+	"NSV": {Name: "net-service", Description: "Network service selection"},
+	"NPR": {Name: "internet-radio-preset", Description: "Network radio preset, hex", describe: describePreset},
+	"NMS": {Name: "menu-status", Description: "Network menu status"},
+	"NDS": {Name: "net-connection-status", Description: "Network and USB connection status"},
+	"NPU": {Name: "popup-message", Description: "Network service popup"},
+	"NKY": {Name: "net-keyboard", Description: "Network service keyboard input"},
+	"APD": {Name: "auto-power-down", Description: "Automatic standby", Values: toggleValues},
+	"UPD": {Name: "update", Description: "Firmware update"},
+	"ZPW": {Name: "zone2-power", Description: "Zone 2 power", Values: onOffValues},
+	"ZMT": {Name: "zone2-muting", Description: "Zone 2 muting", Values: toggleValues},
+	"ZVL": {Name: "zone2-volume", Description: "Zone 2 volume, hex steps", Values: volumeValues, describe: describeHexLevel},
+	"SLZ": {Name: "zone2-selector", Description: "Zone 2 input", Values: inputValues},
+	"PW3": {Name: "zone3-power", Description: "Zone 3 power", Values: onOffValues},
+	"MT3": {Name: "zone3-muting", Description: "Zone 3 muting", Values: toggleValues},
+	"VL3": {Name: "zone3-volume", Description: "Zone 3 volume, hex steps", Values: volumeValues, describe: describeHexLevel},
+	"SL3": {Name: "zone3-selector", Description: "Zone 3 input", Values: inputValues},
+	"PW4": {Name: "zone4-power", Description: "Zone 4 power", Values: onOffValues},
+	"MT4": {Name: "zone4-muting", Description: "Zone 4 muting", Values: toggleValues},
+	"VL4": {Name: "zone4-volume", Description: "Zone 4 volume, hex steps", Values: volumeValues, describe: describeHexLevel},
+	"SL4": {Name: "zone4-selector", Description: "Zone 4 input", Values: inputValues},
+}
+
+// Finds the command in the catalog, case insensitive
+func LookupCommand(command string) (CommandInfo, bool) {
+	command = strings.ToUpper(command)
+	info, ok := catalog[command]
+	info.Command = command
+	return info, ok
+}
+
+// All catalogued commands, sorted
+func Catalog() []CommandInfo {
+	infos := make([]CommandInfo, 0, len(catalog))
+	for command := range catalog {
+		info, _ := LookupCommand(command)
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Command < infos[j].Command
+	})
+	return infos
+}
+
+// Describes the parameter in human terms, empty when there is nothing to add
+func (info CommandInfo) DescribeParameter(parameter string) string {
+	if parameter == QueryParameter {
+		return "query"
+	}
+	if parameter == "N/A" {
+		return "not available"
+	}
+	if value, ok := info.Values[parameter]; ok {
+		return value
+	}
+	if info.describe != nil {
+		return info.describe(parameter)
+	}
+	return ""
+}
+
+// Describes the message with the catalog, e.g. "master-volume: level 30".
+// Unknown commands give an empty description.
+func Describe(message Message) string {
+	info, ok := LookupCommand(message.Command)
+	if !ok {
+		return ""
+	}
+	if value := info.DescribeParameter(message.Parameter); value != "" {
+		return info.Name + ": " + value
+	}
+	return info.Name
+}
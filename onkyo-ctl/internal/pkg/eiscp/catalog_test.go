@@ -0,0 +1,113 @@
+package eiscp_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+)
+
+func TestLookupCommand(t *testing.T) {
+	tests := []struct {
+		command  string
+		want     string
+		wantName string
+		found    bool
+	}{
+		{"MVL", "MVL", "master-volume", true},
+		{"pwr", "PWR", "system-power", true},
+		{"Sl3", "SL3", "zone3-selector", true},
+		{"XYZ", "XYZ", "", false},
+		{"", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			info, ok := eiscp.LookupCommand(tt.command)
+			if ok != tt.found || info.Command != tt.want || info.Name != tt.wantName {
+				t.Fatalf("LookupCommand(%q) = %+v, %v, want %s %q, %v", tt.command, info, ok, tt.want, tt.wantName, tt.found)
+			}
+			if ok && info.Description == "" {
+				t.Fatalf("%s has no description", tt.want)
+			}
+		})
+	}
+}
+
+func TestDescribeParameter(t *testing.T) {
+	tests := []struct {
+		command   string
+		parameter string
+		want      string
+	}{
+		{"MVL", "QSTN", "query"},
+		{"MVL", "N/A", "not available"},
+		{"MVL", "1E", "level 30"},
+		{"MVL", "UP1", "up 1 dB"},
+		{"MVL", "ZZ", ""},
+		{"PWR", "00", "standby"},
+		{"PWR", "ALL", "all standby"},
+		{"AMT", "TG", "toggle"},
+		{"SLI", "2E", "bluetooth"},
+		{"SWL", "-04", "-4 dB"},
+		{"SWL", "+0AC", ""},
+		{"CTL", "+3", "+3 dB"},
+		{"SLP", "OFF", "off"},
+		{"SLP", "5A", "90 min"},
+		{"PRS", "0A", "preset 10"},
+		{"NPR", "12", "preset 18"},
+		{"NRI", "<response/>", "11 bytes"},
+		{"NJA", "n-", "no image"},
+		{"IFA", "HDMI 1,PCM,48 kHz,2.0 ch,Stereo,2.1 ch,", "PCM, 48 kHz, 2.0 ch, Stereo"},
+		{"IFV", "HDMI 1,1080p,YCbCr,24bit,HDMI,4K,YCbCr,24bit,Standard,", "1080p, 4K, Standard"},
+		// Only described by the command description
+		{"TFR", "B+2T-1", ""},
+		{"NTI", "Blue in Green", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command+tt.parameter, func(t *testing.T) {
+			info, ok := eiscp.LookupCommand(tt.command)
+			if !ok {
+				t.Fatalf("%s not in the catalog", tt.command)
+			}
+			if got := info.DescribeParameter(tt.parameter); got != tt.want {
+				t.Fatalf("DescribeParameter(%q) = %q, want %q", tt.parameter, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		message eiscp.Message
+		want    string
+	}{
+		{eiscp.NewMessage("MVL", "1E"), "master-volume: level 30"},
+		{eiscp.NewQuery("PWR"), "system-power: query"},
+		{eiscp.NewMessage("ZPW", "01"), "zone2-power: on"},
+		{eiscp.NewMessage("TFR", "B+2T-1"), "tone-front"},
+		{eiscp.NewMessage("XYZ", "01"), ""},
+	}
+	for _, tt := range tests {
+		if got := eiscp.Describe(tt.message); got != tt.want {
+			t.Errorf("Describe(%s) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	infos := eiscp.Catalog()
+	if len(infos) == 0 {
+		t.Fatal("empty catalog")
+	}
+	if !sort.SliceIsSorted(infos, func(i, j int) bool { return infos[i].Command < infos[j].Command }) {
+		t.Fatal("catalog not sorted by command")
+	}
+	for _, info := range infos {
+		if len(info.Command) != 3 || info.Name == "" || info.Description == "" {
+			t.Errorf("incomplete entry %+v", info)
+		}
+		if found, ok := eiscp.LookupCommand(info.Command); !ok || found.Name != info.Name {
+			t.Errorf("%s not found by LookupCommand", info.Command)
+		}
+	}
+}
@@ -1,178 +1,408 @@
 package eiscp
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"net"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 // Custom error types
 var (
-	ErrValidation = errors.New("validation error")
-	ErrTimeout    = errors.New("timeout error")
-	ErrConnection = errors.New("connection error")
-	ErrTransport  = errors.New("transport error")
+	ErrValidation   = errors.New("validation error")
+	ErrTimeout      = errors.New("timeout error")
+	ErrConnection   = errors.New("connection error")
+	ErrTransport    = errors.New("transport error")
+	ErrNotAvailable = errors.New("not available")
+	ErrBusy         = errors.New("busy")
+	ErrMismatch     = errors.New("state mismatch")
 )
 
 type EISCPClient struct {
-	Conn          net.Conn
-	responseQueue chan string
+	transport   Transport
+	writer      *writer
+	subscribers *subscribers
+	albumArt    *albumArtAssembler
+	timeout     time.Duration
+	retries     int
+	settleTime  time.Duration
+
+	// Limits of the connected device, refined by QueryDeviceInfo
+	mu          sync.RWMutex
+	inputCodes  map[string]string
+	model       Model
+	modelPinned bool
+	fadeCancel  context.CancelFunc
+	power       PowerState
 }
 
+// How long queries wait for the response by default
+const DefaultTimeout = 2 * time.Second
+
+// Connects to the receiver over the network
 func NewEISCPClient(host, port string) (*EISCPClient, error) {
-	serverAddress := net.JoinHostPort(host, port)
-	conn, err := net.DialTimeout("tcp", serverAddress, 5*time.Second)
+	return Dial(EISCPDialer{Host: host, Port: port})
+}
+
+// Connects to the receiver over its RS-232 port
+func NewSerialClient(device string, baudRate int) (*EISCPClient, error) {
+	return Dial(SerialDialer{Device: device, BaudRate: baudRate})
+}
+
+// Connects to the receiver with whatever transport the dialer provides
+func Dial(dialer Dialer) (*EISCPClient, error) {
+	transport, err := dialer.Dial()
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrConnection, err)
+		return nil, err
 	}
+	return NewClient(transport), nil
+}
+
+// Creates client talking over already established transport
+func NewClient(transport Transport) *EISCPClient {
 	client := &EISCPClient{
-		Conn:          conn,
-		responseQueue: make(chan string, 100),
+		transport:   transport,
+		writer:      newWriter(transport),
+		subscribers: newSubscribers(),
+		albumArt:    newAlbumArtAssembler(),
+		timeout:     DefaultTimeout,
+		retries:     DefaultRetries,
+		settleTime:  DefaultSettleTime,
+		inputCodes:  defaultInputCodes,
+		model:       unknownModel,
 	}
 	go client.listen()
-	return client, nil
+	return client
+}
+
+// Changes how long queries wait for the response
+func (c *EISCPClient) SetTimeout(timeout time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timeout = timeout
 }
 
-// Constatnly puts incoming data into responseQueue
+func (c *EISCPClient) Timeout() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.timeout
+}
+
+// Changes the minimum gap between two commands written to the receiver
+func (c *EISCPClient) SetCommandGap(gap time.Duration) {
+	c.writer.setGap(gap)
+}
+
+func (c *EISCPClient) Close() error {
+	c.cancelFade()
+	c.writer.close()
+	return c.transport.Close()
+}
+
+// Constatnly hands incoming messages over to the subscribers
 func (c *EISCPClient) listen() {
-	buf := make([]byte, 1024)
 	for {
-		n, err := c.Conn.Read(buf)
+		message, err := c.transport.ReadMessage()
+		if errors.Is(err, ErrInvalidMessage) {
+			// The stream itself is fine, only this message was garbled
+			continue
+		}
 		if err != nil {
-			close(c.responseQueue)
+			c.subscribers.close()
 			return
 		}
-		c.responseQueue <- string(buf[:n])
+
+		c.observePower(message)
+		c.subscribers.publish(message)
+
+		// Jacket art arrives in a burst of chunks nobody waits for
+		if message.Command == "NJA" {
+			c.albumArt.handle(message.Parameter)
+		}
 	}
 }
 
-// Sends ISCP message and returns without awaiting the response
-func (c *EISCPClient) SendCommand(msg string) error {
-	// Clear the response queue
-	for len(c.responseQueue) > 0 {
-		<-c.responseQueue
+// Sends ISCP message and returns once it is written, without awaiting the response.
+// Messages are written by priority and then in order, spaced by the command gap.
+// Absolute values still waiting for their turn are replaced by newer values of the same command.
+func (c *EISCPClient) SendMessage(message Message) error {
+	completion, err := c.Enqueue(message, PriorityOf(message))
+	if err != nil {
+		return err
 	}
+	return completion.Wait()
+}
 
-	packet := NewEISCPPacket(msg)
-	_, err := c.Conn.Write(packet.Bytes())
+// Queues ISCP message with given priority and returns right away.
+// Fails with ErrBusy when too many writes are already waiting.
+func (c *EISCPClient) Enqueue(message Message, priority Priority) (*Completion, error) {
+	return c.writer.enqueue(message, priority)
+}
+
+// Sends ISCP message given in the bare form, e.g. "MVL1E"
+func (c *EISCPClient) SendCommand(msg string) error {
+	message, err := ParseMessage(msg)
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrTransport, err)
+		return err
 	}
-	return nil
+	return c.SendMessage(message)
 }
 
-// Sends ISCP message and waits for response
-func (c *EISCPClient) SendReceiveCommand(command string) (string, error) {
-	err := c.SendCommand(command)
+// Sends ISCP message given in the bare form and waits for response to the same command
+func (c *EISCPClient) SendReceiveCommand(command string) (Message, error) {
+	message, err := ParseMessage(command)
 	if err != nil {
-		return "", err
+		return Message{}, err
+	}
+	return c.receive(message)
+}
+
+// Sends ISCP message and collects everything received until a message starting
+// with the expected prefix arrives, e.g. "MVL" or "PWR01", the expected one last.
+// Empty prefix expects the same command, zero timeout uses the client timeout.
+func (c *EISCPClient) Exchange(message Message, expect string, timeout time.Duration) ([]Message, error) {
+	if expect == "" {
+		expect = message.Command
+	}
+	if timeout == 0 {
+		timeout = c.Timeout()
+	}
+
+	// Subscribed before sending, fast responses are not missed
+	messages, cancel := c.Subscribe()
+	defer cancel()
+	if err := c.SendMessage(message); err != nil {
+		return nil, err
+	}
+
+	var received []Message
+	deadline := time.After(timeout)
+	for {
+		select {
+		case response, ok := <-messages:
+			if !ok {
+				return received, fmt.Errorf("%w: connection closed", ErrConnection)
+			}
+			received = append(received, response)
+			if strings.HasPrefix(strings.ToUpper(response.String()), strings.ToUpper(expect)) {
+				return received, nil
+			}
+		case <-deadline:
+			return received, fmt.Errorf("%w: no %s response received within %v", ErrTimeout, expect, timeout)
+		}
+	}
+}
+
+// Sends ISCP message and waits for response to the same command.
+// Unrelated messages arriving in the meantime are dropped.
+func (c *EISCPClient) receive(message Message) (Message, error) {
+	// Subscribed before sending, fast responses are not missed
+	messages, cancel := c.Subscribe()
+	defer cancel()
+	if err := c.SendMessage(message); err != nil {
+		return Message{}, err
+	}
+	return c.await(messages, message.Command)
+}
+
+// Waits for the next message with the command on the subscription, dropping the others.
+// Every caller waits on its own subscription, so concurrent ones do not take each other's responses.
+func (c *EISCPClient) await(messages <-chan Message, command string) (Message, error) {
+	timeout := time.After(c.Timeout())
+	for {
+		select {
+		case response, ok := <-messages:
+			if !ok {
+				return Message{}, fmt.Errorf("%w: connection closed", ErrConnection)
+			}
+			if response.Command == command {
+				return response, nil
+			}
+		case <-timeout:
+			return Message{}, fmt.Errorf("%w: no response received within timeout", ErrTimeout)
+		}
 	}
+}
+
+// Sends message with command the model is known to support
+func (c *EISCPClient) send(command, parameter string) error {
+	if err := c.checkSupported(command); err != nil {
+		return err
+	}
+	return c.SendMessage(NewMessage(command, parameter))
+}
+
+// Queries state of command the model is known to support
+func (c *EISCPClient) query(command string) (Message, error) {
+	if err := c.checkSupported(command); err != nil {
+		return Message{}, err
+	}
+	return c.receive(NewQuery(command))
+}
 
-	select {
-	case response := <-c.responseQueue:
-		return UnpackEISCPMessage(response), nil
-	case <-time.After(2 * time.Second):
-		return "", fmt.Errorf("%w: no response received within timeout", ErrTimeout)
+func (c *EISCPClient) checkSupported(command string) error {
+	model := c.Model()
+	if !model.Supports(command) {
+		return fmt.Errorf("%w: command '%s' is not supported by %s", ErrValidation, command, model.Name)
 	}
+	return nil
 }
 
-var inputCodes = map[string]string{
+// Used until the device reports its own input names
+var defaultInputCodes = map[string]string{
 	"spotify": "01",
 	"vinyl":   "22",
 	"tv":      "12",
 	"dj":      "10",
+	"fm":      "24",
+	"am":      "25",
+	"dab":     "33",
 }
 
-var inputNames = map[string]string{
-	"01": "spotify",
-	"22": "vinyl",
-	"12": "tv",
-	"10": "dj",
+// Returns names of the inputs that can be selected, sorted
+func (c *EISCPClient) Inputs() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	inputs := make([]string, 0, len(c.inputCodes))
+	for name := range c.inputCodes {
+		inputs = append(inputs, name)
+	}
+	sort.Strings(inputs)
+	return inputs
 }
 
-func (c *EISCPClient) PowerOn() error {
-	return c.SendCommand("PWR01")
+func (c *EISCPClient) MaxVolume() int {
+	return c.Model().MaxVolume
 }
 
 func (c *EISCPClient) PowerOff() error {
-	return c.SendCommand("PWR00")
+	return c.send("PWR", "00")
 }
 
 func (c *EISCPClient) VolumeUp() error {
-	return c.SendCommand("MVLUP")
+	c.cancelFade()
+	return c.send("MVL", "UP")
 }
 
 func (c *EISCPClient) VolumeDown() error {
-	return c.SendCommand("MVLDOWN")
+	c.cancelFade()
+	return c.send("MVL", "DOWN")
 }
 
 func (c *EISCPClient) SubwooferUp() error {
-	return c.SendCommand("SWLUP")
+	return c.send("SWL", "UP")
 }
 
 func (c *EISCPClient) SubwooferDown() error {
-	return c.SendCommand("SWLDOWN")
+	return c.send("SWL", "DOWN")
 }
 
 func (c *EISCPClient) SetMasterVolume(level int) error {
-	if level < 0 || level > 50 {
-		return fmt.Errorf("%w: volume level %d must be between 0 and 50", ErrValidation, level)
+	c.cancelFade()
+	return c.setMasterVolume(level)
+}
+
+func (c *EISCPClient) setMasterVolume(level int) error {
+	message, err := c.volumeMessage(level)
+	if err != nil {
+		return err
+	}
+	return c.send(message.Command, message.Parameter)
+}
+
+func (c *EISCPClient) volumeMessage(level int) (Message, error) {
+	maxVolume := c.MaxVolume()
+	if level < 0 || level > maxVolume {
+		return Message{}, fmt.Errorf("%w: volume level %d must be between 0 and %d", ErrValidation, level, maxVolume)
 	}
 	hexLevel := fmt.Sprintf("%02X", level)
-	return c.SendCommand("MVL" + hexLevel)
+	return NewMessage("MVL", hexLevel), nil
 }
 
 func (c *EISCPClient) SetSubwooferLevel(level int) error {
-	if level < -8 || level > 8 {
-		return fmt.Errorf("%w: subwoofer level %d must be between -8 and 8", ErrValidation, level)
+	message, err := c.subwooferMessage(level)
+	if err != nil {
+		return err
 	}
+	return c.send(message.Command, message.Parameter)
+}
 
-	var command string
+func (c *EISCPClient) subwooferMessage(level int) (Message, error) {
+	model := c.Model()
+	if level < model.SubwooferMin || level > model.SubwooferMax {
+		return Message{}, fmt.Errorf("%w: subwoofer level %d must be between %d and %d", ErrValidation, level, model.SubwooferMin, model.SubwooferMax)
+	}
+
+	var parameter string
 	if level >= 0 {
-		command = fmt.Sprintf("SWL+%02d", level)
+		parameter = fmt.Sprintf("+%02d", level)
 	} else {
-		command = fmt.Sprintf("SWL-%02d", -level)
+		parameter = fmt.Sprintf("-%02d", -level)
 	}
-
-	return c.SendCommand(command)
+	return NewMessage("SWL", parameter), nil
 }
 
 func (c *EISCPClient) SetInputSelector(input string) error {
-	code, ok := inputCodes[input]
+	message, err := c.inputMessage(input)
+	if err != nil {
+		return err
+	}
+	return c.send(message.Command, message.Parameter)
+}
+
+func (c *EISCPClient) inputMessage(input string) (Message, error) {
+	code, ok := c.InputCode(input)
 	if !ok {
-		return fmt.Errorf("%w: invalid input selector '%s'", ErrValidation, input)
+		return Message{}, fmt.Errorf("%w: invalid input selector '%s'", ErrValidation, input)
 	}
-	return c.SendCommand("SLI" + code)
+	return NewMessage("SLI", code), nil
 }
 
 func (c *EISCPClient) QueryInputSelector() (string, error) {
-	response, err := c.SendReceiveCommand("SLIQSTN")
+	response, err := c.query("SLI")
 	if err != nil {
 		return "", err
 	}
 
-	code := strings.TrimPrefix(response, "SLI")
-	// fmt.Printf("Received input code: '%s' (length: %d)\n", code, len(code))
+	code := response.Parameter
+	if name, ok := c.InputName(code); ok {
+		return name, nil
+	}
+	return "", fmt.Errorf("%w: unknown input code '%s'", ErrValidation, code)
+}
 
-	name, ok := inputNames[code]
-	if !ok {
-		return "", fmt.Errorf("%w: unknown input code '%s'", ErrValidation, code)
+// Finds the code of the input selector name, e.g. "12" for "tv"
+func (c *EISCPClient) InputCode(name string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	code, ok := c.inputCodes[name]
+	return code, ok
+}
+
+// Finds the name of the input selector code, e.g. "tv" for "12"
+func (c *EISCPClient) InputName(code string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for name, inputCode := range c.inputCodes {
+		if strings.EqualFold(inputCode, code) {
+			return name, true
+		}
 	}
-	return name, nil
+	return "", false
 }
 
 func (c *EISCPClient) QueryVolume() (int, error) {
-	response, err := c.SendReceiveCommand("MVLQSTN")
+	response, err := c.query("MVL")
 	if err != nil {
 		return 0, err
 	}
 
-	hexValue := strings.TrimPrefix(response, "MVL")
-
-	result, err := strconv.ParseInt(hexValue, 16, 64)
+	result, err := strconv.ParseInt(response.Parameter, 16, 64)
 	if err != nil {
 		return 0, fmt.Errorf("%w: failed to parse volume response", ErrTransport)
 	}
@@ -181,13 +411,16 @@ func (c *EISCPClient) QueryVolume() (int, error) {
 }
 
 func (c *EISCPClient) QuerySubwooferLevel() (int, error) {
-	response, err := c.SendReceiveCommand("SWLQSTN")
+	response, err := c.query("SWL")
 	if err != nil {
 		return 0, err
 	}
-	response = strings.TrimPrefix(response, "SWL")
-	response = strings.TrimSuffix(response, "C")
-	result, err := strconv.Atoi(response)
+	return ParseSubwooferLevel(response.Parameter)
+}
+
+// Parses the SWL parameter, e.g. "-04", "+02" or "00", some models add "C"
+func ParseSubwooferLevel(parameter string) (int, error) {
+	result, err := strconv.Atoi(strings.TrimSuffix(parameter, "C"))
 	if err != nil {
 		return 0, fmt.Errorf("%w: failed to parse subwoofer response", ErrTransport)
 	}
@@ -195,37 +428,30 @@ func (c *EISCPClient) QuerySubwooferLevel() (int, error) {
 }
 
 func (c *EISCPClient) SetBrightness(level int) error {
-	if !(level == 0 || level == 1 || level == 2) {
-		return fmt.Errorf("%w: brightness level must be either: 0 - bright, 1 - dim, 2 - dark", ErrValidation)
+	maxBrightness := c.Model().MaxBrightness
+	if level < 0 || level > maxBrightness {
+		return fmt.Errorf("%w: brightness level %d must be between 0 (bright) and %d (dark)", ErrValidation, level, maxBrightness)
 	}
-	return c.SendCommand(fmt.Sprintf("DIM0%d", level))
+	return c.send("DIM", fmt.Sprintf("%02d", level))
 }
 
 func (c *EISCPClient) AnimateBlink() error {
-	var err error
-
-	err = c.SendCommand("DIM01")
-	if err != nil {
-		return fmt.Errorf("failed to set brightness: %w", err)
+	if err := c.checkSupported("DIM"); err != nil {
+		return err
 	}
 
-	time.Sleep(60 * time.Millisecond)
-	err = c.SendCommand("DIM00")
-	if err != nil {
-		return fmt.Errorf("failed to set brightness: %w", err)
+	// Written as one unit, so other commands do not break the animation apart
+	completion, err := c.writer.sequence(PriorityLow, []sequenceStep{
+		{message: NewMessage("DIM", "01")},
+		{message: NewMessage("DIM", "00"), delay: 60 * time.Millisecond},
+		{message: NewMessage("DIM", "01"), delay: 80 * time.Millisecond},
+		{message: NewMessage("DIM", "02"), delay: 40 * time.Millisecond},
+	})
+	if err == nil {
+		err = completion.Wait()
 	}
-
-	time.Sleep(80 * time.Millisecond)
-	err = c.SendCommand("DIM01")
 	if err != nil {
 		return fmt.Errorf("failed to set brightness: %w", err)
 	}
-
-	time.Sleep(40 * time.Millisecond)
-	err = c.SendCommand("DIM02")
-	if err != nil {
-		return fmt.Errorf("failed to set brightness: %w", err)
-	}
-
 	return nil
 }
@@ -0,0 +1,1189 @@
+package eiscp_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp/eiscptest"
+)
+
+// How long queries of the test clients wait, unanswered ones time out quickly
+const testTimeout = 50 * time.Millisecond
+
+func newTestClient(t *testing.T) (*eiscp.EISCPClient, *eiscptest.Transport) {
+	t.Helper()
+	fake := eiscptest.NewTransport()
+	client := fake.Client()
+	client.SetCommandGap(0)
+	client.SetTimeout(testTimeout)
+	client.SetSettleTime(0)
+	t.Cleanup(func() { client.Close() })
+	return client, fake
+}
+
+func assertSent(t *testing.T, fake *eiscptest.Transport, want ...string) {
+	t.Helper()
+	if got := fake.Sent(); !reflect.DeepEqual(got, want) && !(len(got) == 0 && len(want) == 0) {
+		t.Fatalf("sent %q, want %q", got, want)
+	}
+}
+
+// Waits until the fake saw the write, failing the test after a second
+func waitSent(t *testing.T, fake *eiscptest.Transport, message string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		for _, sent := range fake.Sent() {
+			if sent == message {
+				return
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%s was not sent, sent %q", message, fake.Sent())
+}
+
+func TestClientCommands(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(c *eiscp.EISCPClient) error
+		want []string
+	}{
+		{"PowerOff", (*eiscp.EISCPClient).PowerOff, []string{"PWR00"}},
+		{"VolumeUp", (*eiscp.EISCPClient).VolumeUp, []string{"MVLUP"}},
+		{"VolumeDown", (*eiscp.EISCPClient).VolumeDown, []string{"MVLDOWN"}},
+		{"SubwooferUp", (*eiscp.EISCPClient).SubwooferUp, []string{"SWLUP"}},
+		{"SubwooferDown", (*eiscp.EISCPClient).SubwooferDown, []string{"SWLDOWN"}},
+		{"SetMasterVolume", func(c *eiscp.EISCPClient) error { return c.SetMasterVolume(30) }, []string{"MVL1E"}},
+		{"SetMasterVolume max", func(c *eiscp.EISCPClient) error { return c.SetMasterVolume(50) }, []string{"MVL32"}},
+		{"SetSubwooferLevel positive", func(c *eiscp.EISCPClient) error { return c.SetSubwooferLevel(3) }, []string{"SWL+03"}},
+		{"SetSubwooferLevel negative", func(c *eiscp.EISCPClient) error { return c.SetSubwooferLevel(-4) }, []string{"SWL-04"}},
+		{"SetSubwooferLevel zero", func(c *eiscp.EISCPClient) error { return c.SetSubwooferLevel(0) }, []string{"SWL+00"}},
+		{"SetInputSelector", func(c *eiscp.EISCPClient) error { return c.SetInputSelector("tv") }, []string{"SLI12"}},
+		{"SetBrightness", func(c *eiscp.EISCPClient) error { return c.SetBrightness(1) }, []string{"DIM01"}},
+		{"AnimateBlink", (*eiscp.EISCPClient).AnimateBlink, []string{"DIM01", "DIM00", "DIM01", "DIM02"}},
+		{"SetTunerBand", func(c *eiscp.EISCPClient) error { return c.SetTunerBand("fm") }, []string{"SLI24"}},
+		{"SetTunerFrequency fm", func(c *eiscp.EISCPClient) error { return c.SetTunerFrequency("fm", 98.5) }, []string{"TUN09850"}},
+		{"SetTunerFrequency am", func(c *eiscp.EISCPClient) error { return c.SetTunerFrequency("am", 1017) }, []string{"TUN01017"}},
+		{"TunerUp", (*eiscp.EISCPClient).TunerUp, []string{"TUNUP"}},
+		{"TunerDown", (*eiscp.EISCPClient).TunerDown, []string{"TUNDOWN"}},
+		{"SelectPreset", func(c *eiscp.EISCPClient) error { return c.SelectPreset(12) }, []string{"PRS0C"}},
+		{"StorePreset", func(c *eiscp.EISCPClient) error { return c.StorePreset(40) }, []string{"PRM28"}},
+		{"PresetUp", (*eiscp.EISCPClient).PresetUp, []string{"PRSUP"}},
+		{"PresetDown", (*eiscp.EISCPClient).PresetDown, []string{"PRSDOWN"}},
+		{"SetRDSDisplay", func(c *eiscp.EISCPClient) error { return c.SetRDSDisplay("pty") }, []string{"RDS01"}},
+		{"RequestAlbumArt", (*eiscp.EISCPClient).RequestAlbumArt, []string{"NJAREQ"}},
+		{"SendCommand", func(c *eiscp.EISCPClient) error { return c.SendCommand(" mvl1E ") }, []string{"MVL1E"}},
+		{"SendMessage", func(c *eiscp.EISCPClient) error { return c.SendMessage(eiscp.NewQuery("PWR")) }, []string{"PWRQSTN"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newTestClient(t)
+			if err := tt.call(client); err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			assertSent(t, fake, tt.want...)
+		})
+	}
+}
+
+func TestClientValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		model string
+		call  func(c *eiscp.EISCPClient) error
+	}{
+		{"volume above max", "", func(c *eiscp.EISCPClient) error { return c.SetMasterVolume(51) }},
+		{"volume negative", "", func(c *eiscp.EISCPClient) error { return c.SetMasterVolume(-1) }},
+		{"volume above model max", "TX-NR", func(c *eiscp.EISCPClient) error { return c.SetMasterVolume(81) }},
+		{"confirmed volume above max", "", func(c *eiscp.EISCPClient) error { return c.SetMasterVolumeConfirmed(51) }},
+		{"subwoofer above max", "", func(c *eiscp.EISCPClient) error { return c.SetSubwooferLevel(9) }},
+		{"subwoofer below min", "", func(c *eiscp.EISCPClient) error { return c.SetSubwooferLevel(-9) }},
+		{"confirmed subwoofer below min", "", func(c *eiscp.EISCPClient) error { return c.SetSubwooferLevelConfirmed(-9) }},
+		{"unknown input", "", func(c *eiscp.EISCPClient) error { return c.SetInputSelector("laserdisc") }},
+		{"confirmed unknown input", "", func(c *eiscp.EISCPClient) error { return c.SetInputSelectorConfirmed("laserdisc") }},
+		{"brightness above max", "", func(c *eiscp.EISCPClient) error { return c.SetBrightness(3) }},
+		{"brightness negative", "", func(c *eiscp.EISCPClient) error { return c.SetBrightness(-1) }},
+		{"unknown tuner band", "", func(c *eiscp.EISCPClient) error { return c.SetTunerBand("sw") }},
+		{"fm frequency too low", "", func(c *eiscp.EISCPClient) error { return c.SetTunerFrequency("fm", 87.4) }},
+		{"fm frequency too high", "", func(c *eiscp.EISCPClient) error { return c.SetTunerFrequency("fm", 108.1) }},
+		{"am frequency too low", "", func(c *eiscp.EISCPClient) error { return c.SetTunerFrequency("am", 521) }},
+		{"am frequency too high", "", func(c *eiscp.EISCPClient) error { return c.SetTunerFrequency("am", 1711) }},
+		{"dab direct tuning", "", func(c *eiscp.EISCPClient) error { return c.SetTunerFrequency("dab", 100) }},
+		{"preset zero", "", func(c *eiscp.EISCPClient) error { return c.SelectPreset(0) }},
+		{"preset above 40", "", func(c *eiscp.EISCPClient) error { return c.SelectPreset(41) }},
+		{"store preset above 40", "", func(c *eiscp.EISCPClient) error { return c.StorePreset(41) }},
+		{"unknown rds mode", "", func(c *eiscp.EISCPClient) error { return c.SetRDSDisplay("ps") }},
+		{"message too short", "", func(c *eiscp.EISCPClient) error { return c.SendCommand("MV") }},
+		{"query too short", "", func(c *eiscp.EISCPClient) error {
+			_, err := c.SendReceiveCommand("M")
+			return err
+		}},
+		{"unsupported command", "TX-L20D", func(c *eiscp.EISCPClient) error {
+			_, err := c.QueryVideoInformation()
+			return err
+		}},
+		{"unsupported confirmed command", "TX-L20D", func(c *eiscp.EISCPClient) error {
+			_, err := c.SendConfirmed(eiscp.NewMessage("IFV", "00"))
+			return err
+		}},
+		{"fade curve", "", func(c *eiscp.EISCPClient) error {
+			return c.FadeVolume(context.Background(), 10, time.Second, "bounce")
+		}},
+		{"fade level", "", func(c *eiscp.EISCPClient) error {
+			return c.FadeVolume(context.Background(), 51, time.Second, eiscp.FadeLinear)
+		}},
+		{"fade duration", "", func(c *eiscp.EISCPClient) error {
+			return c.FadeVolume(context.Background(), 10, 0, eiscp.FadeLinear)
+		}},
+		{"unknown model", "", func(c *eiscp.EISCPClient) error { return c.SetModel("SR-9000") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newTestClient(t)
+			if tt.model != "" {
+				if err := client.SetModel(tt.model); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tt.call(client); !errors.Is(err, eiscp.ErrValidation) {
+				t.Fatalf("error = %v, want ErrValidation", err)
+			}
+			// Nothing invalid reaches the receiver
+			assertSent(t, fake)
+		})
+	}
+}
+
+func TestClientQueries(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		response string
+		call     func(c *eiscp.EISCPClient) (interface{}, error)
+		want     interface{}
+		wantErr  error
+	}{
+		{"QueryVolume", "MVLQSTN", "MVL1E", func(c *eiscp.EISCPClient) (interface{}, error) { return c.QueryVolume() }, 30, nil},
+		{"QueryVolume garbled", "MVLQSTN", "MVLXX", func(c *eiscp.EISCPClient) (interface{}, error) { return c.QueryVolume() }, 0, eiscp.ErrTransport},
+		{"QuerySubwooferLevel", "SWLQSTN", "SWL-04", func(c *eiscp.EISCPClient) (interface{}, error) { return c.QuerySubwooferLevel() }, -4, nil},
+		{"QuerySubwooferLevel center", "SWLQSTN", "SWL+02C", func(c *eiscp.EISCPClient) (interface{}, error) { return c.QuerySubwooferLevel() }, 2, nil},
+		{"QuerySubwooferLevel zero", "SWLQSTN", "SWL00", func(c *eiscp.EISCPClient) (interface{}, error) { return c.QuerySubwooferLevel() }, 0, nil},
+		{"QuerySubwooferLevel garbled", "SWLQSTN", "SWL?", func(c *eiscp.EISCPClient) (interface{}, error) { return c.QuerySubwooferLevel() }, 0, eiscp.ErrTransport},
+		{"QueryInputSelector", "SLIQSTN", "SLI12", func(c *eiscp.EISCPClient) (interface{}, error) { return c.QueryInputSelector() }, "tv", nil},
+		{"QueryInputSelector unknown", "SLIQSTN", "SLI99", func(c *eiscp.EISCPClient) (interface{}, error) { return c.QueryInputSelector() }, "", eiscp.ErrValidation},
+		{"QueryTunerFrequency fm", "TUNQSTN", "TUN09850", func(c *eiscp.EISCPClient) (interface{}, error) { return c.QueryTunerFrequency() },
+			eiscp.TunerFrequency{Band: "fm", Value: 98.5, Unit: "MHz"}, nil},
+		{"QueryTunerFrequency am", "TUNQSTN", "TUN01017", func(c *eiscp.EISCPClient) (interface{}, error) { return c.QueryTunerFrequency() },
+			eiscp.TunerFrequency{Band: "am", Value: 1017, Unit: "kHz"}, nil},
+		{"QueryTunerFrequency garbled", "TUNQSTN", "TUN-----", func(c *eiscp.EISCPClient) (interface{}, error) { return c.QueryTunerFrequency() },
+			eiscp.TunerFrequency{}, eiscp.ErrTransport},
+		{"QueryPreset", "PRSQSTN", "PRS0C", func(c *eiscp.EISCPClient) (interface{}, error) { return c.QueryPreset() }, 12, nil},
+		{"QueryPreset garbled", "PRSQSTN", "PRSZZ", func(c *eiscp.EISCPClient) (interface{}, error) { return c.QueryPreset() }, 0, eiscp.ErrTransport},
+		{"QueryStationName", "DSNQSTN", "DSN  Jazz FM ", func(c *eiscp.EISCPClient) (interface{}, error) { return c.QueryStationName() }, "Jazz FM", nil},
+		{"QueryAudioInformation", "IFAQSTN", "IFAHDMI 1,PCM,48 kHz,2.0 ch,Stereo,2.1 ch,",
+			func(c *eiscp.EISCPClient) (interface{}, error) { return c.QueryAudioInformation() },
+			eiscp.AudioInformation{InputPort: "HDMI 1", InputFormat: "PCM", SampleRate: "48 kHz", InputChannels: "2.0 ch", ListeningMode: "Stereo", OutputChannels: "2.1 ch"}, nil},
+		{"QueryAudioInformation no signal", "IFAQSTN", "IFAN/A",
+			func(c *eiscp.EISCPClient) (interface{}, error) { return c.QueryAudioInformation() }, eiscp.AudioInformation{}, eiscp.ErrNotAvailable},
+		{"QueryVideoInformation", "IFVQSTN", "IFVHDMI 1,1920 x 1080p,RGB,24bit",
+			func(c *eiscp.EISCPClient) (interface{}, error) { return c.QueryVideoInformation() },
+			eiscp.VideoInformation{InputPort: "HDMI 1", InputResolution: "1920 x 1080p", InputColorSpace: "RGB", InputColorDepth: "24bit"}, nil},
+		{"QueryVideoInformation no signal", "IFVQSTN", "IFVN/A",
+			func(c *eiscp.EISCPClient) (interface{}, error) { return c.QueryVideoInformation() }, eiscp.VideoInformation{}, eiscp.ErrNotAvailable},
+		{"QueryModelName", "ECNQSTN", "ECNTX-NR696/60128/DX/0009B0123456",
+			func(c *eiscp.EISCPClient) (interface{}, error) { return c.QueryModelName() }, "TX-NR696", nil},
+		{"SendReceiveCommand", "MVLQSTN", "MVL1E",
+			func(c *eiscp.EISCPClient) (interface{}, error) { return c.SendReceiveCommand("mvlQSTN") }, eiscp.NewMessage("MVL", "1E"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newTestClient(t)
+			fake.Respond(tt.query, tt.response)
+			got, err := tt.call(client)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %#v, want %#v", got, tt.want)
+			}
+			assertSent(t, fake, tt.query)
+		})
+	}
+}
+
+func TestClientQueryTimeouts(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(c *eiscp.EISCPClient) error
+	}{
+		{"QueryVolume", func(c *eiscp.EISCPClient) error { _, err := c.QueryVolume(); return err }},
+		{"QuerySubwooferLevel", func(c *eiscp.EISCPClient) error { _, err := c.QuerySubwooferLevel(); return err }},
+		{"QueryInputSelector", func(c *eiscp.EISCPClient) error { _, err := c.QueryInputSelector(); return err }},
+		{"QueryTunerFrequency", func(c *eiscp.EISCPClient) error { _, err := c.QueryTunerFrequency(); return err }},
+		{"QueryPreset", func(c *eiscp.EISCPClient) error { _, err := c.QueryPreset(); return err }},
+		{"QueryStationName", func(c *eiscp.EISCPClient) error { _, err := c.QueryStationName(); return err }},
+		{"QueryAudioInformation", func(c *eiscp.EISCPClient) error { _, err := c.QueryAudioInformation(); return err }},
+		{"QueryVideoInformation", func(c *eiscp.EISCPClient) error { _, err := c.QueryVideoInformation(); return err }},
+		{"QueryModelName", func(c *eiscp.EISCPClient) error { _, err := c.QueryModelName(); return err }},
+		{"QueryDeviceInfo", func(c *eiscp.EISCPClient) error { _, err := c.QueryDeviceInfo(); return err }},
+		{"DetectModel", func(c *eiscp.EISCPClient) error { _, err := c.DetectModel(); return err }},
+		{"SendReceiveCommand", func(c *eiscp.EISCPClient) error { _, err := c.SendReceiveCommand("MVLQSTN"); return err }},
+		{"Exchange", func(c *eiscp.EISCPClient) error { _, err := c.Exchange(eiscp.NewQuery("MVL"), "", 0); return err }},
+		{"FadeVolume", func(c *eiscp.EISCPClient) error {
+			return c.FadeVolume(context.Background(), 10, time.Second, eiscp.FadeLinear)
+		}},
+		{"QueryAlbumArt", func(c *eiscp.EISCPClient) error {
+			defer eiscp.SetAlbumArtTimeout(testTimeout)()
+			_, err := c.QueryAlbumArt()
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newTestClient(t)
+			start := time.Now()
+			if err := tt.call(client); !errors.Is(err, eiscp.ErrTimeout) {
+				t.Fatalf("error = %v, want ErrTimeout", err)
+			}
+			if elapsed := time.Since(start); elapsed < testTimeout {
+				t.Fatalf("gave up after %v, before the %v timeout", elapsed, testTimeout)
+			}
+		})
+	}
+}
+
+func TestClientIgnoresUnrelatedMessages(t *testing.T) {
+	client, fake := newTestClient(t)
+	// Other state changes arriving before the answer are not taken for it
+	fake.Respond("MVLQSTN", "SLI12", "NTM00:01/03:00", "MVL1E")
+	level, err := client.QueryVolume()
+	if err != nil || level != 30 {
+		t.Fatalf("QueryVolume = %d, %v, want 30", level, err)
+	}
+}
+
+func TestClientTimeoutSetting(t *testing.T) {
+	fresh := eiscptest.NewTransport().Client()
+	defer fresh.Close()
+	if got := fresh.Timeout(); got != eiscp.DefaultTimeout {
+		t.Fatalf("default Timeout = %v, want %v", got, eiscp.DefaultTimeout)
+	}
+
+	client, _ := newTestClient(t)
+	client.SetTimeout(20 * time.Millisecond)
+	if got := client.Timeout(); got != 20*time.Millisecond {
+		t.Fatalf("Timeout = %v, want 20ms", got)
+	}
+	start := time.Now()
+	if _, err := client.QueryVolume(); !errors.Is(err, eiscp.ErrTimeout) {
+		t.Fatalf("error = %v, want ErrTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > testTimeout {
+		t.Fatalf("waited %v with 20ms timeout", elapsed)
+	}
+}
+
+func TestClientWriteFailure(t *testing.T) {
+	client, fake := newTestClient(t)
+	fake.FailWrites(errors.New("broken pipe"))
+	if err := client.PowerOff(); !errors.Is(err, eiscp.ErrTransport) {
+		t.Fatalf("PowerOff error = %v, want ErrTransport", err)
+	}
+	if _, err := client.QueryVolume(); !errors.Is(err, eiscp.ErrTransport) {
+		t.Fatalf("QueryVolume error = %v, want ErrTransport", err)
+	}
+
+	fake.FailWrites(nil)
+	if err := client.PowerOff(); err != nil {
+		t.Fatalf("PowerOff after recovery: %v", err)
+	}
+}
+
+func TestClientClosed(t *testing.T) {
+	client, fake := newTestClient(t)
+	messages, _ := client.Subscribe()
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := client.PowerOff(); !errors.Is(err, eiscp.ErrConnection) {
+		t.Fatalf("PowerOff error = %v, want ErrConnection", err)
+	}
+	if _, err := client.Enqueue(eiscp.NewQuery("PWR"), eiscp.PriorityHigh); !errors.Is(err, eiscp.ErrConnection) {
+		t.Fatalf("Enqueue error = %v, want ErrConnection", err)
+	}
+	select {
+	case _, ok := <-messages:
+		if ok {
+			t.Fatal("subscription delivered a message after close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscription was not closed with the client")
+	}
+	assertSent(t, fake)
+}
+
+func TestClientConnectionLostWhileWaiting(t *testing.T) {
+	client, fake := newTestClient(t)
+	client.SetTimeout(time.Second)
+	go func() {
+		waitSent(t, fake, "MVLQSTN")
+		fake.Close()
+	}()
+	if _, err := client.QueryVolume(); !errors.Is(err, eiscp.ErrConnection) {
+		t.Fatalf("error = %v, want ErrConnection", err)
+	}
+}
+
+func TestClientEnqueueBusy(t *testing.T) {
+	client, fake := newTestClient(t)
+	if err := client.SendCommand("NTCPLAY"); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing more goes out, so the queue fills up
+	client.SetCommandGap(time.Hour)
+
+	var queued []*eiscp.Completion
+	for i := 0; i < eiscp.MaxQueuedWrites; i++ {
+		completion, err := client.Enqueue(eiscp.NewMessage("NTC", "TRUP"), eiscp.PriorityNormal)
+		if err != nil {
+			t.Fatalf("Enqueue %d: %v", i, err)
+		}
+		queued = append(queued, completion)
+	}
+	if _, err := client.Enqueue(eiscp.NewMessage("NTC", "TRUP"), eiscp.PriorityNormal); !errors.Is(err, eiscp.ErrBusy) {
+		t.Fatalf("error = %v, want ErrBusy", err)
+	}
+
+	client.Close()
+	for i, completion := range queued {
+		if err := completion.Wait(); !errors.Is(err, eiscp.ErrConnection) {
+			t.Fatalf("queued write %d error = %v, want ErrConnection", i, err)
+		}
+	}
+	assertSent(t, fake, "NTCPLAY")
+}
+
+func TestClientEnqueueCoalesces(t *testing.T) {
+	client, fake := newTestClient(t)
+	if err := client.SendCommand("NTCPLAY"); err != nil {
+		t.Fatal(err)
+	}
+	client.SetCommandGap(100 * time.Millisecond)
+
+	first, err := client.Enqueue(eiscp.NewMessage("MVL", "10"), eiscp.PriorityNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	up, _ := client.Enqueue(eiscp.NewMessage("SWL", "UP"), eiscp.PriorityNormal)
+	second, _ := client.Enqueue(eiscp.NewMessage("MVL", "20"), eiscp.PriorityNormal)
+	power, _ := client.Enqueue(eiscp.NewMessage("PWR", "01"), eiscp.PriorityOf(eiscp.NewMessage("PWR", "01")))
+
+	for _, completion := range []*eiscp.Completion{first, second, up, power} {
+		if err := completion.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if first != second {
+		t.Fatal("newer volume did not replace the queued one")
+	}
+	if got := first.Message(); got != eiscp.NewMessage("MVL", "20") {
+		t.Fatalf("written %s, want MVL20", got)
+	}
+	if first.SentAt().IsZero() {
+		t.Fatal("SentAt not set for written message")
+	}
+	// Power jumps the queue, the newer volume waits for the step queued before it
+	assertSent(t, fake, "NTCPLAY", "PWR01", "SWLUP", "MVL20")
+}
+
+func TestClientExchange(t *testing.T) {
+	client, fake := newTestClient(t)
+	fake.Respond("PWR01", "NLSC-P", "PWR01")
+
+	received, err := client.Exchange(eiscp.NewMessage("PWR", "01"), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []eiscp.Message{eiscp.NewMessage("NLS", "C-P"), eiscp.NewMessage("PWR", "01")}
+	if !reflect.DeepEqual(received, want) {
+		t.Fatalf("received %v, want %v", received, want)
+	}
+
+	// Everything received until the timeout is returned with the error
+	received, err = client.Exchange(eiscp.NewMessage("PWR", "01"), "PWR00", testTimeout)
+	if !errors.Is(err, eiscp.ErrTimeout) {
+		t.Fatalf("error = %v, want ErrTimeout", err)
+	}
+	if !reflect.DeepEqual(received, want) {
+		t.Fatalf("received %v before timeout, want %v", received, want)
+	}
+}
+
+func TestClientSubscribe(t *testing.T) {
+	client, fake := newTestClient(t)
+	messages, cancel := client.Subscribe()
+	fake.Push("MVL1E", "AMT01")
+
+	for _, want := range []string{"MVL1E", "AMT01"} {
+		select {
+		case message := <-messages:
+			if message.String() != want {
+				t.Fatalf("received %s, want %s", message, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s not delivered", want)
+		}
+	}
+
+	cancel()
+	if _, ok := <-messages; ok {
+		t.Fatal("messages delivered after cancel")
+	}
+	// Cancelling twice is harmless
+	cancel()
+}
+
+func TestClientSendConfirmed(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses map[string][]string
+		call      func(c *eiscp.EISCPClient) error
+		wantErr   error
+		wantSent  []string
+		reported  string
+	}{
+		{
+			name:      "echoed",
+			responses: map[string][]string{"MVL1E": {"MVL1E"}},
+			call:      func(c *eiscp.EISCPClient) error { return c.SetMasterVolumeConfirmed(30) },
+			wantSent:  []string{"MVL1E"},
+		},
+		{
+			name:      "echoed lowercase hex",
+			responses: map[string][]string{"MVL1E": {"MVL1e"}},
+			call:      func(c *eiscp.EISCPClient) error { return c.SetMasterVolumeConfirmed(30) },
+			wantSent:  []string{"MVL1E"},
+		},
+		{
+			name:      "power off",
+			responses: map[string][]string{"PWR00": {"PWR00"}},
+			call:      (*eiscp.EISCPClient).PowerOffConfirmed,
+			wantSent:  []string{"PWR00"},
+		},
+		{
+			name:      "input",
+			responses: map[string][]string{"SLI22": {"SLI22"}},
+			call:      func(c *eiscp.EISCPClient) error { return c.SetInputSelectorConfirmed("vinyl") },
+			wantSent:  []string{"SLI22"},
+		},
+		{
+			name:      "subwoofer zero without sign",
+			responses: map[string][]string{"SWL+00": {"SWL00"}},
+			call:      func(c *eiscp.EISCPClient) error { return c.SetSubwooferLevelConfirmed(0) },
+			wantSent:  []string{"SWL+00"},
+		},
+		{
+			name:      "subwoofer with center suffix",
+			responses: map[string][]string{"SWL-02": {"SWL-02C"}},
+			call:      func(c *eiscp.EISCPClient) error { return c.SetSubwooferLevelConfirmed(-2) },
+			wantSent:  []string{"SWL-02"},
+		},
+		{
+			name:      "repeated until echoed",
+			responses: map[string][]string{"MVL1E": {"MVL1D"}},
+			call:      func(c *eiscp.EISCPClient) error { return c.SetMasterVolumeConfirmed(30) },
+			wantErr:   eiscp.ErrMismatch,
+			wantSent:  []string{"MVL1E", "MVL1E", "MVL1E"},
+			reported:  "MVL1D",
+		},
+		{
+			name:      "never echoed asks for the state",
+			responses: map[string][]string{"PWRQSTN": {"PWR00"}},
+			call:      func(c *eiscp.EISCPClient) error { return c.SetInputSelectorConfirmed("tv") },
+			wantErr:   eiscp.ErrMismatch,
+			wantSent:  []string{"SLI12", "SLI12", "SLI12", "SLIQSTN"},
+		},
+		{
+			name:      "never answered at all",
+			responses: map[string][]string{},
+			call:      (*eiscp.EISCPClient).PowerOffConfirmed,
+			wantErr:   eiscp.ErrMismatch,
+			wantSent:  []string{"PWR00", "PWR00", "PWR00", "PWRQSTN"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newTestClient(t)
+			for message, responses := range tt.responses {
+				fake.Respond(message, responses...)
+			}
+			err := tt.call(client)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			var mismatch *eiscp.MismatchError
+			if errors.As(err, &mismatch) && mismatch.Reported.String() != tt.reported {
+				t.Fatalf("reported %q, want %q", mismatch.Reported, tt.reported)
+			}
+			assertSent(t, fake, tt.wantSent...)
+		})
+	}
+}
+
+func TestClientSendConfirmedSuperseded(t *testing.T) {
+	client, fake := newTestClient(t)
+	if err := client.SendCommand("NTCPLAY"); err != nil {
+		t.Fatal(err)
+	}
+	client.SetCommandGap(300 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- client.SetMasterVolumeConfirmed(30)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	// Replaces the confirmed write still waiting for the gap
+	if _, err := client.Enqueue(eiscp.NewMessage("MVL", "14"), eiscp.PriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	// The replaced value is neither repeated nor asked for
+	assertSent(t, fake, "NTCPLAY", "MVL14")
+}
+
+// Callers racing for the volume all succeed, only the values written are confirmed
+func TestClientSendConfirmedConcurrent(t *testing.T) {
+	client, fake := newTestClient(t)
+	for level := 0; level < 10; level++ {
+		message := fmt.Sprintf("MVL%02X", level)
+		fake.Respond(message, message)
+	}
+	client.SetCommandGap(20 * time.Millisecond)
+
+	errs := make(chan error, 10)
+	for level := 0; level < 10; level++ {
+		go func(level int) {
+			errs <- client.SetMasterVolumeConfirmed(level)
+		}(level)
+	}
+	for i := 0; i < 10; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, sent := range fake.Sent() {
+		if sent == "MVLQSTN" {
+			t.Fatalf("sent %q, want no queries", fake.Sent())
+		}
+	}
+}
+
+// Confirmations running side by side each wait for their own echo, one waiting
+// in vain does not take the echo the other one waits for
+func TestClientConfirmedAlongsideOthers(t *testing.T) {
+	client, fake := newTestClient(t)
+	client.SetRetries(0)
+	fake.Respond("SLI22", "SLI22")
+	fake.Respond("PWRQSTN", "PWR01")
+
+	for i := 0; i < 10; i++ {
+		fake.Reset()
+		ignored := make(chan error, 1)
+		go func() { ignored <- client.SetMasterVolumeConfirmed(30) }()
+		time.Sleep(5 * time.Millisecond)
+
+		if err := client.SetInputSelectorConfirmed("vinyl"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.QueryPowerState(); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-ignored; !errors.Is(err, eiscp.ErrMismatch) {
+			t.Fatalf("unanswered volume error = %v, want ErrMismatch", err)
+		}
+		// The state is asked for after the volume was not echoed
+		assertSent(t, fake, "MVL1E", "SLI22", "PWRQSTN", "MVLQSTN")
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	client, fake := newTestClient(t)
+	if client.Retries() != eiscp.DefaultRetries {
+		t.Fatalf("Retries = %d, want %d", client.Retries(), eiscp.DefaultRetries)
+	}
+	client.SetRetries(0)
+	fake.Respond("MVL1E", "MVL00")
+	if _, err := client.SendConfirmed(eiscp.NewMessage("MVL", "1E")); !errors.Is(err, eiscp.ErrMismatch) {
+		t.Fatalf("error = %v, want ErrMismatch", err)
+	}
+	assertSent(t, fake, "MVL1E")
+}
+
+func TestClientPowerOn(t *testing.T) {
+	tests := []struct {
+		name      string
+		confirmed bool
+		responses map[string][]string
+		wantErr   error
+		wantSent  []string
+		wantState eiscp.PowerState
+	}{
+		{
+			name:      "already on",
+			responses: map[string][]string{"PWRQSTN": {"PWR01"}},
+			wantSent:  []string{"PWRQSTN"},
+			wantState: eiscp.PowerStateOn,
+		},
+		{
+			name:      "from standby",
+			responses: map[string][]string{"PWRQSTN": {"PWR00"}, "PWR01": {"PWR01"}},
+			wantSent:  []string{"PWRQSTN", "PWR01"},
+			wantState: eiscp.PowerStateOn,
+		},
+		{
+			name:      "echo timing out is fine",
+			responses: map[string][]string{"PWRQSTN": {"PWR00"}},
+			wantSent:  []string{"PWRQSTN", "PWR01"},
+			wantState: eiscp.PowerStateStandby,
+		},
+		{
+			name:      "state unknown",
+			responses: map[string][]string{"PWR01": {"PWR01"}},
+			wantSent:  []string{"PWRQSTN", "PWR01"},
+			wantState: eiscp.PowerStateOn,
+		},
+		{
+			name:      "confirmed",
+			confirmed: true,
+			responses: map[string][]string{"PWRQSTN": {"PWR00"}, "PWR01": {"PWR01"}},
+			wantSent:  []string{"PWRQSTN", "PWR01"},
+			wantState: eiscp.PowerStateOn,
+		},
+		{
+			name:      "confirmed without echo",
+			confirmed: true,
+			responses: map[string][]string{"PWRQSTN": {"PWR00"}},
+			wantErr:   eiscp.ErrMismatch,
+			wantSent:  []string{"PWRQSTN", "PWR01", "PWR01", "PWR01", "PWRQSTN"},
+			wantState: eiscp.PowerStateStandby,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newTestClient(t)
+			for message, responses := range tt.responses {
+				fake.Respond(message, responses...)
+			}
+			call := client.PowerOn
+			if tt.confirmed {
+				call = client.PowerOnConfirmed
+			}
+			if err := call(); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			assertSent(t, fake, tt.wantSent...)
+			if got := client.PowerState(); got != tt.wantState {
+				t.Fatalf("PowerState = %s, want %s", got, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestClientPowerState(t *testing.T) {
+	client, fake := newTestClient(t)
+	if got := client.PowerState(); got != eiscp.PowerStateUnknown {
+		t.Fatalf("initial PowerState = %s, want unknown", got)
+	}
+	messages, cancel := client.Subscribe()
+	defer cancel()
+
+	// Changes made with the remote are followed too
+	for _, tt := range []struct {
+		message string
+		want    eiscp.PowerState
+	}{
+		{"PWR01", eiscp.PowerStateOn},
+		{"PWR00", eiscp.PowerStateStandby},
+		{"PWRN/A", eiscp.PowerStateStandby},
+	} {
+		fake.Push(tt.message)
+		<-messages
+		if got := client.PowerState(); got != tt.want {
+			t.Fatalf("after %s PowerState = %s, want %s", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestClientQueryPowerState(t *testing.T) {
+	tests := []struct {
+		responses []string
+		want      eiscp.PowerState
+		wantErr   error
+	}{
+		{[]string{"PWR01"}, eiscp.PowerStateOn, nil},
+		{[]string{"PWR00"}, eiscp.PowerStateStandby, nil},
+		{[]string{"PWRN/A"}, eiscp.PowerStateUnknown, nil},
+		{nil, eiscp.PowerStateUnknown, eiscp.ErrTimeout},
+	}
+	for _, tt := range tests {
+		client, fake := newTestClient(t)
+		fake.Respond("PWRQSTN", tt.responses...)
+		got, err := client.QueryPowerState()
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("%v: QueryPowerState = %s, %v, want %s, %v", tt.responses, got, err, tt.want, tt.wantErr)
+		}
+		if client.PowerState() != got {
+			t.Errorf("%v: PowerState = %s, not updated to %s", tt.responses, client.PowerState(), got)
+		}
+	}
+}
+
+func TestClientSettleTime(t *testing.T) {
+	fresh := eiscptest.NewTransport().Client()
+	defer fresh.Close()
+	if got := fresh.SettleTime(); got != eiscp.DefaultSettleTime {
+		t.Fatalf("default SettleTime = %v, want %v", got, eiscp.DefaultSettleTime)
+	}
+
+	client, fake := newTestClient(t)
+	const settleTime = 150 * time.Millisecond
+	client.SetSettleTime(settleTime)
+	if got := client.SettleTime(); got != settleTime {
+		t.Fatalf("SettleTime = %v, want %v", got, settleTime)
+	}
+	fake.Respond("PWRQSTN", "PWR00")
+	fake.Respond("PWR01", "PWR01")
+
+	if err := client.PowerOn(); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := client.SetMasterVolume(10); err != nil {
+		t.Fatal(err)
+	}
+	// Commands sent right after waking up would be dropped by the receiver
+	if elapsed := time.Since(start); elapsed < settleTime-20*time.Millisecond {
+		t.Fatalf("volume written %v after power on, want at least %v", elapsed, settleTime)
+	}
+	assertSent(t, fake, "PWRQSTN", "PWR01", "MVL0A")
+}
+
+func TestClientFadeVolume(t *testing.T) {
+	client, fake := newTestClient(t)
+	fake.Respond("MVLQSTN", "MVL0A")
+
+	if err := client.FadeVolume(context.Background(), 13, 150*time.Millisecond, eiscp.FadeLinear); err != nil {
+		t.Fatal(err)
+	}
+	sent := fake.Sent()
+	if sent[0] != "MVLQSTN" || sent[len(sent)-1] != "MVL0D" {
+		t.Fatalf("sent %q, want query then steps up to MVL0D", sent)
+	}
+	// Every step moves towards the target
+	for i := 2; i < len(sent); i++ {
+		if sent[i] <= sent[i-1] {
+			t.Fatalf("steps not increasing: %q", sent)
+		}
+	}
+}
+
+func TestClientFadeVolumeUnchanged(t *testing.T) {
+	client, fake := newTestClient(t)
+	fake.Respond("MVLQSTN", "MVL0A")
+	if err := client.FadeVolume(context.Background(), 10, time.Second, eiscp.FadeSCurve); err != nil {
+		t.Fatal(err)
+	}
+	assertSent(t, fake, "MVLQSTN")
+}
+
+func TestClientFadeVolumeCancelled(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		cancel func(c *eiscp.EISCPClient, cancel context.CancelFunc)
+	}{
+		{"by the caller", func(c *eiscp.EISCPClient, cancel context.CancelFunc) { cancel() }},
+		{"by volume command", func(c *eiscp.EISCPClient, cancel context.CancelFunc) { c.SetMasterVolume(5) }},
+		{"by volume step", func(c *eiscp.EISCPClient, cancel context.CancelFunc) { c.VolumeDown() }},
+		{"by another fade", func(c *eiscp.EISCPClient, cancel context.CancelFunc) {
+			c.FadeVolume(context.Background(), 10, time.Second, eiscp.FadeLinear)
+		}},
+		{"by closing", func(c *eiscp.EISCPClient, cancel context.CancelFunc) { c.Close() }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newTestClient(t)
+			fake.Respond("MVLQSTN", "MVL0A")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan error, 1)
+			go func() {
+				done <- client.FadeVolume(ctx, 40, 10*time.Second, eiscp.FadeEaseIn)
+			}()
+			waitSent(t, fake, "MVLQSTN")
+			tt.cancel(client, cancel)
+
+			select {
+			case err := <-done:
+				if !errors.Is(err, context.Canceled) {
+					t.Fatalf("error = %v, want context.Canceled", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("fade kept going")
+			}
+		})
+	}
+}
+
+func TestClientFadeVolumeNoStepAfterCancel(t *testing.T) {
+	client, fake := newTestClient(t)
+	fake.Respond("MVLQSTN", "MVL0A")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- client.FadeVolume(context.Background(), 40, 1500*time.Millisecond, eiscp.FadeLinear)
+	}()
+	waitSent(t, fake, "MVL0B")
+	if err := client.SetMasterVolume(5); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+
+	// Nothing of the fade follows the volume command that cancelled it
+	time.Sleep(150 * time.Millisecond)
+	sent := fake.Sent()
+	if last := sent[len(sent)-1]; last != "MVL05" {
+		t.Fatalf("sent %v, fade step written after MVL05", sent)
+	}
+}
+
+func TestClientFadeVolumeConcurrent(t *testing.T) {
+	client, fake := newTestClient(t)
+	// Answered twice, queries sent together share the responses
+	fake.Respond("MVLQSTN", "MVL0A", "MVL0A")
+
+	errs := make(chan error, 2)
+	for _, level := range []int{12, 14} {
+		go func(level int) {
+			errs <- client.FadeVolume(context.Background(), level, time.Second, eiscp.FadeLinear)
+		}(level)
+	}
+	// Whichever started last cancels the other
+	cancelled := 0
+	for i := 0; i < 2; i++ {
+		err := <-errs
+		switch {
+		case errors.Is(err, context.Canceled):
+			cancelled++
+		case err != nil:
+			t.Fatal(err)
+		}
+	}
+	if cancelled != 1 {
+		t.Fatalf("%d fades cancelled, want 1", cancelled)
+	}
+}
+
+func TestClientAlbumArt(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []string
+		want      *eiscp.AlbumArt
+		wantErr   error
+	}{
+		{
+			name:      "jpeg in chunks",
+			responses: []string{"NJA10ffd8", "NJA11ffe0", "NJA12ffd9"},
+			want:      &eiscp.AlbumArt{ContentType: "image/jpeg", Data: []byte{0xff, 0xd8, 0xff, 0xe0, 0xff, 0xd9}},
+		},
+		{
+			name:      "bmp in one chunk",
+			responses: []string{"NJA00424d", "NJA02"},
+			want:      &eiscp.AlbumArt{ContentType: "image/bmp", Data: []byte{0x42, 0x4d}},
+		},
+		{
+			name:      "url",
+			responses: []string{"NJA2-http://192.168.1.20/album_art.cgi"},
+			want:      &eiscp.AlbumArt{URL: "http://192.168.1.20/album_art.cgi"},
+		},
+		{
+			name:      "no image",
+			responses: []string{"NJAn-"},
+			wantErr:   eiscp.ErrNotAvailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newTestClient(t)
+			fake.Respond("NJAREQ", tt.responses...)
+
+			art, err := client.QueryAlbumArt()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.want == nil {
+				if _, ok := client.AlbumArt(); ok {
+					t.Fatal("AlbumArt reported art for track without any")
+				}
+				return
+			}
+			if art.ContentType != tt.want.ContentType || string(art.Data) != string(tt.want.Data) || art.URL != tt.want.URL {
+				t.Fatalf("art = %+v, want %+v", art, tt.want)
+			}
+			if latest, ok := client.AlbumArt(); !ok || latest != art {
+				t.Fatal("AlbumArt does not return the received art")
+			}
+		})
+	}
+}
+
+func TestClientAlbumArtCorruptedChunk(t *testing.T) {
+	client, fake := newTestClient(t)
+	defer eiscp.SetAlbumArtTimeout(testTimeout)()
+	// The image is spoiled and the chunks after it are ignored
+	fake.Respond("NJAREQ", "NJA10ffd8", "NJA11zz", "NJA12ffd9")
+	if _, err := client.QueryAlbumArt(); !errors.Is(err, eiscp.ErrTimeout) {
+		t.Fatalf("error = %v, want ErrTimeout", err)
+	}
+}
+
+const testDeviceInfo = `<?xml version="1.0" encoding="utf-8"?>
+<response status="ok"><device id="TX-NR696">
+<brand>ONKYO</brand><model>TX-NR696</model><friendlyname>Living Room</friendlyname>
+<firmwareversion>1110-0000-0000-0010-0000</firmwareversion>
+<netservicelist><netservice id="0A" value="1" name="Spotify"/><netservice id="0E" value="0" name="TuneIn"/></netservicelist>
+<zonelist>
+<zone id="1" value="1" name="Main" volmax="80" volstep="1"/>
+<zone id="2" value="1" name="Zone2" volmax="80" volstep="1"/>
+<zone id="3" value="0" name="Zone3" volmax="80" volstep="1"/>
+</zonelist>
+<selectorlist>
+<selector id="10" value="1" name="BD/DVD"/>
+<selector id="23" value="1" name=" Phono "/>
+<selector id="02" value="0" name="GAME"/>
+</selectorlist>
+<functionlist><tuners><tuner band="FM" min="87500" max="108000" step="50"/></tuners></functionlist>
+</device></response>`
+
+func TestClientQueryDeviceInfo(t *testing.T) {
+	client, fake := newTestClient(t)
+	fake.Respond("NRIQSTN", "NRI"+testDeviceInfo)
+
+	info, err := client.QueryDeviceInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &eiscp.DeviceInfo{
+		Brand:           "ONKYO",
+		Model:           "TX-NR696",
+		FriendlyName:    "Living Room",
+		FirmwareVersion: "1110-0000-0000-0010-0000",
+		Zones: []eiscp.Zone{
+			{ID: "1", Name: "Main", Available: true, MaxVolume: 80, VolumeStep: 1},
+			{ID: "2", Name: "Zone2", Available: true, MaxVolume: 80, VolumeStep: 1},
+			{ID: "3", Name: "Zone3", Available: false, MaxVolume: 80, VolumeStep: 1},
+		},
+		Inputs:      []eiscp.InputSelector{{Code: "10", Name: "BD/DVD"}, {Code: "23", Name: " Phono "}},
+		Tuners:      []eiscp.TunerBand{{Band: "fm", Min: 87500, Max: 108000, Step: 50}},
+		NetServices: []eiscp.NetService{{ID: "0A", Name: "Spotify"}},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Fatalf("info = %+v\nwant %+v", info, want)
+	}
+
+	model := client.Model()
+	if model.Name != "TX-NR696" || model.MaxVolume != 80 || model.VolumeScale.StepDB != 0.5 {
+		t.Fatalf("model = %+v, want TX-NR696 with 80 half dB steps", model)
+	}
+	if !reflect.DeepEqual(model.Zones, []string{"main", "zone2"}) {
+		t.Fatalf("zones = %q, want the available ones", model.Zones)
+	}
+	// Only the inputs enabled on the unit are selectable
+	if got, want := client.Inputs(), []string{"bd/dvd", "phono"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Inputs = %q, want %q", got, want)
+	}
+	for name, code := range map[string]string{"bd/dvd": "10", "phono": "23"} {
+		if got, ok := client.InputCode(name); !ok || got != code {
+			t.Errorf("InputCode(%q) = %q, %v, want %q", name, got, ok, code)
+		}
+	}
+	for _, name := range []string{"game", "tv"} {
+		if _, ok := client.InputCode(name); ok {
+			t.Errorf("input %q the unit does not offer is selectable", name)
+		}
+	}
+}
+
+func TestClientQueryDeviceInfoErrors(t *testing.T) {
+	client, fake := newTestClient(t)
+	fake.Respond("NRIQSTN", "NRI<response><device>")
+	if _, err := client.QueryDeviceInfo(); !errors.Is(err, eiscp.ErrTransport) {
+		t.Fatalf("error = %v, want ErrTransport", err)
+	}
+	if got := client.Model().Name; got != "unknown" {
+		t.Fatalf("model = %s after failed detection, want unknown", got)
+	}
+}
+
+func TestClientDetectModel(t *testing.T) {
+	tests := []struct {
+		name      string
+		pinned    string
+		responses map[string]string
+		wantModel string
+		wantMax   int
+		wantErr   error
+	}{
+		{"from device info", "", map[string]string{"NRIQSTN": "NRI" + testDeviceInfo}, "TX-NR696", 80, nil},
+		{"falls back to ECN", "", map[string]string{"ECNQSTN": "ECNDTR-50.7/60128/DX/0009B0123456"}, "DTR-50.7", 80, nil},
+		{"unknown model keeps limits", "", map[string]string{"ECNQSTN": "ECNSR-9000/60128/DX/0009B0123456"}, "unknown", 50, nil},
+		{"nothing answers", "", nil, "unknown", 50, eiscp.ErrTimeout},
+		{"pinned model stays", "TX-L20D", map[string]string{"NRIQSTN": "NRI" + testDeviceInfo}, "TX-L20D", 50, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newTestClient(t)
+			if tt.pinned != "" {
+				if err := client.SetModel(tt.pinned); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for message, response := range tt.responses {
+				fake.Respond(message, response)
+			}
+			model, err := client.DetectModel()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if model.Name != tt.wantModel || model.MaxVolume != tt.wantMax || client.MaxVolume() != tt.wantMax {
+				t.Fatalf("model = %s max %d, want %s max %d", model.Name, model.MaxVolume, tt.wantModel, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestClientModel(t *testing.T) {
+	client, _ := newTestClient(t)
+	// Nothing is rejected before the model is known
+	if model := client.Model(); model.Name != "unknown" || !model.Supports("IFV") || !model.HasZone("zone4") {
+		t.Fatalf("initial model = %+v, want unrestricted unknown model", model)
+	}
+	if err := client.SetModel("tx-nr696"); err != nil {
+		t.Fatal(err)
+	}
+	model := client.Model()
+	if model.Name != "TX-NR696" || client.MaxVolume() != 80 || client.VolumeScale().StepDB != 0.5 {
+		t.Fatalf("model = %+v, want TX-NR family", model)
+	}
+	if !model.HasZone("zone2") || model.HasZone("zone4") {
+		t.Fatalf("TX-NR696 zones = %q", model.Zones)
+	}
+}
+
+func TestClientInputs(t *testing.T) {
+	client, _ := newTestClient(t)
+	want := []string{"am", "dab", "dj", "fm", "spotify", "tv", "vinyl"}
+	if got := client.Inputs(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Inputs = %q, want %q", got, want)
+	}
+	if code, ok := client.InputCode("vinyl"); !ok || code != "22" {
+		t.Fatalf("InputCode(vinyl) = %q, %v", code, ok)
+	}
+	if _, ok := client.InputCode("laserdisc"); ok {
+		t.Fatal("InputCode found unknown input")
+	}
+	if name, ok := client.InputName("12"); !ok || name != "tv" {
+		t.Fatalf("InputName(12) = %q, %v", name, ok)
+	}
+	if _, ok := client.InputName("99"); ok {
+		t.Fatal("InputName found unknown code")
+	}
+}
+
+func TestDial(t *testing.T) {
+	fake := eiscptest.NewTransport()
+	client, err := eiscp.Dial(fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	failure := errors.New("no route to host")
+	_, err = eiscp.Dial(eiscp.DialerFunc(func() (eiscp.Transport, error) { return nil, failure }))
+	if !errors.Is(err, failure) {
+		t.Fatalf("error = %v, want the dialer error", err)
+	}
+}
+
+func TestEISCPClientOverTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no loopback network: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		packet, err := eiscp.ReadEISCPPacket(conn)
+		if err != nil || string(packet.Data) != "!1MVLQSTN\r" {
+			return
+		}
+		// A garbled message is skipped, the answer split across writes still arrives
+		garbled := eiscp.NewEISCPPacket(eiscp.Message{})
+		garbled.Data = []byte("garbage\r")
+		garbled.DataSize = uint32(len(garbled.Data))
+		conn.Write(garbled.Bytes())
+		answer := eiscp.NewEISCPPacket(eiscp.NewMessage("MVL", "1E")).Bytes()
+		conn.Write(answer[:10])
+		time.Sleep(10 * time.Millisecond)
+		conn.Write(answer[10:])
+		time.Sleep(time.Second)
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	client, err := eiscp.NewEISCPClient(host, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.SetTimeout(time.Second)
+
+	level, err := client.QueryVolume()
+	if err != nil || level != 30 {
+		t.Fatalf("QueryVolume = %d, %v, want 30", level, err)
+	}
+}
+
+func TestNewEISCPClientRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no loopback network: %v", err)
+	}
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+
+	if _, err := eiscp.NewEISCPClient(host, port); !errors.Is(err, eiscp.ErrConnection) {
+		t.Fatalf("error = %v, want ErrConnection", err)
+	}
+}
@@ -0,0 +1,139 @@
+package eiscp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// How many times confirmed writes are repeated when the receiver does not apply them
+const DefaultRetries = 2
+
+// MismatchError means the receiver did not apply the requested state
+type MismatchError struct {
+	Requested Message
+	// State reported by the receiver, zero when it never answered
+	Reported Message
+}
+
+func (e *MismatchError) Error() string {
+	if e.Reported.Command == "" {
+		return fmt.Sprintf("%s: receiver did not confirm %s", ErrMismatch, e.Requested)
+	}
+	return fmt.Sprintf("%s: requested %s, receiver reports %s", ErrMismatch, e.Requested, e.Reported)
+}
+
+func (e *MismatchError) Unwrap() error {
+	return ErrMismatch
+}
+
+// Changes how many times confirmed writes are repeated
+func (c *EISCPClient) SetRetries(retries int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.retries = retries
+}
+
+func (c *EISCPClient) Retries() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.retries
+}
+
+// Sends ISCP message and waits until the receiver echoes the same state back.
+// Writes are repeated when the echo differs or does not come, then MismatchError is returned.
+func (c *EISCPClient) SendConfirmed(message Message) (Message, error) {
+	return c.confirm(message, func(reported Message) bool {
+		return strings.EqualFold(reported.Parameter, message.Parameter)
+	})
+}
+
+// Writes the message until the reported state matches.
+// Values replaced in the queue by newer ones count as confirmed and the newer value is
+// returned. Repeating them would undo the newer value, whose own caller confirms it.
+func (c *EISCPClient) confirm(message Message, matches func(Message) bool) (Message, error) {
+	if err := c.checkSupported(message.Command); err != nil {
+		return Message{}, err
+	}
+
+	var reported Message
+	for attempt := 0; attempt <= c.Retries(); attempt++ {
+		response, superseded, err := c.writeEchoed(message)
+		switch {
+		case superseded:
+			return response, nil
+		case err == nil && matches(response):
+			return response, nil
+		case err == nil:
+			reported = response
+		case !errors.Is(err, ErrTimeout):
+			return Message{}, err
+		}
+	}
+
+	// Ignored writes are not echoed, e.g. in standby, so ask for the state explaining why
+	if reported.Command == "" {
+		if response, err := c.receive(NewQuery(message.Command)); err == nil {
+			reported = response
+		}
+	}
+	return reported, &MismatchError{Requested: message, Reported: reported}
+}
+
+// Writes the message once and waits for the receiver to echo the command.
+// Reports the newer value that replaced the message in the queue instead, if any.
+func (c *EISCPClient) writeEchoed(message Message) (Message, bool, error) {
+	// Subscribed before queueing, the echo may come right after the write
+	messages, cancel := c.Subscribe()
+	defer cancel()
+
+	completion, err := c.Enqueue(message, PriorityOf(message))
+	if err != nil {
+		return Message{}, false, err
+	}
+	if err := completion.Wait(); err != nil {
+		return Message{}, false, err
+	}
+	if written := completion.Message(); written != message {
+		return written, true, nil
+	}
+	response, err := c.await(messages, message.Command)
+	return response, false, err
+}
+
+func (c *EISCPClient) PowerOffConfirmed() error {
+	_, err := c.SendConfirmed(NewMessage("PWR", "00"))
+	return err
+}
+
+func (c *EISCPClient) SetMasterVolumeConfirmed(level int) error {
+	c.cancelFade()
+	message, err := c.volumeMessage(level)
+	if err != nil {
+		return err
+	}
+	_, err = c.SendConfirmed(message)
+	return err
+}
+
+func (c *EISCPClient) SetSubwooferLevelConfirmed(level int) error {
+	message, err := c.subwooferMessage(level)
+	if err != nil {
+		return err
+	}
+	// Zero is reported without the sign and some models add a suffix
+	_, err = c.confirm(message, func(reported Message) bool {
+		value, err := ParseSubwooferLevel(reported.Parameter)
+		return err == nil && value == level
+	})
+	return err
+}
+
+func (c *EISCPClient) SetInputSelectorConfirmed(input string) error {
+	message, err := c.inputMessage(input)
+	if err != nil {
+		return err
+	}
+	_, err = c.SendConfirmed(message)
+	return err
+}
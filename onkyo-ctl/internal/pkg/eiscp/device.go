@@ -0,0 +1,193 @@
+package eiscp
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// DeviceInfo is what the receiver reports about itself in the NRI message
+type DeviceInfo struct {
+	Brand           string          `json:"brand"`
+	Model           string          `json:"model"`
+	FriendlyName    string          `json:"friendlyName"`
+	FirmwareVersion string          `json:"firmwareVersion"`
+	Zones           []Zone          `json:"zones"`
+	Inputs          []InputSelector `json:"inputs"`
+	Tuners          []TunerBand     `json:"tuners"`
+	NetServices     []NetService    `json:"netServices"`
+}
+
+type Zone struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+	MaxVolume int    `json:"maxVolume"`
+	// 0 - whole steps, 1 - half steps
+	VolumeStep int `json:"volumeStep"`
+}
+
+// InputSelector is an input with the name given to it on the unit
+type InputSelector struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// TunerBand limits are given in kHz
+type TunerBand struct {
+	Band string `json:"band"`
+	Min  int    `json:"min"`
+	Max  int    `json:"max"`
+	Step int    `json:"step"`
+}
+
+type NetService struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type nriResponse struct {
+	Device struct {
+		Brand           string `xml:"brand"`
+		Model           string `xml:"model"`
+		FriendlyName    string `xml:"friendlyname"`
+		FirmwareVersion string `xml:"firmwareversion"`
+		NetServices     []struct {
+			ID    string `xml:"id,attr"`
+			Value string `xml:"value,attr"`
+			Name  string `xml:"name,attr"`
+		} `xml:"netservicelist>netservice"`
+		Zones []struct {
+			ID      string `xml:"id,attr"`
+			Value   string `xml:"value,attr"`
+			Name    string `xml:"name,attr"`
+			VolMax  int    `xml:"volmax,attr"`
+			VolStep int    `xml:"volstep,attr"`
+		} `xml:"zonelist>zone"`
+		Selectors []struct {
+			ID    string `xml:"id,attr"`
+			Value string `xml:"value,attr"`
+			Name  string `xml:"name,attr"`
+		} `xml:"selectorlist>selector"`
+		Tuners []struct {
+			Band string `xml:"band,attr"`
+			Min  int    `xml:"min,attr"`
+			Max  int    `xml:"max,attr"`
+			Step int    `xml:"step,attr"`
+		} `xml:"functionlist>tuners>tuner"`
+	} `xml:"device"`
+}
+
+// Parses the XML document carried by the NRI message
+func ParseDeviceInfo(document string) (*DeviceInfo, error) {
+	var response nriResponse
+	if err := xml.Unmarshal([]byte(document), &response); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse device information: %v", ErrTransport, err)
+	}
+
+	device := response.Device
+	info := &DeviceInfo{
+		Brand:           device.Brand,
+		Model:           device.Model,
+		FriendlyName:    device.FriendlyName,
+		FirmwareVersion: device.FirmwareVersion,
+	}
+	for _, zone := range device.Zones {
+		info.Zones = append(info.Zones, Zone{
+			ID:         zone.ID,
+			Name:       zone.Name,
+			Available:  zone.Value == "1",
+			MaxVolume:  zone.VolMax,
+			VolumeStep: zone.VolStep,
+		})
+	}
+	// Inputs switched off on the unit are reported with value 0
+	for _, selector := range device.Selectors {
+		if selector.Value == "1" {
+			info.Inputs = append(info.Inputs, InputSelector{Code: selector.ID, Name: selector.Name})
+		}
+	}
+	for _, tuner := range device.Tuners {
+		info.Tuners = append(info.Tuners, TunerBand{
+			Band: strings.ToLower(tuner.Band),
+			Min:  tuner.Min,
+			Max:  tuner.Max,
+			Step: tuner.Step,
+		})
+	}
+	for _, service := range device.NetServices {
+		if service.Value == "1" {
+			info.NetServices = append(info.NetServices, NetService{ID: service.ID, Name: service.Name})
+		}
+	}
+	return info, nil
+}
+
+// Returns the main zone, if the device reported one
+func (d *DeviceInfo) MainZone() (Zone, bool) {
+	for _, zone := range d.Zones {
+		if zone.ID == "1" {
+			return zone, true
+		}
+	}
+	return Zone{}, false
+}
+
+// Names of the available zones as used by the model profiles, e.g. "zone2" for zone 2
+func (d *DeviceInfo) ZoneNames() []string {
+	var names []string
+	for _, zone := range d.Zones {
+		if !zone.Available {
+			continue
+		}
+		if zone.ID == "1" {
+			names = append(names, "main")
+		} else {
+			names = append(names, "zone"+zone.ID)
+		}
+	}
+	return names
+}
+
+// Fetches the device information and uses it for validating further commands
+func (c *EISCPClient) QueryDeviceInfo() (*DeviceInfo, error) {
+	response, err := c.receive(NewQuery("NRI"))
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := ParseDeviceInfo(response.Parameter)
+	if err != nil {
+		return nil, err
+	}
+	c.applyDeviceInfo(info)
+	return info, nil
+}
+
+func (c *EISCPClient) applyDeviceInfo(info *DeviceInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Inputs the unit reports replace the default ones, those it lacks or has disabled are gone
+	if len(info.Inputs) > 0 {
+		inputCodes := make(map[string]string, len(info.Inputs))
+		for _, input := range info.Inputs {
+			inputCodes[strings.ToLower(strings.TrimSpace(input.Name))] = input.Code
+		}
+		c.inputCodes = inputCodes
+	}
+	if !c.modelPinned {
+		c.detectedModel(info.Model)
+		// Limits reported by the device itself beat the family defaults
+		if zone, ok := info.MainZone(); ok && zone.MaxVolume > 0 {
+			c.model.MaxVolume = zone.MaxVolume
+			if zone.VolumeStep == 1 {
+				c.model.VolumeScale.StepDB = 0.5
+			}
+		}
+	}
+	// Zones the unit has are known better than those of its family, even for pinned models
+	if zones := info.ZoneNames(); len(zones) > 0 {
+		c.model.Zones = zones
+	}
+}
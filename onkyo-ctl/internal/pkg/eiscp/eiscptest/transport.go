@@ -0,0 +1,133 @@
+// Package eiscptest provides an in-memory receiver for exercising eiscp clients
+// without the hardware.
+package eiscptest
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+)
+
+// Transport is a fake receiver.
+// It records every message the client sends and answers with scripted responses.
+// Messages nobody scripted a response for stay unanswered, so queries time out.
+type Transport struct {
+	mu        sync.Mutex
+	sent      []string
+	responses map[string][]string
+	writeErr  error
+	incoming  chan eiscp.Message
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+var _ eiscp.Transport = (*Transport)(nil)
+
+func NewTransport() *Transport {
+	return &Transport{
+		responses: make(map[string][]string),
+		incoming:  make(chan eiscp.Message, 100),
+		closed:    make(chan struct{}),
+	}
+}
+
+// Creates the client connected to the fake
+func (t *Transport) Client() *eiscp.EISCPClient {
+	return eiscp.NewClient(t)
+}
+
+// Dial lets the fake be used wherever a dialer is expected
+func (t *Transport) Dial() (eiscp.Transport, error) {
+	return t, nil
+}
+
+// Respond scripts messages sent back whenever the client sends the message.
+// Messages are given in the bare form, e.g. Respond("MVLQSTN", "MVL1E").
+func (t *Transport) Respond(message string, responses ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.responses[message] = responses
+}
+
+// Push delivers unsolicited messages, like the receiver reporting a state change.
+// Messages that are not even three letters long are dropped.
+func (t *Transport) Push(messages ...string) {
+	for _, text := range messages {
+		// Not ParseMessage, the receiver sends what users may not, e.g. NRI XML spanning lines
+		text = strings.TrimSpace(text)
+		if len(text) < 3 {
+			continue
+		}
+		t.PushMessage(eiscp.NewMessage(strings.ToUpper(text[:3]), text[3:]))
+	}
+}
+
+// PushMessage delivers unsolicited message with unit type of choice
+func (t *Transport) PushMessage(messages ...eiscp.Message) {
+	for _, message := range messages {
+		select {
+		case t.incoming <- message:
+		case <-t.closed:
+			return
+		}
+	}
+}
+
+// FailWrites makes every following write fail with the error, nil restores writes
+func (t *Transport) FailWrites(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.writeErr = err
+}
+
+// Sent returns messages written by the client so far, in the bare form
+func (t *Transport) Sent() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.sent...)
+}
+
+// Reset forgets the messages sent so far, scripted responses stay
+func (t *Transport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sent = nil
+}
+
+func (t *Transport) WriteMessage(message eiscp.Message) error {
+	select {
+	case <-t.closed:
+		return errors.New("transport closed")
+	default:
+	}
+
+	t.mu.Lock()
+	if t.writeErr != nil {
+		err := t.writeErr
+		t.mu.Unlock()
+		return err
+	}
+	t.sent = append(t.sent, message.String())
+	responses := t.responses[message.String()]
+	t.mu.Unlock()
+
+	t.Push(responses...)
+	return nil
+}
+
+func (t *Transport) ReadMessage() (eiscp.Message, error) {
+	select {
+	case message := <-t.incoming:
+		return message, nil
+	case <-t.closed:
+		return eiscp.Message{}, io.EOF
+	}
+}
+
+func (t *Transport) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	return nil
+}
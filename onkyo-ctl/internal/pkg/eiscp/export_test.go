@@ -0,0 +1,10 @@
+package eiscp
+
+import "time"
+
+// SetAlbumArtTimeout shortens the album art timeout for tests, returning the restore function
+func SetAlbumArtTimeout(timeout time.Duration) func() {
+	previous := albumArtTimeout
+	albumArtTimeout = timeout
+	return func() { albumArtTimeout = previous }
+}
@@ -0,0 +1,146 @@
+package eiscp
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// FadeCurve shapes how the volume moves from the current to the target level
+type FadeCurve string
+
+const (
+	FadeLinear  FadeCurve = "linear"
+	FadeEaseIn  FadeCurve = "ease-in"
+	FadeEaseOut FadeCurve = "ease-out"
+	FadeSCurve  FadeCurve = "s-curve"
+)
+
+// Maps elapsed fraction of the fade to the fraction of the volume change
+var fadeCurves = map[FadeCurve]func(t float64) float64{
+	FadeLinear:  func(t float64) float64 { return t },
+	FadeEaseIn:  func(t float64) float64 { return t * t },
+	FadeEaseOut: func(t float64) float64 { return 1 - (1-t)*(1-t) },
+	FadeSCurve:  func(t float64) float64 { return (1 - math.Cos(t*math.Pi)) / 2 },
+}
+
+// Shortest gap between two volume commands of a fade
+const minFadeInterval = 50 * time.Millisecond
+
+// Cancels the fade in progress, if any.
+// Any volume command takes precedence over a fade.
+func (c *EISCPClient) cancelFade() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fadeCancel != nil {
+		c.fadeCancel()
+		c.fadeCancel = nil
+	}
+}
+
+// Checks fade parameters up front, for callers running the fade in background
+func (c *EISCPClient) ValidateFade(level int, duration time.Duration, curve FadeCurve) error {
+	if _, ok := fadeCurves[curve]; !ok {
+		return fmt.Errorf("%w: invalid fade curve '%s'", ErrValidation, curve)
+	}
+	maxVolume := c.MaxVolume()
+	if level < 0 || level > maxVolume {
+		return fmt.Errorf("%w: volume level %d must be between 0 and %d", ErrValidation, level, maxVolume)
+	}
+	if duration <= 0 {
+		return fmt.Errorf("%w: fade duration must be positive", ErrValidation)
+	}
+	return nil
+}
+
+// Gradually changes the volume to the target level over the duration.
+// Returns the context error when cancelled, either by the caller or by another volume command.
+func (c *EISCPClient) FadeVolume(ctx context.Context, level int, duration time.Duration, curve FadeCurve) error {
+	if err := c.ValidateFade(level, duration, curve); err != nil {
+		return err
+	}
+	shape := fadeCurves[curve]
+
+	// Cancelling the previous fade and taking its place is one step,
+	// two fades started together cannot both keep running
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c.mu.Lock()
+	if c.fadeCancel != nil {
+		c.fadeCancel()
+	}
+	c.fadeCancel = cancel
+	c.mu.Unlock()
+
+	start, err := c.QueryVolume()
+	if err != nil {
+		return err
+	}
+	delta := level - start
+	if delta == 0 {
+		return nil
+	}
+
+	interval := duration / time.Duration(abs(delta))
+	if interval < minFadeInterval {
+		interval = minFadeInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	began := time.Now()
+	current := start
+	for current != level {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		progress := float64(time.Since(began)) / float64(duration)
+		if progress > 1 {
+			progress = 1
+		}
+		next := start + int(math.Round(float64(delta)*shape(progress)))
+		if next == current {
+			continue
+		}
+		if err := c.fadeStep(ctx, next); err != nil {
+			return err
+		}
+		current = next
+	}
+	return nil
+}
+
+// Writes one volume step of the fade unless it was cancelled.
+// Cancelling takes the same lock, so no step is queued once another volume command cancelled the fade.
+func (c *EISCPClient) fadeStep(ctx context.Context, level int) error {
+	if err := c.checkSupported("MVL"); err != nil {
+		return err
+	}
+	message, err := c.volumeMessage(level)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if err := ctx.Err(); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	completion, err := c.Enqueue(message, PriorityOf(message))
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return completion.Wait()
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,90 @@
+package eiscp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AudioInformation describes the audio signal the receiver gets and plays
+type AudioInformation struct {
+	InputPort      string `json:"inputPort"`
+	InputFormat    string `json:"inputFormat"`
+	SampleRate     string `json:"sampleRate"`
+	InputChannels  string `json:"inputChannels"`
+	ListeningMode  string `json:"listeningMode"`
+	OutputChannels string `json:"outputChannels"`
+}
+
+// VideoInformation describes the video signal passing through the receiver
+type VideoInformation struct {
+	InputPort        string `json:"inputPort"`
+	InputResolution  string `json:"inputResolution"`
+	InputColorSpace  string `json:"inputColorSpace"`
+	InputColorDepth  string `json:"inputColorDepth"`
+	OutputPort       string `json:"outputPort"`
+	OutputResolution string `json:"outputResolution"`
+	OutputColorSpace string `json:"outputColorSpace"`
+	OutputColorDepth string `json:"outputColorDepth"`
+	PictureMode      string `json:"pictureMode"`
+}
+
+// Splits the comma separated payload, padding fields the model does not report
+func splitInformationFields(payload string, count int) []string {
+	fields := strings.Split(payload, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	for len(fields) < count {
+		fields = append(fields, "")
+	}
+	return fields
+}
+
+func ParseAudioInformation(payload string) AudioInformation {
+	fields := splitInformationFields(payload, 6)
+	return AudioInformation{
+		InputPort:      fields[0],
+		InputFormat:    fields[1],
+		SampleRate:     fields[2],
+		InputChannels:  fields[3],
+		ListeningMode:  fields[4],
+		OutputChannels: fields[5],
+	}
+}
+
+func ParseVideoInformation(payload string) VideoInformation {
+	fields := splitInformationFields(payload, 9)
+	return VideoInformation{
+		InputPort:        fields[0],
+		InputResolution:  fields[1],
+		InputColorSpace:  fields[2],
+		InputColorDepth:  fields[3],
+		OutputPort:       fields[4],
+		OutputResolution: fields[5],
+		OutputColorSpace: fields[6],
+		OutputColorDepth: fields[7],
+		PictureMode:      fields[8],
+	}
+}
+
+func (c *EISCPClient) QueryAudioInformation() (AudioInformation, error) {
+	response, err := c.query("IFA")
+	if err != nil {
+		return AudioInformation{}, err
+	}
+	if response.Parameter == "N/A" {
+		return AudioInformation{}, fmt.Errorf("%w: no audio signal information", ErrNotAvailable)
+	}
+	return ParseAudioInformation(response.Parameter), nil
+}
+
+func (c *EISCPClient) QueryVideoInformation() (VideoInformation, error) {
+	response, err := c.query("IFV")
+	if err != nil {
+		return VideoInformation{}, err
+	}
+	if response.Parameter == "N/A" {
+		return VideoInformation{}, fmt.Errorf("%w: no video signal information", ErrNotAvailable)
+	}
+	return ParseVideoInformation(response.Parameter), nil
+}
@@ -0,0 +1,84 @@
+package eiscp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Unit types messages are addressed to
+const (
+	UnitReceiver byte = '1'
+	UnitAny      byte = 'x'
+)
+
+// Parameter asking for the current state instead of changing it
+const QueryParameter = "QSTN"
+
+// Message is a single ISCP message, like "MVL1E" for the receiver
+type Message struct {
+	// Destination unit type, '1' for receivers, 'x' for any unit
+	UnitType byte
+	// Three letter command, e.g. "MVL"
+	Command string
+	// Everything after the command, e.g. "1E" or "QSTN"
+	Parameter string
+}
+
+// Creates message for the receiver
+func NewMessage(command, parameter string) Message {
+	return Message{UnitType: UnitReceiver, Command: command, Parameter: parameter}
+}
+
+// Creates message asking the receiver for the current state of the command
+func NewQuery(command string) Message {
+	return NewMessage(command, QueryParameter)
+}
+
+// Parses the bare form used in documentation and typed by users, e.g. "MVL1E".
+// Control characters and '!' are refused, they would end the message and start
+// another one on the wire.
+func ParseMessage(text string) (Message, error) {
+	text = strings.TrimSpace(text)
+	if len(text) < 3 {
+		return Message{}, fmt.Errorf("%w: message '%s' is too short, expected three letter command", ErrValidation, text)
+	}
+	if i := strings.IndexFunc(text, func(r rune) bool { return r < 0x20 || r == 0x7f || r == '!' }); i >= 0 {
+		return Message{}, fmt.Errorf("%w: message %q contains %q at %d", ErrValidation, text, text[i], i)
+	}
+	return NewMessage(strings.ToUpper(text[:3]), text[3:]), nil
+}
+
+// Parses the framed form "!<unit type><command><parameter>" followed by any
+// combination of EOF, CR and LF, as it travels over the wire
+func ParseISCPMessage(data []byte) (Message, error) {
+	text := strings.TrimRight(string(data), "\x1a\r\n")
+	if len(text) < 2 || text[0] != '!' {
+		return Message{}, fmt.Errorf("%w %q: missing start character", ErrInvalidMessage, data)
+	}
+	if len(text) < 5 {
+		return Message{}, fmt.Errorf("%w %q: command too short", ErrInvalidMessage, data)
+	}
+	if text[1] <= ' ' || text[1] > '~' {
+		return Message{}, fmt.Errorf("%w %q: invalid unit type", ErrInvalidMessage, data)
+	}
+	return Message{UnitType: text[1], Command: text[2:5], Parameter: text[5:]}, nil
+}
+
+// Returns the bare form, e.g. "MVL1E"
+func (m Message) String() string {
+	return m.Command + m.Parameter
+}
+
+func (m Message) IsQuery() bool {
+	return m.Parameter == QueryParameter
+}
+
+// Returns the framed form sent over the wire, e.g. "!1MVL1E\r"
+func (m Message) Bytes() []byte {
+	unitType := m.UnitType
+	if unitType == 0 {
+		unitType = UnitReceiver
+	}
+	data := append([]byte{'!', unitType}, m.Command...)
+	return append(append(data, m.Parameter...), '\r')
+}
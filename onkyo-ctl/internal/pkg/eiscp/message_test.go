@@ -0,0 +1,121 @@
+package eiscp_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+)
+
+func TestNewMessage(t *testing.T) {
+	message := eiscp.NewMessage("MVL", "1E")
+	if message.UnitType != eiscp.UnitReceiver || message.Command != "MVL" || message.Parameter != "1E" {
+		t.Fatalf("NewMessage = %+v", message)
+	}
+	if message.IsQuery() {
+		t.Fatal("MVL1E is not a query")
+	}
+	query := eiscp.NewQuery("PWR")
+	if query.String() != "PWRQSTN" || !query.IsQuery() {
+		t.Fatalf("NewQuery = %+v", query)
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    eiscp.Message
+		wantErr bool
+	}{
+		{"MVL1E", eiscp.NewMessage("MVL", "1E"), false},
+		{"mvlQSTN", eiscp.NewQuery("MVL"), false},
+		{"  PWR01\r\n", eiscp.NewMessage("PWR", "01"), false},
+		{"NTCPLAY", eiscp.NewMessage("NTC", "PLAY"), false},
+		{"SWL-04", eiscp.NewMessage("SWL", "-04"), false},
+		{"DSNJazz FM", eiscp.NewMessage("DSN", "Jazz FM"), false},
+		{"PWR", eiscp.NewMessage("PWR", ""), false},
+		{"PW", eiscp.Message{}, true},
+		{"", eiscp.Message{}, true},
+		{"   ", eiscp.Message{}, true},
+		// Would end the message and smuggle another one in
+		{"MVLQSTN\r!1PWR00", eiscp.Message{}, true},
+		{"MVLQSTN\n!1PWR00", eiscp.Message{}, true},
+		{"MVLQSTN!1PWR00", eiscp.Message{}, true},
+		{"MVL1E\x1a", eiscp.Message{}, true},
+		{"DSNJazz\tFM", eiscp.Message{}, true},
+		{"MVL\x00", eiscp.Message{}, true},
+		{"MVL1E\x7f", eiscp.Message{}, true},
+		{"!1MVL1E", eiscp.Message{}, true},
+	}
+	for _, tt := range tests {
+		got, err := eiscp.ParseMessage(tt.text)
+		if tt.wantErr {
+			if !errors.Is(err, eiscp.ErrValidation) {
+				t.Errorf("ParseMessage(%q) error = %v, want ErrValidation", tt.text, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseMessage(%q) = %+v, %v, want %+v", tt.text, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseISCPMessage(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    eiscp.Message
+		wantErr bool
+	}{
+		{"!1MVL1E", eiscp.NewMessage("MVL", "1E"), false},
+		{"!1MVL1E\r", eiscp.NewMessage("MVL", "1E"), false},
+		{"!1MVL1E\n", eiscp.NewMessage("MVL", "1E"), false},
+		{"!1MVL1E\r\n", eiscp.NewMessage("MVL", "1E"), false},
+		{"!1MVL1E\x1a", eiscp.NewMessage("MVL", "1E"), false},
+		{"!1MVL1E\x1a\r\n", eiscp.NewMessage("MVL", "1E"), false},
+		{"!xECNQSTN\r", eiscp.Message{UnitType: eiscp.UnitAny, Command: "ECN", Parameter: "QSTN"}, false},
+		{"!1PWR", eiscp.NewMessage("PWR", ""), false},
+		{"1MVL1E\r", eiscp.Message{}, true},
+		{"!", eiscp.Message{}, true},
+		{"!1MV\r", eiscp.Message{}, true},
+		{"!\x00MVL1E\r", eiscp.Message{}, true},
+		{"!\x8fMVL1E\r", eiscp.Message{}, true},
+		{"! MVL1E\r", eiscp.Message{}, true},
+		{"", eiscp.Message{}, true},
+		{"\r\n", eiscp.Message{}, true},
+	}
+	for _, tt := range tests {
+		got, err := eiscp.ParseISCPMessage([]byte(tt.data))
+		if tt.wantErr {
+			if !errors.Is(err, eiscp.ErrInvalidMessage) || !errors.Is(err, eiscp.ErrTransport) {
+				t.Errorf("ParseISCPMessage(%q) error = %v, want ErrInvalidMessage", tt.data, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseISCPMessage(%q) = %+v, %v, want %+v", tt.data, got, err, tt.want)
+		}
+	}
+}
+
+func TestMessageBytes(t *testing.T) {
+	tests := []struct {
+		message eiscp.Message
+		want    string
+	}{
+		{eiscp.NewMessage("MVL", "1E"), "!1MVL1E\r"},
+		{eiscp.NewQuery("PWR"), "!1PWRQSTN\r"},
+		{eiscp.Message{UnitType: eiscp.UnitAny, Command: "ECN", Parameter: "QSTN"}, "!xECNQSTN\r"},
+		// Unit type defaults to the receiver
+		{eiscp.Message{Command: "AMT", Parameter: "TG"}, "!1AMTTG\r"},
+	}
+	for _, tt := range tests {
+		if got := string(tt.message.Bytes()); got != tt.want {
+			t.Errorf("%+v Bytes = %q, want %q", tt.message, got, tt.want)
+		}
+		parsed, err := eiscp.ParseISCPMessage(tt.message.Bytes())
+		if err != nil || parsed.String() != tt.message.String() {
+			t.Errorf("%q parsed back as %+v, %v", tt.want, parsed, err)
+		}
+	}
+}
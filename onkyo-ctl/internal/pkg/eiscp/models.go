@@ -0,0 +1,212 @@
+package eiscp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Model describes the capabilities of a receiver model or family
+type Model struct {
+	Name         string      `json:"name"`
+	MaxVolume    int         `json:"maxVolume"`
+	VolumeScale  VolumeScale `json:"volumeScale"`
+	SubwooferMin int         `json:"subwooferMin"`
+	SubwooferMax int         `json:"subwooferMax"`
+	// Dimmer levels from 0 (bright) up to MaxBrightness (darkest)
+	MaxBrightness int `json:"maxBrightness"`
+	// Supported three letter commands, nil means no restrictions
+	Commands []string `json:"commands,omitempty"`
+	// Zones named as in LookupZone, nil means any zone
+	Zones []string `json:"zones"`
+}
+
+// Supports reports whether the model understands the three letter command
+func (m Model) Supports(command string) bool {
+	if m.Commands == nil {
+		return true
+	}
+	for _, supported := range m.Commands {
+		if supported == command {
+			return true
+		}
+	}
+	return false
+}
+
+// HasZone reports whether the model has the zone, named as in LookupZone
+func (m Model) HasZone(zone string) bool {
+	if m.Zones == nil {
+		return true
+	}
+	for _, name := range m.Zones {
+		if name == zone {
+			return true
+		}
+	}
+	return false
+}
+
+// Known models, keyed by the exact model name or a family prefix
+var models = map[string]Model{
+	"TX-L20D": {
+		Name:          "TX-L20D",
+		MaxVolume:     50,
+		VolumeScale:   defaultVolumeScale,
+		SubwooferMin:  -8,
+		SubwooferMax:  8,
+		MaxBrightness: 2,
+		// Network stereo receiver without video processing
+		Commands: []string{
+			"PWR", "MVL", "AMT", "SWL", "SLI", "DIM", "SLP", "LMD", "TFR",
+			"TUN", "PRS", "PRM", "RDS", "DSN", "IFA", "NRI", "ECN",
+			"NJA", "NLS", "NLT", "NST", "NTC", "NTM", "NTR", "NAT", "NAL", "NTI",
+		},
+		Zones: []string{"main"},
+	},
+	"TX-NR": {
+		Name:          "TX-NR",
+		MaxVolume:     80,
+		VolumeScale:   VolumeScale{StepDB: 0.5, MinDB: -82},
+		SubwooferMin:  -15,
+		SubwooferMax:  12,
+		MaxBrightness: 3,
+		Zones:         []string{"main", "zone2", "zone3"},
+	},
+	"TX-RZ": {
+		Name:          "TX-RZ",
+		MaxVolume:     80,
+		VolumeScale:   VolumeScale{StepDB: 0.5, MinDB: -82},
+		SubwooferMin:  -15,
+		SubwooferMax:  12,
+		MaxBrightness: 3,
+		Zones:         []string{"main", "zone2", "zone3"},
+	},
+	// Integra receivers share the Onkyo protocol and limits
+	"DTR": {
+		Name:          "DTR",
+		MaxVolume:     80,
+		VolumeScale:   VolumeScale{StepDB: 0.5, MinDB: -82},
+		SubwooferMin:  -15,
+		SubwooferMax:  12,
+		MaxBrightness: 3,
+		Zones:         []string{"main", "zone2", "zone3", "zone4"},
+	},
+	"DRX": {
+		Name:          "DRX",
+		MaxVolume:     80,
+		VolumeScale:   VolumeScale{StepDB: 0.5, MinDB: -82},
+		SubwooferMin:  -15,
+		SubwooferMax:  12,
+		MaxBrightness: 3,
+		Zones:         []string{"main", "zone2", "zone3"},
+	},
+}
+
+// Assumed until the model is detected or selected. Commands and zones are not restricted,
+// limits are those of the TX-L20D this client was written for, keeping the volume safe.
+var unknownModel = Model{
+	Name:          "unknown",
+	MaxVolume:     50,
+	VolumeScale:   defaultVolumeScale,
+	SubwooferMin:  -8,
+	SubwooferMax:  8,
+	MaxBrightness: 2,
+}
+
+// Names of the known models and families, sorted
+func Models() []string {
+	names := make([]string, 0, len(models))
+	for name := range models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Finds the model by exact name first, then by the longest matching family prefix
+func LookupModel(name string) (Model, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if model, ok := models[name]; ok {
+		return model, nil
+	}
+
+	family := ""
+	for prefix := range models {
+		if strings.HasPrefix(name, prefix) && len(prefix) > len(family) {
+			family = prefix
+		}
+	}
+	if family == "" {
+		return Model{}, fmt.Errorf("%w: unknown model '%s', known models: %s", ErrValidation, name, strings.Join(Models(), ", "))
+	}
+
+	model := models[family]
+	model.Name = name
+	return model, nil
+}
+
+func (c *EISCPClient) Model() Model {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.model
+}
+
+// Selects the model explicitly, detection will not override it anymore
+func (c *EISCPClient) SetModel(name string) error {
+	model, err := LookupModel(name)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.model = model
+	c.modelPinned = true
+	return nil
+}
+
+// Reports whether the model was selected explicitly, its limits are not detected then
+func (c *EISCPClient) ModelPinned() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.modelPinned
+}
+
+// Uses the detected model name unless the model was selected explicitly.
+// Unknown models keep the current limits. Must be called with the mutex held.
+func (c *EISCPClient) detectedModel(name string) {
+	if c.modelPinned {
+		return
+	}
+	if model, err := LookupModel(name); err == nil {
+		c.model = model
+	}
+}
+
+// Queries the model name announced in the ECN message, the same one devices
+// answer discovery with: "ECN<model>/<port>/<region>/<mac>"
+func (c *EISCPClient) QueryModelName() (string, error) {
+	response, err := c.receive(NewQuery("ECN"))
+	if err != nil {
+		return "", err
+	}
+	name := strings.SplitN(response.Parameter, "/", 2)[0]
+	return strings.TrimSpace(name), nil
+}
+
+// Detects the model from NRI, falling back to ECN on models without NRI
+func (c *EISCPClient) DetectModel() (Model, error) {
+	if _, err := c.QueryDeviceInfo(); err == nil {
+		return c.Model(), nil
+	}
+
+	name, err := c.QueryModelName()
+	if err != nil {
+		return c.Model(), err
+	}
+	c.mu.Lock()
+	c.detectedModel(name)
+	c.mu.Unlock()
+	return c.Model(), nil
+}
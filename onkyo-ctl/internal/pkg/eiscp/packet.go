@@ -3,7 +3,8 @@ package eiscp
 import (
 	"bytes"
 	"encoding/binary"
-	"strings"
+	"fmt"
+	"io"
 )
 
 // The eISCP packet wraps ISCP message for communication over Ethernet
@@ -27,9 +28,8 @@ func (p *EISCPPacket) Bytes() []byte {
 	return buf.Bytes()
 }
 
-func NewEISCPPacket(iscpMessage string) *EISCPPacket {
-	iscpMessage = "!1" + iscpMessage + "\r"
-	iscpMessageBytes := []byte(iscpMessage)
+func NewEISCPPacket(message Message) *EISCPPacket {
+	iscpMessageBytes := message.Bytes()
 	return &EISCPPacket{
 		Magic:      [4]byte{'I', 'S', 'C', 'P'},
 		HeaderSize: 16,
@@ -40,15 +40,118 @@ func NewEISCPPacket(iscpMessage string) *EISCPPacket {
 	}
 }
 
-func UnpackEISCPMessage(packet string) string {
-	if len(packet) < 16 {
-		return packet
+// Decoding errors, all of them are transport errors
+var (
+	ErrInvalidMagic       = fmt.Errorf("%w: invalid eISCP magic", ErrTransport)
+	ErrInvalidHeaderSize  = fmt.Errorf("%w: invalid eISCP header size", ErrTransport)
+	ErrUnsupportedVersion = fmt.Errorf("%w: unsupported eISCP version", ErrTransport)
+	ErrTruncatedPacket    = fmt.Errorf("%w: truncated eISCP packet", ErrTransport)
+	ErrInvalidMessage     = fmt.Errorf("%w: invalid ISCP message", ErrTransport)
+)
+
+const (
+	eiscpHeaderSize = 16
+	eiscpVersion    = 0x01
+	// Largest payload we agree to allocate, NRI documents are a few kilobytes
+	maxDataSize = 1 << 20
+)
+
+// Reads a single eISCP packet from the stream, however it was split into reads
+func ReadEISCPPacket(r io.Reader) (*EISCPPacket, error) {
+	header := make([]byte, eiscpHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("%w: header cut short", ErrTruncatedPacket)
+		}
+		return nil, err
+	}
+
+	packet := &EISCPPacket{
+		HeaderSize: binary.BigEndian.Uint32(header[4:8]),
+		DataSize:   binary.BigEndian.Uint32(header[8:12]),
+		Version:    header[12],
+	}
+	copy(packet.Magic[:], header[0:4])
+	copy(packet.Reserved[:], header[13:16])
+
+	if packet.Magic != [4]byte{'I', 'S', 'C', 'P'} {
+		return nil, fmt.Errorf("%w %q", ErrInvalidMagic, packet.Magic[:])
+	}
+	if packet.HeaderSize < eiscpHeaderSize || packet.HeaderSize > maxDataSize {
+		return nil, fmt.Errorf("%w %d", ErrInvalidHeaderSize, packet.HeaderSize)
+	}
+	if packet.Version != eiscpVersion {
+		return nil, fmt.Errorf("%w %d", ErrUnsupportedVersion, packet.Version)
+	}
+	if packet.DataSize > maxDataSize {
+		return nil, fmt.Errorf("%w: data size %d exceeds %d", ErrTruncatedPacket, packet.DataSize, maxDataSize)
+	}
+
+	// Skip any header extension we do not understand
+	if _, err := io.CopyN(io.Discard, r, int64(packet.HeaderSize-eiscpHeaderSize)); err != nil {
+		return nil, fmt.Errorf("%w: header cut short", ErrTruncatedPacket)
 	}
-	header := packet[:16]
-	dataSize := binary.BigEndian.Uint32([]byte(header[8:12]))
-	data := packet[16 : 16+dataSize]
 
-	// Remove the ISCP start character '!1' and the trailing '\r'
-	message := strings.TrimSpace(string(data[2 : len(data)-3]))
-	return message
+	packet.Data = make([]byte, packet.DataSize)
+	if _, err := io.ReadFull(r, packet.Data); err != nil {
+		return nil, fmt.Errorf("%w: expected %d bytes of data", ErrTruncatedPacket, packet.DataSize)
+	}
+	return packet, nil
+}
+
+// Decodes the ISCP message carried by the packet
+func (p *EISCPPacket) Message() (Message, error) {
+	return ParseISCPMessage(p.Data)
+}
+
+// Decodes a complete eISCP packet
+func UnpackEISCPMessage(packet []byte) (Message, error) {
+	p, err := ReadEISCPPacket(bytes.NewReader(packet))
+	if err == io.EOF {
+		return Message{}, fmt.Errorf("%w: empty packet", ErrTruncatedPacket)
+	}
+	if err != nil {
+		return Message{}, err
+	}
+	return p.Message()
+}
+
+// StreamMessage is a message found in a captured byte stream
+type StreamMessage struct {
+	// Position and length of the whole packet in the stream
+	Offset  int
+	Length  int
+	Message Message
+	// Set when the packet is fine but the message inside is not
+	Err error
+}
+
+// Decodes all eISCP packets in the captured stream. Bytes not forming a packet,
+// like lost segments or an incomplete packet at the end, are skipped and counted.
+func ScanEISCPStream(data []byte) (messages []StreamMessage, skipped int) {
+	magic := []byte("ISCP")
+	offset := 0
+	for offset < len(data) {
+		start := bytes.Index(data[offset:], magic)
+		if start < 0 {
+			break
+		}
+		skipped += start
+		offset += start
+
+		reader := bytes.NewReader(data[offset:])
+		packet, err := ReadEISCPPacket(reader)
+		if err != nil {
+			// Not a packet after all, look for the next magic
+			skipped++
+			offset++
+			continue
+		}
+		length := len(data) - offset - reader.Len()
+		message, err := packet.Message()
+		messages = append(messages, StreamMessage{Offset: offset, Length: length, Message: message, Err: err})
+		offset += length
+	}
+	skipped += len(data) - offset
+	return messages, skipped
 }
@@ -0,0 +1,307 @@
+package eiscp_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+)
+
+// eISCP packet of "!1MVL1E\r" as the receiver sends it
+var mvlPacket = []byte{
+	'I', 'S', 'C', 'P',
+	0x00, 0x00, 0x00, 0x10, // header size
+	0x00, 0x00, 0x00, 0x08, // data size
+	0x01,             // version
+	0x00, 0x00, 0x00, // reserved
+	'!', '1', 'M', 'V', 'L', '1', 'E', '\r',
+}
+
+func TestNewEISCPPacket(t *testing.T) {
+	packet := eiscp.NewEISCPPacket(eiscp.NewMessage("MVL", "1E"))
+	if got := packet.Bytes(); !bytes.Equal(got, mvlPacket) {
+		t.Fatalf("Bytes = % x\nwant    % x", got, mvlPacket)
+	}
+}
+
+func TestReadEISCPPacket(t *testing.T) {
+	tests := []struct {
+		name   string
+		reader io.Reader
+	}{
+		{"whole", bytes.NewReader(mvlPacket)},
+		{"byte by byte", iotest.OneByteReader(bytes.NewReader(mvlPacket))},
+		{"half reads", iotest.HalfReader(bytes.NewReader(mvlPacket))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet, err := eiscp.ReadEISCPPacket(tt.reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if packet.HeaderSize != 16 || packet.DataSize != 8 || packet.Version != 1 {
+				t.Fatalf("header = %+v", packet)
+			}
+			message, err := packet.Message()
+			if err != nil || message != eiscp.NewMessage("MVL", "1E") {
+				t.Fatalf("Message = %+v, %v", message, err)
+			}
+		})
+	}
+}
+
+func TestReadEISCPPacketHeaderExtension(t *testing.T) {
+	// Larger headers carry fields we do not know, they are skipped
+	packet := append([]byte(nil), mvlPacket[:16]...)
+	packet[7] = 0x14
+	packet = append(packet, 0xde, 0xad, 0xbe, 0xef)
+	packet = append(packet, mvlPacket[16:]...)
+
+	read, err := eiscp.ReadEISCPPacket(bytes.NewReader(packet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(read.Data) != "!1MVL1E\r" {
+		t.Fatalf("Data = %q", read.Data)
+	}
+}
+
+func TestReadEISCPPacketStream(t *testing.T) {
+	var stream bytes.Buffer
+	for _, message := range []eiscp.Message{eiscp.NewMessage("PWR", "01"), eiscp.NewMessage("MVL", "1E"), eiscp.NewMessage("AMT", "00")} {
+		stream.Write(eiscp.NewEISCPPacket(message).Bytes())
+	}
+
+	var got []string
+	for {
+		packet, err := eiscp.ReadEISCPPacket(&stream)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		message, _ := packet.Message()
+		got = append(got, message.String())
+	}
+	if want := []string{"PWR01", "MVL1E", "AMT00"}; len(got) != 3 || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("read %q, want %q", got, want)
+	}
+}
+
+func TestUnpackEISCPMessage(t *testing.T) {
+	message, err := eiscp.UnpackEISCPMessage(mvlPacket)
+	if err != nil || message != eiscp.NewMessage("MVL", "1E") {
+		t.Fatalf("UnpackEISCPMessage = %+v, %v", message, err)
+	}
+}
+
+func TestScanEISCPStream(t *testing.T) {
+	power := eiscp.NewEISCPPacket(eiscp.NewMessage("PWR", "01")).Bytes()
+	var stream []byte
+	stream = append(stream, "junk"...)
+	stream = append(stream, mvlPacket...)
+	stream = append(stream, power...)
+	// Packet cut off at the end of the capture
+	stream = append(stream, mvlPacket[:20]...)
+
+	messages, skipped := eiscp.ScanEISCPStream(stream)
+	if len(messages) != 2 {
+		t.Fatalf("found %d messages, want 2", len(messages))
+	}
+	if messages[0].Offset != 4 || messages[0].Length != len(mvlPacket) || messages[0].Message != eiscp.NewMessage("MVL", "1E") {
+		t.Fatalf("first = %+v", messages[0])
+	}
+	if messages[1].Offset != 4+len(mvlPacket) || messages[1].Message != eiscp.NewMessage("PWR", "01") {
+		t.Fatalf("second = %+v", messages[1])
+	}
+	if skipped != 4+20 {
+		t.Fatalf("skipped %d bytes, want %d", skipped, 4+20)
+	}
+}
+
+// Builds a packet with the header fields given, for packets NewEISCPPacket would never make
+func rawPacket(magic string, headerSize, dataSize uint32, version byte, data string) []byte {
+	packet := []byte(magic)
+	packet = binary.BigEndian.AppendUint32(packet, headerSize)
+	packet = binary.BigEndian.AppendUint32(packet, dataSize)
+	packet = append(packet, version, 0, 0, 0)
+	return append(packet, data...)
+}
+
+func TestReadEISCPPacketErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+		want   error
+	}{
+		{"invalid magic", rawPacket("ISCQ", 16, 8, 1, "!1MVL1E\r"), eiscp.ErrInvalidMagic},
+		{"lowercase magic", rawPacket("iscp", 16, 8, 1, "!1MVL1E\r"), eiscp.ErrInvalidMagic},
+		{"header too small", rawPacket("ISCP", 15, 8, 1, "!1MVL1E\r"), eiscp.ErrInvalidHeaderSize},
+		{"header size zero", rawPacket("ISCP", 0, 8, 1, "!1MVL1E\r"), eiscp.ErrInvalidHeaderSize},
+		{"header too large", rawPacket("ISCP", 1<<20+1, 8, 1, "!1MVL1E\r"), eiscp.ErrInvalidHeaderSize},
+		{"version 0", rawPacket("ISCP", 16, 8, 0, "!1MVL1E\r"), eiscp.ErrUnsupportedVersion},
+		{"version 2", rawPacket("ISCP", 16, 8, 2, "!1MVL1E\r"), eiscp.ErrUnsupportedVersion},
+		{"header cut short", mvlPacket[:10], eiscp.ErrTruncatedPacket},
+		{"header extension cut short", rawPacket("ISCP", 24, 8, 1, "1234"), eiscp.ErrTruncatedPacket},
+		{"data cut short", mvlPacket[:len(mvlPacket)-1], eiscp.ErrTruncatedPacket},
+		{"data missing", mvlPacket[:16], eiscp.ErrTruncatedPacket},
+		{"data size above limit", rawPacket("ISCP", 16, 1<<20+1, 1, ""), eiscp.ErrTruncatedPacket},
+		{"data size max uint32", rawPacket("ISCP", 16, 0xffffffff, 1, ""), eiscp.ErrTruncatedPacket},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := eiscp.ReadEISCPPacket(bytes.NewReader(tt.packet))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("ReadEISCPPacket error = %v, want %v", err, tt.want)
+			}
+			if !errors.Is(err, eiscp.ErrTransport) {
+				t.Fatalf("error %v is not a transport error", err)
+			}
+			if _, err := eiscp.UnpackEISCPMessage(tt.packet); !errors.Is(err, tt.want) {
+				t.Fatalf("UnpackEISCPMessage error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadEISCPPacketEOF(t *testing.T) {
+	// A connection closed between packets is not a broken packet
+	if _, err := eiscp.ReadEISCPPacket(bytes.NewReader(nil)); err != io.EOF {
+		t.Fatalf("error = %v, want io.EOF", err)
+	}
+	if _, err := eiscp.UnpackEISCPMessage(nil); !errors.Is(err, eiscp.ErrTruncatedPacket) {
+		t.Fatalf("UnpackEISCPMessage(nil) error = %v, want ErrTruncatedPacket", err)
+	}
+}
+
+func TestUnpackEISCPMessageInvalidMessage(t *testing.T) {
+	for _, data := range []string{"", "\r", "MVL1E\r", "!1MV\r", "!\r\n"} {
+		packet := rawPacket("ISCP", 16, uint32(len(data)), 1, data)
+		if _, err := eiscp.UnpackEISCPMessage(packet); !errors.Is(err, eiscp.ErrInvalidMessage) {
+			t.Errorf("UnpackEISCPMessage(%q) error = %v, want ErrInvalidMessage", data, err)
+		}
+	}
+}
+
+func TestUnpackEISCPMessageTerminators(t *testing.T) {
+	terminators := map[string]string{
+		"none":      "",
+		"CR":        "\r",
+		"LF":        "\n",
+		"CR LF":     "\r\n",
+		"EOF":       "\x1a",
+		"EOF CR":    "\x1a\r",
+		"EOF CR LF": "\x1a\r\n",
+	}
+	for name, terminator := range terminators {
+		data := "!1MVL1E" + terminator
+		message, err := eiscp.UnpackEISCPMessage(rawPacket("ISCP", 16, uint32(len(data)), 1, data))
+		if err != nil || message != eiscp.NewMessage("MVL", "1E") {
+			t.Errorf("%s: UnpackEISCPMessage = %+v, %v, want MVL1E", name, message, err)
+		}
+	}
+}
+
+func TestReadEISCPPacketMaxDataSize(t *testing.T) {
+	// NRI documents are large, the limit still lets them through
+	data := make([]byte, 1<<20)
+	copy(data, "!1NRI")
+	for i := 5; i < len(data)-1; i++ {
+		data[i] = 'x'
+	}
+	data[len(data)-1] = '\r'
+	packet, err := eiscp.ReadEISCPPacket(bytes.NewReader(rawPacket("ISCP", 16, uint32(len(data)), 1, string(data))))
+	if err != nil {
+		t.Fatalf("packet at the limit: %v", err)
+	}
+	if message, err := packet.Message(); err != nil || message.Command != "NRI" || len(message.Parameter) != len(data)-6 {
+		t.Fatalf("Message = %s with %d bytes, %v", message.Command, len(message.Parameter), err)
+	}
+
+	// Sizes above it are refused before reading, so a bogus size cannot exhaust memory
+	reader := bytes.NewReader(rawPacket("ISCP", 16, 1<<20+1, 1, string(data)))
+	if _, err := eiscp.ReadEISCPPacket(reader); !errors.Is(err, eiscp.ErrTruncatedPacket) {
+		t.Fatalf("error = %v, want ErrTruncatedPacket", err)
+	}
+	if reader.Len() != len(data) {
+		t.Fatalf("read %d bytes of data beyond the limit", len(data)-reader.Len())
+	}
+}
+
+func FuzzReadEISCPPacket(f *testing.F) {
+	f.Add(mvlPacket)
+	f.Add(eiscp.NewEISCPPacket(eiscp.NewQuery("NRI")).Bytes())
+	f.Add(rawPacket("ISCP", 20, 4, 1, "\x00\x00\x00\x00!1PW"))
+	f.Add(rawPacket("ISCP", 16, 1<<20+1, 1, ""))
+	f.Add(mvlPacket[:10])
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		packet, err := eiscp.ReadEISCPPacket(bytes.NewReader(data))
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, eiscp.ErrTransport) {
+				t.Fatalf("error %v is neither EOF nor a transport error", err)
+			}
+			return
+		}
+		if uint32(len(packet.Data)) != packet.DataSize {
+			t.Fatalf("read %d bytes of data, header says %d", len(packet.Data), packet.DataSize)
+		}
+		if packet.HeaderSize == 16 && !bytes.HasPrefix(data, packet.Bytes()) {
+			t.Fatalf("packet encodes as % x, read from % x", packet.Bytes(), data)
+		}
+	})
+}
+
+func FuzzUnpackEISCPMessage(f *testing.F) {
+	f.Add(mvlPacket)
+	f.Add(rawPacket("ISCP", 16, 10, 1, "!1MVL1E\x1a\r\n"))
+	f.Add(rawPacket("ISCP", 16, 4, 1, "!1MV"))
+	f.Add(rawPacket("ISCP", 16, 9, 1, "!xECNQSTN"))
+	f.Add([]byte("ISCP"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		message, err := eiscp.UnpackEISCPMessage(data)
+		if err != nil {
+			if !errors.Is(err, eiscp.ErrTransport) {
+				t.Fatalf("error %v is not a transport error", err)
+			}
+			return
+		}
+		if len(message.Command) != 3 {
+			t.Fatalf("command %q is not three characters long", message.Command)
+		}
+		// Whatever was accepted survives being sent again
+		again, err := eiscp.UnpackEISCPMessage(eiscp.NewEISCPPacket(message).Bytes())
+		if err != nil || again != message {
+			t.Fatalf("%+v came back as %+v, %v", message, again, err)
+		}
+	})
+}
+
+func FuzzScanEISCPStream(f *testing.F) {
+	f.Add(append(append([]byte("junk"), mvlPacket...), mvlPacket[:20]...))
+	f.Add([]byte("ISCPISCPISCP"))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		messages, skipped := eiscp.ScanEISCPStream(data)
+		// Every byte is either part of a packet or skipped, packets do not overlap
+		covered, end := skipped, 0
+		for _, message := range messages {
+			if message.Offset < end || message.Length <= 0 {
+				t.Fatalf("packet at %d of %d bytes overlaps the previous one ending at %d", message.Offset, message.Length, end)
+			}
+			end = message.Offset + message.Length
+			covered += message.Length
+		}
+		if covered != len(data) {
+			t.Fatalf("%d bytes in packets and skipped, stream has %d", covered, len(data))
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package eiscp
+
+import (
+	"errors"
+	"time"
+)
+
+// How long receivers ignore commands after waking up, by default
+const DefaultSettleTime = 1500 * time.Millisecond
+
+// PowerState as last reported by the receiver
+type PowerState int
+
+const (
+	PowerStateUnknown PowerState = iota
+	PowerStateStandby
+	PowerStateOn
+)
+
+func (s PowerState) String() string {
+	switch s {
+	case PowerStateStandby:
+		return "standby"
+	case PowerStateOn:
+		return "on"
+	default:
+		return "unknown"
+	}
+}
+
+// Changes how long writes are held back after the receiver wakes up
+func (c *EISCPClient) SetSettleTime(settleTime time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.settleTime = settleTime
+}
+
+func (c *EISCPClient) SettleTime() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.settleTime
+}
+
+func (c *EISCPClient) PowerState() PowerState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.power
+}
+
+// Asks the receiver for its power state, the answer updates PowerState too
+func (c *EISCPClient) QueryPowerState() (PowerState, error) {
+	if _, err := c.query("PWR"); err != nil {
+		return PowerStateUnknown, err
+	}
+	return c.PowerState(), nil
+}
+
+// Follows the power state from echoes and changes made elsewhere, e.g. with the remote.
+// Receivers woken up by someone else need to settle too.
+func (c *EISCPClient) observePower(message Message) {
+	var state PowerState
+	switch {
+	case message.Command != "PWR":
+		return
+	case message.Parameter == "01":
+		state = PowerStateOn
+	case message.Parameter == "00":
+		state = PowerStateStandby
+	default:
+		return
+	}
+
+	c.mu.Lock()
+	previous := c.power
+	c.power = state
+	settleTime := c.settleTime
+	c.mu.Unlock()
+
+	if previous == PowerStateStandby && state == PowerStateOn {
+		c.writer.hold(time.Now().Add(settleTime))
+	}
+}
+
+// Turns the receiver on unless it already is, waiting for the echo.
+// Other writes are held back until the receiver settles, it drops commands while waking up.
+func (c *EISCPClient) PowerOn() error {
+	return c.powerOn(false)
+}
+
+// Like PowerOn, but fails with MismatchError when the receiver does not confirm
+func (c *EISCPClient) PowerOnConfirmed() error {
+	return c.powerOn(true)
+}
+
+func (c *EISCPClient) powerOn(confirmed bool) error {
+	if c.PowerState() == PowerStateUnknown {
+		// The answer updates the state, asking is cheaper than waiting for the settle time
+		_, _ = c.query("PWR")
+	}
+	if c.PowerState() == PowerStateOn {
+		return nil
+	}
+
+	// Nothing else goes out until the echo arrives, or all attempts time out
+	attempts := time.Duration(c.Retries() + 1)
+	c.writer.hold(time.Now().Add(attempts*c.Timeout() + c.SettleTime()))
+
+	var err error
+	if confirmed {
+		_, err = c.SendConfirmed(NewMessage("PWR", "01"))
+	} else {
+		_, err = c.receive(NewMessage("PWR", "01"))
+		if errors.Is(err, ErrTimeout) {
+			// Not confirmed, the echo is only awaited for the settle time to start
+			err = nil
+		}
+	}
+	if err != nil {
+		c.writer.hold(time.Time{})
+		return err
+	}
+	c.writer.hold(time.Now().Add(c.SettleTime()))
+	return nil
+}
@@ -0,0 +1,136 @@
+package eiscp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Direction of a recorded frame, seen from the client
+type Direction string
+
+const (
+	DirectionSent     Direction = "sent"
+	DirectionReceived Direction = "received"
+)
+
+// Frame is a single message recorded with the time it was sent or received
+type Frame struct {
+	Time      time.Time `json:"time"`
+	Direction Direction `json:"direction"`
+	// Wire form without the terminator, e.g. "!1MVL1E"
+	Frame string `json:"frame"`
+}
+
+// Message carried by the frame
+func (f Frame) Message() (Message, error) {
+	return ParseISCPMessage([]byte(f.Frame))
+}
+
+func newFrame(direction Direction, message Message) Frame {
+	return Frame{
+		Time:      time.Now(),
+		Direction: direction,
+		Frame:     strings.TrimSuffix(string(message.Bytes()), "\r"),
+	}
+}
+
+// Writes every message going through the transport as a JSON line.
+// Failing to record does not break the traffic, the error is reported on Close.
+type recordingTransport struct {
+	transport Transport
+
+	mu      sync.Mutex
+	encoder *json.Encoder
+	err     error
+}
+
+// Wraps the transport, recording all sent and received messages to w in JSONL
+func NewRecordingTransport(transport Transport, w io.Writer) Transport {
+	return &recordingTransport{transport: transport, encoder: json.NewEncoder(w)}
+}
+
+// Must be called with the mutex held
+func (t *recordingTransport) record(frame Frame) {
+	if err := t.encoder.Encode(frame); err != nil && t.err == nil {
+		t.err = err
+	}
+}
+
+// Writes are recorded before responses read in the meantime, which wait for the mutex
+func (t *recordingTransport) WriteMessage(message Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := t.transport.WriteMessage(message)
+	if err == nil {
+		t.record(newFrame(DirectionSent, message))
+	}
+	return err
+}
+
+func (t *recordingTransport) ReadMessage() (Message, error) {
+	message, err := t.transport.ReadMessage()
+	if err == nil {
+		t.mu.Lock()
+		t.record(newFrame(DirectionReceived, message))
+		t.mu.Unlock()
+	}
+	return message, err
+}
+
+func (t *recordingTransport) Close() error {
+	err := t.transport.Close()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err == nil && t.err != nil {
+		err = fmt.Errorf("failed to record traffic: %w", t.err)
+	}
+	return err
+}
+
+// RecordingDialer records the traffic of transports made by the dialer
+type RecordingDialer struct {
+	Dialer Dialer
+	Writer io.Writer
+}
+
+func (d RecordingDialer) Dial() (Transport, error) {
+	transport, err := d.Dialer.Dial()
+	if err != nil {
+		return nil, err
+	}
+	return NewRecordingTransport(transport, d.Writer), nil
+}
+
+// Reads frames recorded in JSONL, blank lines are skipped
+func ReadRecording(r io.Reader) ([]Frame, error) {
+	var frames []Frame
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxDataSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var frame Frame
+		if err := json.Unmarshal([]byte(text), &frame); err != nil {
+			return nil, fmt.Errorf("%w: invalid recording line %d: %v", ErrValidation, line, err)
+		}
+		if frame.Direction != DirectionSent && frame.Direction != DirectionReceived {
+			return nil, fmt.Errorf("%w: invalid direction '%s' on recording line %d", ErrValidation, frame.Direction, line)
+		}
+		if _, err := frame.Message(); err != nil {
+			return nil, fmt.Errorf("%w: invalid frame on recording line %d: %v", ErrValidation, line, err)
+		}
+		frames = append(frames, frame)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+	return frames, nil
+}
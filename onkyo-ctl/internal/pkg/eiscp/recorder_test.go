@@ -0,0 +1,148 @@
+package eiscp_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp/eiscptest"
+)
+
+// Recorded session played back answers the same queries the same way
+func TestRecordReplay(t *testing.T) {
+	fake := eiscptest.NewTransport()
+	fake.Respond("MVLQSTN", "MVL1E")
+	fake.Respond("PWRQSTN", "PWR01")
+
+	var recording bytes.Buffer
+	client, err := eiscp.Dial(eiscp.RecordingDialer{Dialer: fake, Writer: &recording})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetTimeout(testTimeout)
+	if _, err := client.QueryVolume(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.QueryPowerState(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	frames, err := eiscp.ReadRecording(&recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, frame := range frames {
+		got = append(got, string(frame.Direction)+" "+frame.Frame)
+	}
+	want := []string{"sent !1MVLQSTN", "received !1MVL1E", "sent !1PWRQSTN", "received !1PWR01"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("recorded %q, want %q", got, want)
+	}
+
+	// Every dial starts the session over
+	dialer := eiscp.ReplayDialer{Frames: frames}
+	for session := 0; session < 2; session++ {
+		transport, err := dialer.Dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		replay := transport.(*eiscp.Replay)
+		client := eiscp.NewClient(replay)
+		client.SetTimeout(testTimeout)
+
+		level, err := client.QueryVolume()
+		if err != nil || level != 30 {
+			t.Fatalf("session %d: QueryVolume = %d, %v, want 30", session, level, err)
+		}
+		if remaining := replay.Remaining(); !reflect.DeepEqual(remaining, []string{"PWRQSTN"}) {
+			t.Fatalf("session %d: remaining %q, want PWRQSTN", session, remaining)
+		}
+		// Writes off the recording stay unanswered
+		if _, err := client.QueryInputSelector(); !errors.Is(err, eiscp.ErrTimeout) {
+			t.Fatalf("session %d: unrecorded query error = %v, want ErrTimeout", session, err)
+		}
+		if unexpected := replay.Unexpected(); !reflect.DeepEqual(unexpected, []string{"SLIQSTN"}) {
+			t.Fatalf("session %d: unexpected %q, want SLIQSTN", session, unexpected)
+		}
+		if state, err := client.QueryPowerState(); err != nil || state != eiscp.PowerStateOn {
+			t.Fatalf("session %d: QueryPowerState = %v, %v, want on", session, state, err)
+		}
+		client.Close()
+	}
+}
+
+// Messages recorded before the first write are delivered right away
+func TestReplayGreeting(t *testing.T) {
+	frames, err := eiscp.ReadRecording(strings.NewReader(`{"direction":"received","frame":"!1PWR01"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay := eiscp.NewReplay(frames)
+	defer replay.Close()
+	if message, err := replay.ReadMessage(); err != nil || message.String() != "PWR01" {
+		t.Fatalf("ReadMessage = %q, %v, want PWR01", message, err)
+	}
+
+	replay.Close()
+	if err := replay.WriteMessage(eiscp.NewQuery("PWR")); !errors.Is(err, eiscp.ErrConnection) {
+		t.Fatalf("write after close error = %v, want ErrConnection", err)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+// Traffic goes on when recording fails, the failure is reported on close
+func TestRecordingTransportWriteFailure(t *testing.T) {
+	fake := eiscptest.NewTransport()
+	fake.Respond("MVLQSTN", "MVL1E")
+	client := eiscp.NewClient(eiscp.NewRecordingTransport(fake, failingWriter{}))
+	client.SetTimeout(testTimeout)
+
+	if level, err := client.QueryVolume(); err != nil || level != 30 {
+		t.Fatalf("QueryVolume = %d, %v, want 30", level, err)
+	}
+	if err := client.Close(); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("Close error = %v, want the recording failure", err)
+	}
+}
+
+func TestReadRecordingErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		recording string
+		want      string
+	}{
+		{"invalid json", `{"direction":"sent","frame":"!1PWR01"}` + "\n{", "line 2"},
+		{"unknown direction", `{"direction":"sideways","frame":"!1PWR01"}`, "direction 'sideways'"},
+		{"invalid frame", "\n\n" + `{"direction":"sent","frame":"PWR01"}`, "invalid frame on recording line 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := eiscp.ReadRecording(strings.NewReader(tt.recording))
+			if !errors.Is(err, eiscp.ErrValidation) || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want ErrValidation mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadRecordingSkipsBlankLines(t *testing.T) {
+	frames, err := eiscp.ReadRecording(strings.NewReader("\n" + `{"direction":"sent","frame":"!1PWR01"}` + "\n  \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 || frames[0].Frame != "!1PWR01" || frames[0].Direction != eiscp.DirectionSent {
+		t.Fatalf("frames = %+v, want the single sent frame", frames)
+	}
+}
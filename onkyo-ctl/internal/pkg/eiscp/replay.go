@@ -0,0 +1,131 @@
+package eiscp
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Replay is a transport playing a recorded session back instead of the receiver.
+// Messages received after a recorded write are answered when the client makes
+// the same write again, in the recorded order. Messages received before the
+// first write are delivered right away. Timing of the recording is not kept.
+type Replay struct {
+	mu         sync.Mutex
+	steps      []replayStep
+	unexpected []string
+
+	incoming  chan Message
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Write expected by the recording and the messages that followed it
+type replayStep struct {
+	sent     string
+	received []Message
+}
+
+var _ Transport = (*Replay)(nil)
+
+func NewReplay(frames []Frame) *Replay {
+	r := &Replay{
+		incoming: make(chan Message, 100),
+		closed:   make(chan struct{}),
+	}
+
+	var greeting []Message
+	for _, frame := range frames {
+		message, err := frame.Message()
+		if err != nil {
+			continue
+		}
+		switch {
+		case frame.Direction == DirectionSent:
+			r.steps = append(r.steps, replayStep{sent: message.String()})
+		case len(r.steps) == 0:
+			greeting = append(greeting, message)
+		default:
+			last := &r.steps[len(r.steps)-1]
+			last.received = append(last.received, message)
+		}
+	}
+
+	// Buffered, unless the recording starts with a long monologue
+	go r.deliver(greeting)
+	return r
+}
+
+func (r *Replay) deliver(messages []Message) {
+	for _, message := range messages {
+		select {
+		case r.incoming <- message:
+		case <-r.closed:
+			return
+		}
+	}
+}
+
+// Writes matching the next recorded one get its responses, the others are only
+// noted as unexpected
+func (r *Replay) WriteMessage(message Message) error {
+	select {
+	case <-r.closed:
+		return fmt.Errorf("%w: replay closed", ErrConnection)
+	default:
+	}
+
+	r.mu.Lock()
+	var received []Message
+	if len(r.steps) > 0 && r.steps[0].sent == message.String() {
+		received = r.steps[0].received
+		r.steps = r.steps[1:]
+	} else {
+		r.unexpected = append(r.unexpected, message.String())
+	}
+	r.mu.Unlock()
+
+	r.deliver(received)
+	return nil
+}
+
+func (r *Replay) ReadMessage() (Message, error) {
+	select {
+	case message := <-r.incoming:
+		return message, nil
+	case <-r.closed:
+		return Message{}, io.EOF
+	}
+}
+
+func (r *Replay) Close() error {
+	r.closeOnce.Do(func() { close(r.closed) })
+	return nil
+}
+
+// Unexpected returns writes the recording did not contain at that point, in the bare form
+func (r *Replay) Unexpected() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.unexpected...)
+}
+
+// Remaining returns recorded writes the client did not make yet, in the bare form
+func (r *Replay) Remaining() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	remaining := make([]string, 0, len(r.steps))
+	for _, step := range r.steps {
+		remaining = append(remaining, step.sent)
+	}
+	return remaining
+}
+
+// ReplayDialer plays the frames back, every transport it makes starts from the beginning
+type ReplayDialer struct {
+	Frames []Frame
+}
+
+func (d ReplayDialer) Dial() (Transport, error) {
+	return NewReplay(d.Frames), nil
+}
@@ -0,0 +1,56 @@
+package eiscp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Onkyo RS-232 ports run at 9600 8N1
+const DefaultBaudRate = 9600
+
+// Sends plain ISCP messages over a serial line, without the eISCP header
+type serialTransport struct {
+	port   io.ReadWriteCloser
+	reader *bufio.Reader
+}
+
+func DialSerial(device string, baudRate int) (Transport, error) {
+	port, err := openSerialPort(device, baudRate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrConnection, err)
+	}
+	return newSerialTransport(port), nil
+}
+
+func newSerialTransport(port io.ReadWriteCloser) *serialTransport {
+	return &serialTransport{port: port, reader: bufio.NewReader(port)}
+}
+
+func (t *serialTransport) WriteMessage(message Message) error {
+	_, err := t.port.Write(message.Bytes())
+	return err
+}
+
+// Messages end with EOF, CR or LF, in whatever combination the model uses
+func (t *serialTransport) ReadMessage() (Message, error) {
+	var data []byte
+	for {
+		b, err := t.reader.ReadByte()
+		if err != nil {
+			return Message{}, err
+		}
+		if b != 0x1a && b != '\r' && b != '\n' {
+			data = append(data, b)
+			continue
+		}
+		// Skip the rest of the terminator sequence
+		if len(data) > 0 {
+			return ParseISCPMessage(data)
+		}
+	}
+}
+
+func (t *serialTransport) Close() error {
+	return t.port.Close()
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package eiscp
+
+import (
+	"errors"
+	"io"
+)
+
+func openSerialPort(device string, baudRate int) (io.ReadWriteCloser, error) {
+	return nil, errors.New("serial transport is not supported on this platform")
+}
@@ -0,0 +1,125 @@
+//go:build linux
+
+package eiscp_test
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+	"golang.org/x/sys/unix"
+)
+
+// Opens a pseudo terminal, returning its master side and the path of the slave
+// the client opens as its serial device
+func openPty(t *testing.T) (*os.File, string) {
+	t.Helper()
+	fd, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("no pseudo terminals: %v", err)
+	}
+	master := os.NewFile(uintptr(fd), "/dev/ptmx")
+	t.Cleanup(func() { master.Close() })
+
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		t.Fatalf("unlocking pty: %v", err)
+	}
+	number, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		t.Fatalf("getting pty number: %v", err)
+	}
+	return master, fmt.Sprintf("/dev/pts/%d", number)
+}
+
+// Answers every query read from the master side with the response, ended by the terminator
+func serveSerial(master *os.File, responses map[string]string, terminator string) {
+	reader := bufio.NewReader(master)
+	for {
+		line, err := reader.ReadString('\r')
+		if err != nil {
+			return
+		}
+		if response, ok := responses[line[:len(line)-1]]; ok {
+			master.WriteString(response + terminator)
+		}
+	}
+}
+
+func TestSerialQueryVolume(t *testing.T) {
+	terminators := map[string]string{
+		"EOF":       "\x1a",
+		"CR":        "\r",
+		"LF":        "\n",
+		"CR LF":     "\r\n",
+		"EOF CR LF": "\x1a\r\n",
+	}
+	for name, terminator := range terminators {
+		t.Run(name, func(t *testing.T) {
+			master, device := openPty(t)
+			go serveSerial(master, map[string]string{"!1MVLQSTN": "!1MVL1E"}, terminator)
+
+			client, err := eiscp.NewSerialClient(device, eiscp.DefaultBaudRate)
+			if err != nil {
+				t.Fatalf("NewSerialClient: %v", err)
+			}
+			defer client.Close()
+			client.SetCommandGap(0)
+
+			// Twice, so the rest of the first terminator must not spoil the second message
+			for i := 0; i < 2; i++ {
+				level, err := client.QueryVolume()
+				if err != nil {
+					t.Fatalf("QueryVolume: %v", err)
+				}
+				if level != 30 {
+					t.Fatalf("QueryVolume = %d, want 30", level)
+				}
+			}
+		})
+	}
+}
+
+func TestSerialWritesPlainISCP(t *testing.T) {
+	master, device := openPty(t)
+	client, err := eiscp.NewSerialClient(device, eiscp.DefaultBaudRate)
+	if err != nil {
+		t.Fatalf("NewSerialClient: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.SendCommand("PWR01"); err != nil {
+		t.Fatalf("SendCommand: %v", err)
+	}
+	line, err := bufio.NewReader(master).ReadString('\r')
+	if err != nil {
+		t.Fatalf("reading pty: %v", err)
+	}
+	// No eISCP header on the serial line
+	if line != "!1PWR01\r" {
+		t.Fatalf("written %q, want %q", line, "!1PWR01\r")
+	}
+}
+
+func TestDialSerialErrors(t *testing.T) {
+	_, device := openPty(t)
+	tests := []struct {
+		name     string
+		device   string
+		baudRate int
+	}{
+		{"unsupported baud rate", device, 1234},
+		{"missing device", "/dev/does-not-exist", eiscp.DefaultBaudRate},
+		{"not a serial device", "/dev/null", eiscp.DefaultBaudRate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := eiscp.DialSerial(tt.device, tt.baudRate)
+			if !errors.Is(err, eiscp.ErrConnection) {
+				t.Fatalf("DialSerial error = %v, want ErrConnection", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package eiscp
+
+import "sync"
+
+// How many messages a subscriber can fall behind before they are dropped
+const subscriptionBuffer = 256
+
+// Fans incoming messages out to everyone interested in all of them
+type subscribers struct {
+	mu       sync.Mutex
+	channels map[chan Message]struct{}
+	closed   bool
+}
+
+func newSubscribers() *subscribers {
+	return &subscribers{channels: make(map[chan Message]struct{})}
+}
+
+// Never blocks, slow subscribers miss messages instead of stalling the connection
+func (s *subscribers) publish(message Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.channels {
+		select {
+		case ch <- message:
+		default:
+		}
+	}
+}
+
+func (s *subscribers) add() (chan Message, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan Message, subscriptionBuffer)
+	if s.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	s.channels[ch] = struct{}{}
+
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.channels[ch]; ok {
+			delete(s.channels, ch)
+			close(ch)
+		}
+	}
+}
+
+// Closes every subscription once the connection is gone
+func (s *subscribers) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for ch := range s.channels {
+		delete(s.channels, ch)
+		close(ch)
+	}
+}
+
+// Subscribe delivers every message received from now on, including the ones
+// answering queries of others, until cancel is called or the connection closes.
+// Messages are dropped for subscribers falling behind.
+func (c *EISCPClient) Subscribe() (messages <-chan Message, cancel func()) {
+	return c.subscribers.add()
+}
@@ -0,0 +1,80 @@
+package eiscp
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Transport carries ISCP messages to and from the receiver, framing them as the medium requires
+type Transport interface {
+	WriteMessage(message Message) error
+	// Malformed messages are reported with ErrInvalidMessage, reading can go on after them
+	ReadMessage() (Message, error)
+	Close() error
+}
+
+// Dialer establishes the transport, letting clients be pointed at anything speaking ISCP
+type Dialer interface {
+	Dial() (Transport, error)
+}
+
+// DialerFunc adapts a plain function to the Dialer interface
+type DialerFunc func() (Transport, error)
+
+func (f DialerFunc) Dial() (Transport, error) {
+	return f()
+}
+
+// EISCPDialer connects to the receiver over the network
+type EISCPDialer struct {
+	Host string
+	Port string
+}
+
+func (d EISCPDialer) Dial() (Transport, error) {
+	return DialEISCP(d.Host, d.Port)
+}
+
+// SerialDialer connects to the receiver over its RS-232 port
+type SerialDialer struct {
+	Device   string
+	BaudRate int
+}
+
+func (d SerialDialer) Dial() (Transport, error) {
+	return DialSerial(d.Device, d.BaudRate)
+}
+
+// Wraps ISCP messages into eISCP packets over a TCP connection
+type eiscpTransport struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func DialEISCP(host, port string) (Transport, error) {
+	serverAddress := net.JoinHostPort(host, port)
+	conn, err := net.DialTimeout("tcp", serverAddress, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrConnection, err)
+	}
+	return &eiscpTransport{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+func (t *eiscpTransport) WriteMessage(message Message) error {
+	_, err := t.conn.Write(NewEISCPPacket(message).Bytes())
+	return err
+}
+
+func (t *eiscpTransport) ReadMessage() (Message, error) {
+	packet, err := ReadEISCPPacket(t.reader)
+	if err != nil {
+		return Message{}, err
+	}
+	return packet.Message()
+}
+
+func (t *eiscpTransport) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,149 @@
+package eiscp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Tuner bands are selected like inputs, but their codes never get renamed
+var tunerBands = map[string]string{
+	"fm":  "24",
+	"am":  "25",
+	"dab": "33",
+}
+
+// TunerFrequency is the frequency the FM (MHz) or AM (kHz) tuner is set to
+type TunerFrequency struct {
+	Band  string  `json:"band"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+}
+
+func (f TunerFrequency) String() string {
+	if f.Band == "fm" {
+		return fmt.Sprintf("%.2f %s", f.Value, f.Unit)
+	}
+	return fmt.Sprintf("%.0f %s", f.Value, f.Unit)
+}
+
+func (c *EISCPClient) SetTunerBand(band string) error {
+	code, ok := tunerBands[band]
+	if !ok {
+		return fmt.Errorf("%w: invalid tuner band '%s'", ErrValidation, band)
+	}
+	return c.send("SLI", code)
+}
+
+// Tunes directly to the frequency given in MHz for FM and kHz for AM
+func (c *EISCPClient) SetTunerFrequency(band string, frequency float64) error {
+	var value int
+	switch band {
+	case "fm":
+		if frequency < 87.5 || frequency > 108 {
+			return fmt.Errorf("%w: FM frequency %.2f must be between 87.50 and 108.00 MHz", ErrValidation, frequency)
+		}
+		// FM is tuned in 10 kHz units
+		value = int(frequency*100 + 0.5)
+	case "am":
+		if frequency < 522 || frequency > 1710 {
+			return fmt.Errorf("%w: AM frequency %.0f must be between 522 and 1710 kHz", ErrValidation, frequency)
+		}
+		value = int(frequency + 0.5)
+	default:
+		return fmt.Errorf("%w: direct tuning is not supported for band '%s'", ErrValidation, band)
+	}
+	return c.send("TUN", fmt.Sprintf("%05d", value))
+}
+
+func (c *EISCPClient) TunerUp() error {
+	return c.send("TUN", "UP")
+}
+
+func (c *EISCPClient) TunerDown() error {
+	return c.send("TUN", "DOWN")
+}
+
+func (c *EISCPClient) QueryTunerFrequency() (TunerFrequency, error) {
+	response, err := c.query("TUN")
+	if err != nil {
+		return TunerFrequency{}, err
+	}
+
+	value, err := strconv.Atoi(response.Parameter)
+	if err != nil {
+		return TunerFrequency{}, fmt.Errorf("%w: failed to parse tuner frequency response", ErrTransport)
+	}
+
+	// AM frequencies never reach the lowest FM one, so the value tells the band
+	if value >= 8750 {
+		return TunerFrequency{Band: "fm", Value: float64(value) / 100, Unit: "MHz"}, nil
+	}
+	return TunerFrequency{Band: "am", Value: float64(value), Unit: "kHz"}, nil
+}
+
+func validatePreset(preset int) error {
+	if preset < 1 || preset > 40 {
+		return fmt.Errorf("%w: preset %d must be between 1 and 40", ErrValidation, preset)
+	}
+	return nil
+}
+
+func (c *EISCPClient) SelectPreset(preset int) error {
+	if err := validatePreset(preset); err != nil {
+		return err
+	}
+	return c.send("PRS", fmt.Sprintf("%02X", preset))
+}
+
+// Stores the currently tuned station under the preset number
+func (c *EISCPClient) StorePreset(preset int) error {
+	if err := validatePreset(preset); err != nil {
+		return err
+	}
+	return c.send("PRM", fmt.Sprintf("%02X", preset))
+}
+
+func (c *EISCPClient) PresetUp() error {
+	return c.send("PRS", "UP")
+}
+
+func (c *EISCPClient) PresetDown() error {
+	return c.send("PRS", "DOWN")
+}
+
+func (c *EISCPClient) QueryPreset() (int, error) {
+	response, err := c.query("PRS")
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := strconv.ParseInt(response.Parameter, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to parse preset response", ErrTransport)
+	}
+	return int(result), nil
+}
+
+var rdsModes = map[string]string{
+	"rt":  "00",
+	"pty": "01",
+	"tp":  "02",
+}
+
+// Switches the RDS information shown on the display (rt, pty, tp)
+func (c *EISCPClient) SetRDSDisplay(mode string) error {
+	code, ok := rdsModes[mode]
+	if !ok {
+		return fmt.Errorf("%w: invalid RDS mode '%s'", ErrValidation, mode)
+	}
+	return c.send("RDS", code)
+}
+
+func (c *EISCPClient) QueryStationName() (string, error) {
+	response, err := c.query("DSN")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(response.Parameter), nil
+}
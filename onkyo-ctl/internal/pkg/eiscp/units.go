@@ -0,0 +1,100 @@
+package eiscp
+
+import (
+	"fmt"
+	"math"
+)
+
+// VolumeUnit is the unit volume levels are given in outside of the protocol
+type VolumeUnit string
+
+const (
+	// Raw steps as sent in MVL messages
+	VolumeRaw VolumeUnit = "raw"
+	// Decibels as shown on the receiver display in absolute mode
+	VolumeDB VolumeUnit = "db"
+	// Percentage of a reference maximum, e.g. the profile max volume
+	VolumePercent VolumeUnit = "pct"
+)
+
+// Empty unit means raw steps
+func ParseVolumeUnit(unit string) (VolumeUnit, error) {
+	switch VolumeUnit(unit) {
+	case "", VolumeRaw:
+		return VolumeRaw, nil
+	case VolumeDB, VolumePercent:
+		return VolumeUnit(unit), nil
+	}
+	return "", fmt.Errorf("%w: invalid volume unit '%s', expected raw, db or pct", ErrValidation, unit)
+}
+
+// VolumeScale maps raw volume steps onto the decibels of a model
+type VolumeScale struct {
+	// Decibels per raw step
+	StepDB float64 `json:"stepDb"`
+	// Level shown for raw step 0
+	MinDB float64 `json:"minDb"`
+}
+
+// Whole decibel steps starting at -82 dB, as most Onkyo receivers have
+var defaultVolumeScale = VolumeScale{StepDB: 1, MinDB: -82}
+
+func (s VolumeScale) ToDB(level int) float64 {
+	return s.MinDB + float64(level)*s.StepDB
+}
+
+// Rounds to the nearest step the receiver can take
+func (s VolumeScale) FromDB(db float64) int {
+	return int(math.Round((db - s.MinDB) / s.StepDB))
+}
+
+func (c *EISCPClient) VolumeScale() VolumeScale {
+	return c.Model().VolumeScale
+}
+
+// Converts raw volume level to the unit, percentage relative to maxVolume
+func (c *EISCPClient) VolumeToUnit(level int, unit VolumeUnit, maxVolume int) float64 {
+	switch unit {
+	case VolumeDB:
+		return c.VolumeScale().ToDB(level)
+	case VolumePercent:
+		if maxVolume <= 0 {
+			return 0
+		}
+		return float64(level) * 100 / float64(maxVolume)
+	}
+	return float64(level)
+}
+
+// Converts volume given in the unit to raw level, percentage relative to maxVolume
+func (c *EISCPClient) VolumeFromUnit(value float64, unit VolumeUnit, maxVolume int) (int, error) {
+	switch unit {
+	case VolumeDB:
+		return c.VolumeScale().FromDB(value), nil
+	case VolumePercent:
+		if value < 0 || value > 100 {
+			return 0, fmt.Errorf("%w: volume %.0f%% must be between 0 and 100", ErrValidation, value)
+		}
+		// Profiles allowing more than the model can take stop at the model max
+		level := int(math.Round(value * float64(maxVolume) / 100))
+		if modelMax := c.MaxVolume(); level > modelMax {
+			level = modelMax
+		}
+		return level, nil
+	}
+	if value != math.Trunc(value) {
+		return 0, fmt.Errorf("%w: raw volume level %g must be a whole number", ErrValidation, value)
+	}
+	return int(value), nil
+}
+
+// Formats the volume for humans, raw levels stay bare numbers
+func FormatVolume(value float64, unit VolumeUnit) string {
+	switch unit {
+	case VolumeDB:
+		return fmt.Sprintf("%.1f dB", value)
+	case VolumePercent:
+		return fmt.Sprintf("%.0f%%", value)
+	}
+	return fmt.Sprintf("%.0f", value)
+}
@@ -0,0 +1,160 @@
+package eiscp_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/mtyszkiewicz/eiscp/internal/pkg/eiscp"
+)
+
+func newModelClient(t *testing.T, model string) *eiscp.EISCPClient {
+	t.Helper()
+	client, _ := newTestClient(t)
+	if err := client.SetModel(model); err != nil {
+		t.Fatalf("SetModel(%q): %v", model, err)
+	}
+	return client
+}
+
+func TestParseVolumeUnit(t *testing.T) {
+	tests := []struct {
+		unit    string
+		want    eiscp.VolumeUnit
+		wantErr bool
+	}{
+		{"", eiscp.VolumeRaw, false},
+		{"raw", eiscp.VolumeRaw, false},
+		{"db", eiscp.VolumeDB, false},
+		{"pct", eiscp.VolumePercent, false},
+		{"dB", "", true},
+		{"percent", "", true},
+	}
+	for _, tt := range tests {
+		got, err := eiscp.ParseVolumeUnit(tt.unit)
+		if tt.wantErr {
+			if !errors.Is(err, eiscp.ErrValidation) {
+				t.Errorf("ParseVolumeUnit(%q) error = %v, want ErrValidation", tt.unit, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseVolumeUnit(%q) = %q, %v, want %q", tt.unit, got, err, tt.want)
+		}
+	}
+}
+
+func TestVolumeUnitRoundTrip(t *testing.T) {
+	tests := []struct {
+		model     string
+		unit      eiscp.VolumeUnit
+		maxVolume int
+	}{
+		{"TX-L20D", eiscp.VolumeRaw, 0},
+		{"TX-L20D", eiscp.VolumeDB, 0},
+		{"TX-L20D", eiscp.VolumePercent, 50},
+		{"TX-L20D", eiscp.VolumePercent, 28},
+		{"TX-NR", eiscp.VolumeDB, 0},
+		{"TX-NR", eiscp.VolumePercent, 80},
+		{"TX-NR", eiscp.VolumePercent, 35},
+	}
+	for _, tt := range tests {
+		client := newModelClient(t, tt.model)
+		limit := client.MaxVolume()
+		if tt.maxVolume > 0 {
+			limit = tt.maxVolume
+		}
+		for level := 0; level <= limit; level++ {
+			value := client.VolumeToUnit(level, tt.unit, tt.maxVolume)
+			got, err := client.VolumeFromUnit(value, tt.unit, tt.maxVolume)
+			if err != nil {
+				t.Fatalf("%s %s: VolumeFromUnit(%v) of level %d: %v", tt.model, tt.unit, value, level, err)
+			}
+			if got != level {
+				t.Errorf("%s %s max %d: level %d became %v and back %d", tt.model, tt.unit, tt.maxVolume, level, value, got)
+			}
+		}
+	}
+}
+
+func TestVolumeToUnit(t *testing.T) {
+	tests := []struct {
+		model     string
+		level     int
+		unit      eiscp.VolumeUnit
+		maxVolume int
+		want      float64
+	}{
+		{"TX-L20D", 30, eiscp.VolumeRaw, 0, 30},
+		{"TX-L20D", 0, eiscp.VolumeDB, 0, -82},
+		{"TX-L20D", 31, eiscp.VolumeDB, 0, -51},
+		{"TX-NR", 31, eiscp.VolumeDB, 0, -66.5},
+		{"TX-L20D", 14, eiscp.VolumePercent, 28, 50},
+		{"TX-L20D", 42, eiscp.VolumePercent, 28, 150},
+		{"TX-L20D", 14, eiscp.VolumePercent, 0, 0},
+	}
+	for _, tt := range tests {
+		client := newModelClient(t, tt.model)
+		if got := client.VolumeToUnit(tt.level, tt.unit, tt.maxVolume); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s VolumeToUnit(%d, %s, %d) = %v, want %v", tt.model, tt.level, tt.unit, tt.maxVolume, got, tt.want)
+		}
+	}
+}
+
+func TestVolumeFromUnit(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     string
+		value     float64
+		unit      eiscp.VolumeUnit
+		maxVolume int
+		want      int
+		wantErr   bool
+	}{
+		{"raw", "TX-L20D", 30, eiscp.VolumeRaw, 0, 30, false},
+		{"raw fraction", "TX-L20D", 30.5, eiscp.VolumeRaw, 0, 0, true},
+		{"db", "TX-L20D", -51, eiscp.VolumeDB, 0, 31, false},
+		{"db rounds to whole step", "TX-L20D", -51.4, eiscp.VolumeDB, 0, 31, false},
+		{"db rounds to half step", "TX-NR", -66.3, eiscp.VolumeDB, 0, 31, false},
+		{"pct of profile", "TX-L20D", 50, eiscp.VolumePercent, 28, 14, false},
+		{"pct rounds", "TX-L20D", 33, eiscp.VolumePercent, 28, 9, false},
+		{"pct zero", "TX-L20D", 0, eiscp.VolumePercent, 28, 0, false},
+		{"pct full", "TX-L20D", 100, eiscp.VolumePercent, 28, 28, false},
+		{"pct clamped to model max", "TX-L20D", 100, eiscp.VolumePercent, 90, 50, false},
+		{"pct above 100", "TX-L20D", 101, eiscp.VolumePercent, 28, 0, true},
+		{"pct negative", "TX-L20D", -1, eiscp.VolumePercent, 28, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newModelClient(t, tt.model)
+			got, err := client.VolumeFromUnit(tt.value, tt.unit, tt.maxVolume)
+			if tt.wantErr {
+				if !errors.Is(err, eiscp.ErrValidation) {
+					t.Fatalf("error = %v, want ErrValidation", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("VolumeFromUnit(%v, %s, %d) = %d, %v, want %d", tt.value, tt.unit, tt.maxVolume, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatVolume(t *testing.T) {
+	tests := []struct {
+		value float64
+		unit  eiscp.VolumeUnit
+		want  string
+	}{
+		{30, eiscp.VolumeRaw, "30"},
+		{-51, eiscp.VolumeDB, "-51.0 dB"},
+		{-66.5, eiscp.VolumeDB, "-66.5 dB"},
+		{50, eiscp.VolumePercent, "50%"},
+	}
+	for _, tt := range tests {
+		if got := eiscp.FormatVolume(tt.value, tt.unit); got != tt.want {
+			t.Errorf("FormatVolume(%v, %s) = %q, want %q", tt.value, tt.unit, got, tt.want)
+		}
+	}
+}
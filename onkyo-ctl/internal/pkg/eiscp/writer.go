@@ -0,0 +1,356 @@
+package eiscp
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Receivers drop commands sent back to back, so writes are spaced by default
+const DefaultCommandGap = 50 * time.Millisecond
+
+// How many writes can wait for their turn before new ones are refused
+const MaxQueuedWrites = 64
+
+// Priority decides which queued write goes first, equal priorities keep their order
+type Priority int
+
+const (
+	// Cosmetic commands, like dimmer animations
+	PriorityLow Priority = iota
+	PriorityNormal
+	// Commands that must not wait behind anything, like power and mute
+	PriorityHigh
+)
+
+var commandPriorities = map[string]Priority{
+	"PWR": PriorityHigh,
+	"AMT": PriorityHigh,
+	"DIM": PriorityLow,
+}
+
+// Default priority of the message, based on its command
+func PriorityOf(message Message) Priority {
+	if priority, ok := commandPriorities[message.Command]; ok {
+		return priority
+	}
+	return PriorityNormal
+}
+
+// Commands setting a state where only the last value matters.
+// Queued writes of these are replaced by newer values instead of piling up.
+var coalescedCommands = map[string]bool{
+	"PWR": true,
+	"MVL": true,
+	"AMT": true,
+	"SWL": true,
+	"CTL": true,
+	"TFR": true,
+	"DIM": true,
+	"SLI": true,
+	"LMD": true,
+	"SLP": true,
+	"TUN": true,
+	"PRS": true,
+}
+
+// Parameters changing the state relatively, each one of them counts
+var relativeParameters = map[string]bool{
+	"UP":    true,
+	"DOWN":  true,
+	"UP1":   true,
+	"DOWN1": true,
+	"TG":    true,
+}
+
+// Reports whether the message sets an absolute value a newer one can replace
+func (m Message) coalescable() bool {
+	return coalescedCommands[m.Command] && !m.IsQuery() && !relativeParameters[m.Parameter]
+}
+
+// Message of a sequence, written no sooner than the delay after the previous one
+type sequenceStep struct {
+	message Message
+	delay   time.Duration
+}
+
+// Completion tracks a queued write. Callers whose values were coalesced into
+// a newer one share its completion.
+type Completion struct {
+	priority Priority
+	steps    []sequenceStep
+	next     int
+	nextAt   time.Time
+
+	message Message
+	sentAt  time.Time
+	err     error
+	done    chan struct{}
+}
+
+func newCompletion(priority Priority, steps []sequenceStep) *Completion {
+	return &Completion{priority: priority, steps: steps, done: make(chan struct{})}
+}
+
+// Closed once the write finished, successfully or not
+func (c *Completion) Done() <-chan struct{} {
+	return c.done
+}
+
+// Waits until the write finishes and returns its error
+func (c *Completion) Wait() error {
+	<-c.done
+	return c.err
+}
+
+// Error of the finished write, nil while still queued
+func (c *Completion) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Message actually written, the last one of a sequence.
+// Differs from the queued one when a newer value replaced it.
+func (c *Completion) Message() Message {
+	<-c.done
+	return c.message
+}
+
+// When the message was written, zero if it was not
+func (c *Completion) SentAt() time.Time {
+	<-c.done
+	return c.sentAt
+}
+
+func (c *Completion) finished() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Completion) finish(err error) {
+	c.err = err
+	close(c.done)
+}
+
+// Sends queued messages one by one from a single goroutine, keeping the gap between them
+type writer struct {
+	transport Transport
+
+	mu     sync.Mutex
+	queue  []*Completion
+	active *Completion // Sequence in progress
+	gap    time.Duration
+	// Everything but power commands waits until then, while the receiver wakes up
+	heldUntil time.Time
+	closed    bool
+	wake      chan struct{}
+	stop      chan struct{}
+}
+
+func newWriter(transport Transport) *writer {
+	w := &writer{
+		transport: transport,
+		gap:       DefaultCommandGap,
+		wake:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Queues the message. Absolute values still waiting for their turn are
+// replaced by the newer value, which moves to the back of the queue, so it
+// does not overtake writes queued before it.
+func (w *writer) enqueue(message Message, priority Priority) (*Completion, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil, fmt.Errorf("%w: client closed", ErrConnection)
+	}
+
+	if message.coalescable() {
+		for i, queued := range w.queue {
+			if len(queued.steps) == 1 && queued.steps[0].message.Command == message.Command && queued.steps[0].message.coalescable() {
+				queued.steps[0].message = message
+				if priority > queued.priority {
+					queued.priority = priority
+				}
+				w.queue = append(append(w.queue[:i], w.queue[i+1:]...), queued)
+				return queued, nil
+			}
+		}
+	}
+	return w.push(newCompletion(priority, []sequenceStep{{message: message}}))
+}
+
+// Queues messages written as one unit, only high priority writes can get in between
+func (w *writer) sequence(priority Priority, steps []sequenceStep) (*Completion, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil, fmt.Errorf("%w: client closed", ErrConnection)
+	}
+	return w.push(newCompletion(priority, steps))
+}
+
+// Must be called with the mutex held
+func (w *writer) push(completion *Completion) (*Completion, error) {
+	if len(w.queue) >= MaxQueuedWrites {
+		return nil, fmt.Errorf("%w: %d writes already queued", ErrBusy, len(w.queue))
+	}
+	w.queue = append(w.queue, completion)
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return completion, nil
+}
+
+func (w *writer) setGap(gap time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.gap = gap
+}
+
+// Holds back writes other than power commands until the time, zero time releases them
+func (w *writer) hold(until time.Time) {
+	w.mu.Lock()
+	w.heldUntil = until
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Earliest time the next step of the write can go out, ignoring the gap.
+// Must be called with the mutex held.
+func (w *writer) readyAt(completion *Completion) time.Time {
+	ready := completion.nextAt
+	if completion.steps[completion.next].message.Command != "PWR" && w.heldUntil.After(ready) {
+		ready = w.heldUntil
+	}
+	return ready
+}
+
+// Picks the first queued write of the highest priority, or the sequence in progress
+// unless a high priority write waits. Must be called with the mutex held.
+func (w *writer) peek() (*Completion, int) {
+	index := -1
+	for i, queued := range w.queue {
+		if index < 0 || queued.priority > w.queue[index].priority {
+			index = i
+		}
+	}
+	if w.active != nil && (index < 0 || w.queue[index].priority < PriorityHigh) {
+		return w.active, -1
+	}
+	if index < 0 {
+		return nil, -1
+	}
+	return w.queue[index], index
+}
+
+func (w *writer) run() {
+	var last time.Time
+	for {
+		w.mu.Lock()
+		next, _ := w.peek()
+		due := last.Add(w.gap)
+		if next != nil && w.readyAt(next).After(due) {
+			due = w.readyAt(next)
+		}
+		w.mu.Unlock()
+
+		if next == nil {
+			select {
+			case <-w.wake:
+				continue
+			case <-w.stop:
+				return
+			}
+		}
+
+		// Waiting happens before taking the message, so newer values can still
+		// replace it and more important ones can still jump ahead
+		if wait := time.Until(due); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-w.wake:
+				continue
+			case <-w.stop:
+				return
+			}
+		}
+
+		w.mu.Lock()
+		pending, index := w.peek()
+		if pending == nil || time.Now().Before(w.readyAt(pending)) {
+			// Closed, overtaken or held back in the meantime
+			w.mu.Unlock()
+			continue
+		}
+		if index >= 0 {
+			w.queue = append(w.queue[:index], w.queue[index+1:]...)
+		}
+		step := pending.steps[pending.next]
+		w.mu.Unlock()
+
+		err := w.transport.WriteMessage(step.message)
+		last = time.Now()
+
+		w.mu.Lock()
+		if w.active == pending {
+			w.active = nil
+		}
+		if !pending.finished() {
+			// Unless close failed it already
+			pending.next++
+			pending.message = step.message
+			switch {
+			case err != nil:
+				pending.finish(fmt.Errorf("%w: %v", ErrTransport, err))
+			case pending.next == len(pending.steps):
+				pending.sentAt = last
+				pending.finish(nil)
+			case w.closed:
+				pending.finish(fmt.Errorf("%w: client closed", ErrConnection))
+			default:
+				pending.nextAt = last.Add(pending.steps[pending.next].delay)
+				w.active = pending
+			}
+		}
+		w.mu.Unlock()
+	}
+}
+
+// Stops the writer, failing everything still queued
+func (w *writer) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	w.closed = true
+	close(w.stop)
+
+	pending := w.queue
+	if w.active != nil {
+		pending = append(pending, w.active)
+	}
+	for _, completion := range pending {
+		completion.finish(fmt.Errorf("%w: client closed", ErrConnection))
+	}
+	w.queue = nil
+	w.active = nil
+}
@@ -0,0 +1,41 @@
+package eiscp
+
+import "sort"
+
+// Zone controlled when none is given
+const MainZone = "main"
+
+// ZoneCommands are the commands controlling one zone, zones other than the main
+// one have their own commands taking the same parameters
+type ZoneCommands struct {
+	Power  string
+	Volume string
+	Muting string
+	Input  string
+}
+
+// Named as in the model profiles
+var zoneCommands = map[string]ZoneCommands{
+	MainZone: {Power: "PWR", Volume: "MVL", Muting: "AMT", Input: "SLI"},
+	"zone2":  {Power: "ZPW", Volume: "ZVL", Muting: "ZMT", Input: "SLZ"},
+	"zone3":  {Power: "PW3", Volume: "VL3", Muting: "MT3", Input: "SL3"},
+	"zone4":  {Power: "PW4", Volume: "VL4", Muting: "MT4", Input: "SL4"},
+}
+
+// Finds the commands of the zone, e.g. "zone2"
+func LookupZone(zone string) (ZoneCommands, bool) {
+	commands, ok := zoneCommands[zone]
+	return commands, ok
+}
+
+// Names of all zones, main first
+func Zones() []string {
+	zones := make([]string, 0, len(zoneCommands))
+	for zone := range zoneCommands {
+		if zone != MainZone {
+			zones = append(zones, zone)
+		}
+	}
+	sort.Strings(zones)
+	return append([]string{MainZone}, zones...)
+}